@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/rpc"
 )
 
 // CLI provides a handler for the basic CLI
@@ -12,79 +15,276 @@ type CLI struct {
 
 // Run runs the CLI
 func (cli *CLI) Run() {
-	cli.validateArgs()
+	args := cli.selectNetwork()
+
+	combineMultiSigCmd := flag.NewFlagSet("combinemultisig", flag.ExitOnError)
+	combineMultiSigTxs := combineMultiSigCmd.String("txs", "", "Comma separated copies of a multisig transaction in hex")
 
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
-	createBlockchainAddress := createBlockchainCmd.String("address", "", "Address")
+	createBlockchainAddress := createBlockchainCmd.String("address", "", "Address to pay the reward of the first block after genesis")
+
+	createMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	createMultiSigM := createMultiSigCmd.Int("m", 0, "Number of signatures needed")
+	createMultiSigKeys := createMultiSigCmd.String("keys", "", "Comma separated wallet addresses or public keys in hex")
 
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	createWalletMnemonic := createWalletCmd.Bool("mnemonic", false, "Derive this and future addresses from a new seed, printing its mnemonic")
+	createWalletWords := createWalletCmd.Int("words", 12, "Number of words of the mnemonic: 12, 15, 18, 21 or 24")
+	createWalletAccount := createWalletCmd.Int("account", 0, "Account of the seed to derive addresses in")
+
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+
+	explorerCmd := flag.NewFlagSet("explorer", flag.ExitOnError)
+	explorerHTTP := explorerCmd.String("http", ":8080", "Address to serve the explorer on")
 
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	getBalanceAddress := getBalanceCmd.String("address", "", "Address")
 
+	getTxProofCmd := flag.NewFlagSet("gettxproof", flag.ExitOnError)
+	getTxProofTxID := getTxProofCmd.String("txid", "", "ID of the transaction in hex")
+
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	historyAddress := historyCmd.String("address", "", "Address")
+
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	listAddressesPubKeys := listAddressesCmd.Bool("pubkeys", false, "Print the public key of each address, for createmultisig")
+
+	migrateWalletCmd := flag.NewFlagSet("migratewallet", flag.ExitOnError)
+
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	mineAddress := mineCmd.String("address", "", "Address to pay block rewards to")
+	minePort := mineCmd.Int("port", 0, "Port to listen for peers on")
+	mineSeeds := mineCmd.String("seeds", "", "Comma separated addresses of nodes to connect to")
+	mineAPIHost := mineCmd.String("apihost", "127.0.0.1", "Host to serve getblocktemplate and submitblock on")
+	mineAPIPort := mineCmd.Int("apiport", 0, "Port to serve getblocktemplate and submitblock on")
+	mineRPCConf := mineCmd.String("rpcconf", "", "File holding the rpcuser and rpcpassword the API requires, defaulting to "+rpc.DefaultConfigFile+" in the network directory")
+	mineThreads := mineCmd.Int("threads", 0, "Number of mining threads, defaulting to the number of CPUs")
 
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
+	printChainFrom := printChainCmd.Int("from", -1, "Height of the first block to print")
+	printChainTo := printChainCmd.Int("to", -1, "Height of the last block to print")
+
+	reindexCmd := flag.NewFlagSet("reindex", flag.ExitOnError)
+	reindexTxIndex := reindexCmd.Bool("txindex", false, "Build the transaction index")
+	reindexAddrIndex := reindexCmd.Bool("addrindex", false, "Build the address index")
+
+	restAPICmd := flag.NewFlagSet("restapi", flag.ExitOnError)
+	restAPIHTTP := restAPICmd.String("http", ":8081", "Address to serve the REST API on")
+
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	restoreWalletAccount := restoreWalletCmd.Int("account", 0, "Account of the seed to derive addresses in")
+	restoreWalletGapLimit := restoreWalletCmd.Int("gaplimit", blockchain.DefaultGapLimit, "Number of unused addresses in a row that ends the search for paid addresses")
 
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	sendFrom := sendCmd.String("from", "", "Sender Address")
 	sendTo := sendCmd.String("to", "", "Receiver Address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount being sent")
+	sendFeeRate := sendCmd.Int("feerate", 0, "Fee paid per 1000 bytes of the transaction")
+
+	sendRawTransactionCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	sendRawTransactionTx := sendRawTransactionCmd.String("tx", "", "Signed transaction in hex")
+	sendRawTransactionMiner := sendRawTransactionCmd.String("miner", "", "Address to pay the block reward to")
+
+	signMultiSigCmd := flag.NewFlagSet("signmultisig", flag.ExitOnError)
+	signMultiSigTx := signMultiSigCmd.String("tx", "", "Multisig transaction in hex")
+
+	spendMultiSigCmd := flag.NewFlagSet("spendmultisig", flag.ExitOnError)
+	spendMultiSigFrom := spendMultiSigCmd.String("from", "", "Multisig address of the wallet")
+	spendMultiSigTo := spendMultiSigCmd.String("to", "", "Receiver Address")
+	spendMultiSigAmount := spendMultiSigCmd.Int("amount", 0, "Amount being sent")
+	spendMultiSigFeeRate := spendMultiSigCmd.Int("feerate", 0, "Fee paid per 1000 bytes of the transaction")
+
+	spvBalanceCmd := flag.NewFlagSet("spvbalance", flag.ExitOnError)
+	spvBalanceNode := spvBalanceCmd.String("node", "", "Address of the full node to sync from")
+	spvBalanceAddress := spvBalanceCmd.String("address", "", "Address to check, defaulting to every wallet address")
+
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	startNodePort := startNodeCmd.Int("port", 0, "Port to listen for peers on")
+	startNodeSeeds := startNodeCmd.String("seeds", "", "Comma separated addresses of nodes to connect to")
+	startNodeRPCPort := startNodeCmd.Int("rpcport", 0, "Port to serve the JSON-RPC API on, disabled by default")
+	startNodeRESTPort := startNodeCmd.Int("restport", 0, "Port to serve the read-only REST API on, disabled by default")
+	startNodeExplorerPort := startNodeCmd.Int("explorerport", 0, "Port to serve the web explorer on, disabled by default")
+	startNodeRPCConf := startNodeCmd.String("rpcconf", "", "File holding rpcuser and rpcpassword, defaulting to "+rpc.DefaultConfigFile+" in the network directory")
 
 	versionCmd := flag.NewFlagSet("version", flag.ExitOnError)
 
-	switch os.Args[1] {
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
+	walletLockRPCPort := walletLockCmd.Int("rpcport", 0, "JSON-RPC port of the local node")
+	walletLockRPCConf := walletLockCmd.String("rpcconf", "", "File holding rpcuser and rpcpassword, defaulting to "+rpc.DefaultConfigFile+" in the network directory")
+
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
+	walletPassphraseRPCPort := walletPassphraseCmd.Int("rpcport", 0, "JSON-RPC port of the local node")
+	walletPassphraseRPCConf := walletPassphraseCmd.String("rpcconf", "", "File holding rpcuser and rpcpassword, defaulting to "+rpc.DefaultConfigFile+" in the network directory")
+	walletPassphraseTimeout := walletPassphraseCmd.Int("timeout", 60, "Seconds to keep the wallet unlocked for")
+
+	switch args[0] {
+	case "combinemultisig":
+		if err := combineMultiSigCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse combinemultisig arguments")
+			os.Exit(1)
+		}
 	case "createblockchain":
-		if err := createBlockchainCmd.Parse(os.Args[2:]); err != nil {
+		if err := createBlockchainCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse createblockchain arguments")
 			os.Exit(1)
 		}
+	case "createmultisig":
+		if err := createMultiSigCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse createmultisig arguments")
+			os.Exit(1)
+		}
 	case "createwallet":
-		if err := createWalletCmd.Parse(os.Args[2:]); err != nil {
+		if err := createWalletCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse getwallet arguments")
 			os.Exit(1)
 		}
+	case "encryptwallet":
+		if err := encryptWalletCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse encryptwallet arguments")
+			os.Exit(1)
+		}
+	case "explorer":
+		if err := explorerCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse explorer arguments")
+			os.Exit(1)
+		}
 	case "getbalance":
-		if err := getBalanceCmd.Parse(os.Args[2:]); err != nil {
+		if err := getBalanceCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse getbalance arguments")
 			os.Exit(1)
 		}
+	case "gettxproof":
+		if err := getTxProofCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse gettxproof arguments")
+			os.Exit(1)
+		}
+	case "history":
+		if err := historyCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse history arguments")
+			os.Exit(1)
+		}
 	case "listaddresses":
-		if err := listAddressesCmd.Parse(os.Args[2:]); err != nil {
+		if err := listAddressesCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse listaddresses arguments")
 			os.Exit(1)
 		}
+	case "migratewallet":
+		if err := migrateWalletCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse migratewallet arguments")
+			os.Exit(1)
+		}
+	case "mine":
+		if err := mineCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse mine arguments")
+			os.Exit(1)
+		}
 	case "printchain":
-		if err := printChainCmd.Parse(os.Args[2:]); err != nil {
+		if err := printChainCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse printchain arguments")
 			os.Exit(1)
 		}
+	case "reindex":
+		if err := reindexCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse reindex arguments")
+			os.Exit(1)
+		}
+	case "restapi":
+		if err := restAPICmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse restapi arguments")
+			os.Exit(1)
+		}
+	case "restorewallet":
+		if err := restoreWalletCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse restorewallet arguments")
+			os.Exit(1)
+		}
 	case "send":
-		if err := sendCmd.Parse(os.Args[2:]); err != nil {
+		if err := sendCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse send arguments")
 			os.Exit(1)
 		}
+	case "sendrawtransaction":
+		if err := sendRawTransactionCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse sendrawtransaction arguments")
+			os.Exit(1)
+		}
+	case "signmultisig":
+		if err := signMultiSigCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse signmultisig arguments")
+			os.Exit(1)
+		}
+	case "spendmultisig":
+		if err := spendMultiSigCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse spendmultisig arguments")
+			os.Exit(1)
+		}
+	case "spvbalance":
+		if err := spvBalanceCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse spvbalance arguments")
+			os.Exit(1)
+		}
+	case "startnode":
+		if err := startNodeCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse startnode arguments")
+			os.Exit(1)
+		}
 	case "version":
-		if err := versionCmd.Parse(os.Args[2:]); err != nil {
+		if err := versionCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("Failed to parse version arguments")
 			os.Exit(1)
 		}
+	case "walletlock":
+		if err := walletLockCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse walletlock arguments")
+			os.Exit(1)
+		}
+	case "walletpassphrase":
+		if err := walletPassphraseCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("Failed to parse walletpassphrase arguments")
+			os.Exit(1)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
 	}
 
-	if createBlockchainCmd.Parsed() {
-		if *createBlockchainAddress == "" {
-			createBlockchainCmd.Usage()
+	if combineMultiSigCmd.Parsed() {
+		if *combineMultiSigTxs == "" {
+			combineMultiSigCmd.Usage()
 			os.Exit(1)
 		}
 
+		cli.combineMultiSig(*combineMultiSigTxs)
+	}
+
+	if createBlockchainCmd.Parsed() {
 		cli.createBlockchain(*createBlockchainAddress)
 	}
 
+	if createMultiSigCmd.Parsed() {
+		if *createMultiSigM <= 0 || *createMultiSigKeys == "" {
+			createMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.createMultiSig(*createMultiSigM, *createMultiSigKeys)
+	}
+
 	if createWalletCmd.Parsed() {
-		cli.createWallet()
+		if *createWalletWords%3 != 0 || *createWalletWords < 12 || *createWalletWords > 24 || *createWalletAccount < 0 {
+			createWalletCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.createWallet(*createWalletMnemonic, *createWalletWords, *createWalletAccount)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet()
+	}
+
+	if explorerCmd.Parsed() {
+		cli.explorer(*explorerHTTP)
 	}
 
 	if getBalanceCmd.Parsed() {
@@ -96,42 +296,211 @@ func (cli *CLI) Run() {
 		cli.getBalance(*getBalanceAddress)
 	}
 
+	if getTxProofCmd.Parsed() {
+		if *getTxProofTxID == "" {
+			getTxProofCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.getTxProof(*getTxProofTxID)
+	}
+
+	if historyCmd.Parsed() {
+		if *historyAddress == "" {
+			historyCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.history(*historyAddress)
+	}
+
 	if listAddressesCmd.Parsed() {
-		cli.listAddresses()
+		cli.listAddresses(*listAddressesPubKeys)
+	}
+
+	if migrateWalletCmd.Parsed() {
+		cli.migrateWallet()
+	}
+
+	if mineCmd.Parsed() {
+		if *mineAddress == "" || *mineThreads < 0 {
+			mineCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.mine(*mineAddress, *minePort, *mineSeeds, *mineAPIHost, *mineAPIPort, *mineRPCConf, *mineThreads)
 	}
 
 	if printChainCmd.Parsed() {
-		cli.printChain()
+		if *printChainFrom < -1 || *printChainTo < -1 || (*printChainTo >= 0 && *printChainFrom > *printChainTo) {
+			printChainCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.printChain(*printChainFrom, *printChainTo)
+	}
+
+	if reindexCmd.Parsed() {
+		if !*reindexTxIndex && !*reindexAddrIndex {
+			reindexCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.reindex(*reindexTxIndex, *reindexAddrIndex)
+	}
+
+	if restAPICmd.Parsed() {
+		cli.restAPI(*restAPIHTTP)
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletAccount < 0 || *restoreWalletGapLimit <= 0 {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.restoreWallet(*restoreWalletAccount, *restoreWalletGapLimit)
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount == 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount == 0 || *sendFeeRate < 0 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFeeRate)
+	}
+
+	if sendRawTransactionCmd.Parsed() {
+		if *sendRawTransactionTx == "" || *sendRawTransactionMiner == "" {
+			sendRawTransactionCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.sendRawTransaction(*sendRawTransactionTx, *sendRawTransactionMiner)
+	}
+
+	if signMultiSigCmd.Parsed() {
+		if *signMultiSigTx == "" {
+			signMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.signMultiSig(*signMultiSigTx)
+	}
+
+	if spendMultiSigCmd.Parsed() {
+		if *spendMultiSigFrom == "" || *spendMultiSigTo == "" || *spendMultiSigAmount == 0 || *spendMultiSigFeeRate < 0 {
+			spendMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.spendMultiSig(*spendMultiSigFrom, *spendMultiSigTo, *spendMultiSigAmount, *spendMultiSigFeeRate)
+	}
+
+	if spvBalanceCmd.Parsed() {
+		if *spvBalanceNode == "" {
+			spvBalanceCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.spvBalance(*spvBalanceNode, *spvBalanceAddress)
+	}
+
+	if startNodeCmd.Parsed() {
+		if *startNodePort == 0 {
+			startNodeCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.startNode(*startNodePort, *startNodeSeeds, *startNodeRPCPort, *startNodeRPCConf, *startNodeRESTPort, *startNodeExplorerPort)
 	}
 
 	if versionCmd.Parsed() {
 		cli.version()
 	}
+
+	if walletLockCmd.Parsed() {
+		if *walletLockRPCPort == 0 {
+			walletLockCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.walletLock(*walletLockRPCPort, *walletLockRPCConf)
+	}
+
+	if walletPassphraseCmd.Parsed() {
+		if *walletPassphraseRPCPort == 0 || *walletPassphraseTimeout <= 0 {
+			walletPassphraseCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.walletPassphrase(*walletPassphraseRPCPort, *walletPassphraseRPCConf, *walletPassphraseTimeout)
+	}
 }
 
 func (cli *CLI) printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  createwallet - create a new wallet")
+	fmt.Println("Usage: [-datadir DIR] [-network NETWORK] COMMAND")
+	fmt.Println()
+	fmt.Println("Files are kept in DIR, the current directory by default, for mainnet and in its testnet and regtest directories for the other networks")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  combinemultisig -txs TXS - Merge the signatures of the comma separated copies of a multisig transaction signed by different wallets")
+	fmt.Println("  createblockchain [-address ADDRESS] - Create a blockchain from the genesis block of the network, mining the next block to ADDRESS if given")
+	fmt.Println("  createmultisig -m M -keys KEYS - Add a pay-to-script-hash address needing M signatures of the comma separated KEYS, each a wallet address or a public key in hex")
+	fmt.Println("  createwallet [-mnemonic] [-words N] [-account N] - create a new wallet, derived from the seed if there is one. -mnemonic starts deriving from a new seed of N words in account N")
+	fmt.Println("  encryptwallet - Encrypt the private keys of the wallet with a passphrase read from the standard input")
+	fmt.Println("  explorer [-http ADDR] - Serve web pages for browsing blocks, transactions and addresses on ADDR from a blockchain no node has open")
 	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
-	fmt.Println("  listaddresses - get a list of all created wallet addresses")
-	fmt.Println("  printchain - Print all the blocks of the blockchain")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT - Send AMOUNT of coins from FROM address to TO")
+	fmt.Println("  gettxproof -txid TXID - Print the block header and Merkle proof showing that transaction TXID is in a block")
+	fmt.Println("  history -address ADDRESS - Print the transactions that paid or spent from ADDRESS with a running balance, using the address index")
+	fmt.Println("  listaddresses [-pubkeys] - get a list of all created wallet addresses, with their public keys in hex for createmultisig")
+	fmt.Println("  migratewallet - Rewrite a wallet file holding P-256 keys from before secp256k1 in the current format, keeping the old file as wallet.dat.legacy")
+	fmt.Println("  mine -address ADDRESS [-port PORT] [-seeds ADDRS] [-apihost HOST] [-apiport PORT] [-rpcconf FILE] [-threads N] - Mine blocks paying ADDRESS, serving getblocktemplate and submitblock on the API PORT of HOST, 127.0.0.1 by default, with the credentials in FILE")
+	fmt.Println("  printchain [-from HEIGHT] [-to HEIGHT] - Print all the blocks of the blockchain from the tip, or the blocks between the two heights in order")
+	fmt.Println("  reindex [-txindex] [-addrindex] - Build the transaction index, which makes looking up transactions by ID fast, or the address index used by history. Built indexes are kept up to date from then on")
+	fmt.Println("  restapi [-http ADDR] - Serve the read-only REST API on ADDR from a blockchain no node has open")
+	fmt.Println("  restorewallet [-account N] [-gaplimit N] - Restore the addresses of a seed from its mnemonic, read from the standard input, searching the unspent outputs until N addresses in a row are unused")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-feerate RATE] - Send AMOUNT of coins from FROM address to TO, paying RATE per 1000 bytes in fees")
+	fmt.Println("  sendrawtransaction -tx TX -miner ADDRESS - Mine a block holding the signed transaction TX in hex, paying the block reward to ADDRESS")
+	fmt.Println("  signmultisig -tx TX - Add the signatures of the wallet keys to the multisig transaction TX in hex")
+	fmt.Println("  spendmultisig -from FROM -to TO -amount AMOUNT [-feerate RATE] - Print an unsigned transaction sending AMOUNT from the multisig address FROM to TO, to be signed with signmultisig")
+	fmt.Println("  spvbalance -node NODE [-address ADDRESS] - Sync block headers from NODE and print the balance of ADDRESS or of every wallet address from Merkle proofs, without the full blockchain")
+	fmt.Println("  startnode -port PORT [-seeds ADDRS] [-rpcport PORT] [-rpcconf FILE] [-restport PORT] [-explorerport PORT] - Start a node listening on PORT, connecting to the comma separated ADDRS, optionally serving JSON-RPC with the credentials in FILE, the read-only REST API and the web explorer")
 	fmt.Println("  version - Print version info")
+	fmt.Println("  walletlock -rpcport PORT [-rpcconf FILE] - Lock the encrypted wallet of the node serving JSON-RPC on PORT")
+	fmt.Println("  walletpassphrase -rpcport PORT [-rpcconf FILE] [-timeout SECONDS] - Unlock the encrypted wallet of the node serving JSON-RPC on PORT for SECONDS, reading the passphrase from the standard input")
 }
 
-func (cli *CLI) validateArgs() {
-	if len(os.Args) < 2 {
+// selectNetwork parses the options that come before the command, selecting
+// the network and data directory, and returns the command and its arguments
+func (cli *CLI) selectNetwork() []string {
+	globalCmd := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	globalCmd.Usage = cli.printUsage
+	dataDir := globalCmd.String("datadir", ".", "Directory to keep the blockchain and wallet in")
+	network := globalCmd.String("network", blockchain.MainNetParams.Name, "Network to use: mainnet, testnet or regtest")
+
+	if err := globalCmd.Parse(os.Args[1:]); err != nil {
+		fmt.Printf("Failed to parse arguments")
+		os.Exit(1)
+	}
+
+	args := globalCmd.Args()
+	if len(args) < 1 {
 		cli.printUsage()
 		os.Exit(1)
 	}
+
+	params, err := blockchain.NetParamsByName(*network)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err = blockchain.UseNetwork(params, *dataDir); err != nil {
+		fmt.Printf("Failed to use data directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	return args
 }
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// combineMultiSig merges the signatures of copies of a multisig transaction
+// signed by different wallets
+func (cli *CLI) combineMultiSig(txsHex string) {
+	var txs []*blockchain.Transaction
+	for _, txHex := range strings.Split(txsHex, ",") {
+		txs = append(txs, parseRawTransaction(txHex))
+	}
+
+	tx, err := blockchain.CombineMultiSig(txs)
+	if err != nil {
+		fmt.Printf("Failed to combine transactions: %v\n", err)
+		os.Exit(1)
+	}
+
+	printRawTransaction(tx)
+}
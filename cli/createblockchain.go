@@ -8,21 +8,17 @@ import (
 )
 
 func (cli *CLI) createBlockchain(address string) {
-	bc, err := blockchain.CreateBlockchain(address)
-	if err != nil {
-		fmt.Printf("Failed to create blockchain: %v\n", err)
+	if address != "" && !blockchain.ValidateAddress(address) {
+		fmt.Println("Address is not valid")
 		os.Exit(1)
 	}
-	defer bc.DB.Close()
 
-	UTXOSet := blockchain.UTXOSet{
-		Blockchain: bc,
-	}
-	err = UTXOSet.Reindex()
+	bc, err := blockchain.CreateBlockchain(address)
 	if err != nil {
-		fmt.Printf("Failed to reindex blockchain: %v\n", err)
+		fmt.Printf("Failed to create blockchain: %v\n", err)
 		os.Exit(1)
 	}
+	defer bc.DB.Close()
 
 	fmt.Println("Done!")
 }
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// createMultiSig adds the address of a redeem script needing m signatures
+// of the keys, each a wallet address or a public key in hex
+func (cli *CLI) createMultiSig(m int, keys string) {
+	wallets, err := blockchain.NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Failed to retrieve wallets: %v\n", err)
+		os.Exit(1)
+	}
+
+	var pubKeys [][]byte
+	for _, key := range strings.Split(keys, ",") {
+		if wallet := wallets.GetWallet(key); wallet != nil {
+			pubKeys = append(pubKeys, wallet.PublicKey)
+			continue
+		}
+
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			fmt.Printf("Key %s is neither a wallet address nor a public key in hex\n", key)
+			os.Exit(1)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	address, err := wallets.AddMultiSig(m, pubKeys)
+	if err != nil {
+		fmt.Printf("Failed to create multisig address: %v\n", err)
+		os.Exit(1)
+	}
+	if err = wallets.SaveToFile(); err != nil {
+		fmt.Printf("Failed to save wallets: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Your new multisig address: %s\n", address)
+	fmt.Printf("Redeem script: %x\n", wallets.RedeemScript(address))
+}
@@ -4,11 +4,40 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/tcheard/blockchain/pkg/bip39"
 	"github.com/tcheard/blockchain/pkg/blockchain"
 )
 
-func (cli *CLI) createWallet() {
+func (cli *CLI) createWallet(mnemonic bool, words, account int) {
 	wallets, _ := blockchain.NewWallets()
+	if mnemonic && wallets.HasSeed() {
+		fmt.Println("Wallet already has a seed, new addresses are derived from it")
+		os.Exit(1)
+	}
+	if err := unlockWallets(wallets); err != nil {
+		fmt.Printf("Failed to unlock wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	var sentence string
+	if mnemonic {
+		entropy, err := bip39.NewEntropy(words * 11 * 32 / 33)
+		if err != nil {
+			fmt.Printf("Failed to generate seed: %v\n", err)
+			os.Exit(1)
+		}
+
+		if sentence, err = bip39.NewMnemonic(entropy); err != nil {
+			fmt.Printf("Failed to generate mnemonic: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err = wallets.SetSeed(bip39.NewSeed(sentence, ""), uint32(account)); err != nil {
+			fmt.Printf("Failed to set seed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	address, err := wallets.CreateWallet()
 	if err != nil {
 		fmt.Printf("Failed to create wallet: %v\n", err)
@@ -18,5 +47,9 @@ func (cli *CLI) createWallet() {
 		fmt.Printf("Failed to save wallets: %v\n", err)
 	}
 
+	if mnemonic {
+		fmt.Println("Write down these words, which restore every address of the wallet with restorewallet:")
+		fmt.Println(sentence)
+	}
 	fmt.Printf("Your new address: %s\n", address)
 }
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// stdin is shared by every prompt, so that lines buffered by one prompt are
+// not lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+func (cli *CLI) encryptWallet() {
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		fmt.Printf("Failed to retrieve wallets: %v\n", err)
+		os.Exit(1)
+	}
+	if wallets.IsEncrypted() {
+		fmt.Println("Wallet is already encrypted")
+		os.Exit(1)
+	}
+
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		fmt.Printf("Failed to read passphrase: %v\n", err)
+		os.Exit(1)
+	}
+	repeated, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		fmt.Printf("Failed to read passphrase: %v\n", err)
+		os.Exit(1)
+	}
+	if !bytes.Equal(passphrase, repeated) {
+		fmt.Println("Passphrases do not match")
+		os.Exit(1)
+	}
+
+	if err = wallets.Encrypt(passphrase); err != nil {
+		fmt.Printf("Failed to encrypt wallet: %v\n", err)
+		os.Exit(1)
+	}
+	if err = wallets.SaveToFile(); err != nil {
+		fmt.Printf("Failed to save wallets: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Wallet encrypted, sending now asks for the passphrase")
+}
+
+// readPassphrase prompts for a passphrase and reads it from the terminal
+// without echoing it, or from a line of the standard input when it is not a
+// terminal
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Print(prompt)
+
+	if passphrase, ok, err := readTerminalPassphrase(); ok {
+		return passphrase, err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// unlockWallets asks for the passphrase of encrypted wallets and unlocks them
+// until the command exits
+func unlockWallets(wallets *blockchain.Wallets) error {
+	if !wallets.IsEncrypted() {
+		return nil
+	}
+
+	passphrase, err := readPassphrase("Wallet passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	return wallets.Unlock(passphrase, 0)
+}
@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/explorer"
+)
+
+func (cli *CLI) explorer(addr string) {
+	bc := openBlockchainReadOnly("serve the explorer from it with startnode -explorerport")
+	defer bc.DB.Close()
+
+	fmt.Printf("Explorer listening on %s\n", addr)
+	if err := http.ListenAndServe(addr, explorer.NewExplorer(bc).Handler()); err != nil {
+		fmt.Printf("Failed to serve explorer: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"os"
 
 	"github.com/tcheard/blockchain/pkg/blockchain"
-	"github.com/tcheard/blockchain/pkg/util"
 )
 
 func (cli *CLI) getBalance(address string) {
@@ -26,16 +25,19 @@ func (cli *CLI) getBalance(address string) {
 	}
 
 	balance := 0
-	pubKeyHash := util.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs, err := UTXOSet.FindUTXO(pubKeyHash)
+	script, err := blockchain.PayToAddressScript(address)
+	if err != nil {
+		fmt.Printf("Address is not valid: %v\n", err)
+		os.Exit(1)
+	}
+	UTXOs, err := UTXOSet.FindUTXO(script)
 	if err != nil {
 		fmt.Printf("Failed to find unspent transaction outputs: %v\n", err)
 		os.Exit(1)
 	}
 
-	for _, out := range UTXOs {
-		balance += out.Value
+	for _, utxo := range UTXOs {
+		balance += utxo.Entry.Value
 	}
 
 	fmt.Printf("Balance for '%s': %d\n", address, balance)
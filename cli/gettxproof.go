@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// getTxProof prints what a third party needs to check that a transaction is
+// in a block: the block header, which holds the Merkle root, and the path
+// from the transaction ID to that root
+func (cli *CLI) getTxProof(txid string) {
+	ID, err := hex.DecodeString(txid)
+	if err != nil {
+		fmt.Printf("Transaction ID is not valid hex: %v\n", err)
+		os.Exit(1)
+	}
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	block, index, err := bc.FindTransactionBlock(ID)
+	if err != nil {
+		fmt.Printf("Failed to find transaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	proof, err := block.MerkleTree().Proof(index)
+	if err != nil {
+		fmt.Printf("Failed to build proof: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Transaction: %x\n", ID)
+	fmt.Printf("Block: %x\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Header: %x\n", block.BlockHeader.Serialize())
+	fmt.Printf("Merkle root: %x\n", block.MerkleRoot)
+	fmt.Printf("Index: %d\n", proof.Index)
+	fmt.Printf("Siblings:\n")
+	for _, sibling := range proof.Siblings {
+		fmt.Printf("  %x\n", sibling)
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+func (cli *CLI) history(address string) {
+	if !blockchain.ValidateAddress(address) {
+		fmt.Printf("Address is not valid")
+		os.Exit(1)
+	}
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	script, err := blockchain.PayToAddressScript(address)
+	if err != nil {
+		fmt.Printf("Address is not valid: %v\n", err)
+		os.Exit(1)
+	}
+	history, err := bc.AddressHistory(script)
+	if err != nil {
+		fmt.Printf("Failed to get history: %v\n", err)
+		os.Exit(1)
+	}
+
+	best, err := bc.GetBestHeight()
+	if err != nil {
+		fmt.Printf("Failed to get best height: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("History for '%s':\n", address)
+
+	balance := 0
+	for _, entry := range history {
+		direction := "received"
+		if entry.Delta < 0 {
+			direction = "sent"
+		}
+
+		balance += entry.Delta
+		fmt.Printf("%x %-8s %+d, %d confirmations, balance %d\n", entry.Txid, direction, entry.Delta, best-entry.Height+1, balance)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/tcheard/blockchain/pkg/blockchain"
 )
 
-func (cli *CLI) listAddresses() {
+func (cli *CLI) listAddresses(pubKeys bool) {
 	wallets, err := blockchain.NewWallets()
 	if err != nil {
 		fmt.Printf("Failed to retrieve wallets: %v\n", err)
@@ -14,6 +14,11 @@ func (cli *CLI) listAddresses() {
 
 	addresses := wallets.GetAddresses()
 	for _, address := range addresses {
+		if pubKeys {
+			fmt.Printf("%s %x\n", address, wallets.GetWallet(address).PublicKey)
+			continue
+		}
+
 		fmt.Println(address)
 	}
 }
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+func (cli *CLI) migrateWallet() {
+	legacy, err := blockchain.MigrateWalletFile()
+	if err != nil {
+		fmt.Printf("Failed to migrate wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	if legacy == 0 {
+		fmt.Println("Wallet is already in the current format")
+		return
+	}
+
+	fmt.Printf("Migrated %d legacy keys, the old wallet file is kept as %s\n", legacy, blockchain.DataPath("wallet.dat.legacy"))
+	fmt.Println("It holds the private keys as they were before migrating, so delete it once the migrated wallet works. The wallet cannot be encrypted until it is deleted")
+}
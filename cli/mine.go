@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/mining"
+	"github.com/tcheard/blockchain/pkg/p2p"
+	"github.com/tcheard/blockchain/pkg/rpc"
+)
+
+func (cli *CLI) mine(address string, port int, seeds string, apiHost string, apiPort int, rpcConf string, threads int) {
+	if !blockchain.ValidateAddress(address) {
+		fmt.Println("Address is not valid")
+		os.Exit(1)
+	}
+
+	// The API hands out the reward address and accepts blocks, so it needs
+	// the same credentials as JSON-RPC
+	var rpcCfg *rpc.Config
+	if apiPort != 0 {
+		if rpcConf == "" {
+			rpcConf = blockchain.DataPath(rpc.DefaultConfigFile)
+		}
+
+		var err error
+		if rpcCfg, err = rpc.LoadConfig(rpcConf); err != nil {
+			fmt.Printf("Failed to load RPC config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	mempool := blockchain.NewMempool(bc)
+	bc.Subscribe(mempool)
+
+	var seedAddrs []string
+	if seeds != "" {
+		seedAddrs = strings.Split(seeds, ",")
+	}
+
+	listenAddr := ""
+	if port != 0 {
+		listenAddr = fmt.Sprintf(":%d", port)
+	}
+
+	server := p2p.NewServer(bc, mempool, p2p.Config{
+		ListenAddr: listenAddr,
+		Seeds:      seedAddrs,
+		Logger:     logger,
+	})
+
+	miner := &blockchain.Miner{
+		Workers: threads,
+		HashRate: func(hashesPerSecond float64) {
+			logger.Printf("Hashing at %.0f H/s", hashesPerSecond)
+		},
+	}
+
+	generator := mining.NewGenerator(bc, server, mining.Config{
+		Address: address,
+		Miner:   miner,
+		Logger:  logger,
+	})
+
+	if err = server.Start(); err != nil {
+		fmt.Printf("Failed to start node: %v\n", err)
+		os.Exit(1)
+	}
+	if addr := server.Addr(); addr != nil {
+		fmt.Printf("Node listening on %s\n", addr)
+	}
+
+	if rpcCfg != nil {
+		listener, err := net.Listen("tcp", net.JoinHostPort(apiHost, strconv.Itoa(apiPort)))
+		if err != nil {
+			fmt.Printf("Failed to start mining API: %v\n", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+
+		go http.Serve(listener, rpc.RequireAuth(*rpcCfg, generator.Handler()))
+		fmt.Printf("Mining API listening on %s\n", listener.Addr())
+	}
+
+	generator.Start()
+	fmt.Printf("Mining to %s\n", address)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	fmt.Println("Shutting down...")
+	generator.Stop()
+	server.Stop()
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package cli
+
+// readTerminalPassphrase reports false, as echo cannot be turned off on this
+// platform, so that passphrases are read as lines of the standard input
+func readTerminalPassphrase() ([]byte, bool, error) {
+	return nil, false, nil
+}
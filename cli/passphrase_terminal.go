@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// readTerminalPassphrase reads a passphrase from the standard input without
+// echoing it when the standard input is a terminal, and reports false
+// without reading anything when it is not
+func readTerminalPassphrase() ([]byte, bool, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, false, nil
+	}
+
+	passphrase, err := terminal.ReadPassword(fd)
+	// The newline typed after the passphrase is not echoed either
+	fmt.Println()
+
+	return passphrase, true, err
+}
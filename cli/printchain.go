@@ -8,7 +8,9 @@ import (
 	"github.com/tcheard/blockchain/pkg/blockchain"
 )
 
-func (cli *CLI) printChain() {
+// printChain prints every block from the tip back to genesis, or the blocks
+// from height from to height to in order when either is set
+func (cli *CLI) printChain(from, to int) {
 	bc, err := blockchain.NewBlockchain()
 	if err != nil {
 		fmt.Printf("Failed to get blockchain: %v\n", err)
@@ -16,6 +18,38 @@ func (cli *CLI) printChain() {
 	}
 	defer bc.DB.Close()
 
+	if from < 0 && to < 0 {
+		printBackward(bc)
+		return
+	}
+
+	if from < 0 {
+		from = 0
+	}
+	if to < 0 {
+		if to, err = bc.GetBestHeight(); err != nil {
+			fmt.Printf("Failed to get best height: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	bci := bc.ForwardIterator(from)
+
+	for height := from; height <= to; height++ {
+		block, err := bci.Next()
+		if err != nil {
+			fmt.Printf("Failed to retrieve block %d: %v\n", height, err)
+			os.Exit(1)
+		}
+		if block == nil {
+			break
+		}
+
+		printBlock(block)
+	}
+}
+
+func printBackward(bc *blockchain.Blockchain) {
 	bci := bc.Iterator()
 
 	for {
@@ -25,17 +59,25 @@ func (cli *CLI) printChain() {
 			os.Exit(1)
 		}
 
-		fmt.Printf("============ Block %x ============\n", block.Hash)
-		fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
-		pow := blockchain.NewProofOfWork(block)
-		fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
-		}
-		fmt.Printf("\n\n")
+		printBlock(block)
 
 		if len(block.PrevBlockHash) == 0 {
 			break
 		}
 	}
 }
+
+func printBlock(block *blockchain.Block) {
+	fmt.Printf("============ Block %x ============\n", block.Hash)
+	fmt.Printf("Version: %d\n", block.Version)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
+	fmt.Printf("Merkle root: %x\n", block.MerkleRoot)
+	fmt.Printf("Bits: %08x\n", block.Bits)
+	pow := blockchain.NewProofOfWork(block)
+	fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+	fmt.Printf("\n\n")
+}
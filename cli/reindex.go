@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+func (cli *CLI) reindex(txIndex, addrIndex bool) {
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	if txIndex {
+		if err = bc.ReindexTransactions(); err != nil {
+			fmt.Printf("Failed to build transaction index: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Transaction index built")
+	}
+
+	if addrIndex {
+		if err = bc.ReindexAddresses(); err != nil {
+			fmt.Printf("Failed to build address index: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Address index built")
+	}
+}
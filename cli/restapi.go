@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/rest"
+)
+
+func (cli *CLI) restAPI(addr string) {
+	bc := openBlockchainReadOnly("serve the API from the node with startnode -restport instead")
+	defer bc.DB.Close()
+
+	fmt.Printf("REST API listening on %s\n", addr)
+	if err := http.ListenAndServe(addr, rest.NewAPI(bc).Handler()); err != nil {
+		fmt.Printf("Failed to serve REST API: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// openBlockchainReadOnly opens the blockchain for a command that only reads
+// it, exiting with advice if a node has it open
+func openBlockchainReadOnly(advice string) *blockchain.Blockchain {
+	bc, err := blockchain.OpenBlockchainReadOnly(time.Second)
+	if err == blockchain.ErrDatabaseLocked {
+		fmt.Printf("Failed to open blockchain: it is in use by a node, %s\n", advice)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Failed to open blockchain: %v\n", err)
+		os.Exit(1)
+	}
+
+	return bc
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/bip39"
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+func (cli *CLI) restoreWallet(account, gapLimit int) {
+	wallets, _ := blockchain.NewWallets()
+	if wallets.HasSeed() {
+		fmt.Println("Wallet already has a seed, restore into another data directory")
+		os.Exit(1)
+	}
+
+	sentence, err := readPassphrase("Mnemonic: ")
+	if err != nil {
+		fmt.Printf("Failed to read mnemonic: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err = bip39.EntropyFromMnemonic(string(sentence)); err != nil {
+		fmt.Printf("Mnemonic is not valid: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err = unlockWallets(wallets); err != nil {
+		fmt.Printf("Failed to unlock wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err = wallets.SetSeed(bip39.NewSeed(string(sentence), ""), uint32(account)); err != nil {
+		fmt.Printf("Failed to set seed: %v\n", err)
+		os.Exit(1)
+	}
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	UTXOSet := blockchain.UTXOSet{
+		Blockchain: bc,
+	}
+
+	found, err := wallets.RestoreAddresses(&UTXOSet, gapLimit)
+	if err != nil {
+		fmt.Printf("Failed to restore addresses: %v\n", err)
+		os.Exit(1)
+	}
+
+	// A wallet that was never paid still needs an address to be paid to
+	if found == 0 {
+		if _, err = wallets.CreateWallet(); err != nil {
+			fmt.Printf("Failed to create wallet: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err = wallets.SaveToFile(); err != nil {
+		fmt.Printf("Failed to save wallets: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Restored %d addresses with unspent outputs\n", found)
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/tcheard/blockchain/pkg/blockchain"
 )
 
-func (cli *CLI) send(from, to string, amount int) {
+func (cli *CLI) send(from, to string, amount, feeRate int) {
 	if !blockchain.ValidateAddress(from) {
 		fmt.Printf("Address is not valid")
 		os.Exit(1)
@@ -28,23 +28,49 @@ func (cli *CLI) send(from, to string, amount int) {
 		Blockchain: bc,
 	}
 
-	tx, err := blockchain.NewUTXOTransaction(from, to, amount, &UTXOSet)
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		fmt.Printf("Failed to retrieve wallets: %v\n", err)
+		os.Exit(1)
+	}
+	if wallets.GetWallet(from) == nil {
+		fmt.Printf("Address %s is not in the wallet\n", from)
+		os.Exit(1)
+	}
+	if err = unlockWallets(wallets); err != nil {
+		fmt.Printf("Failed to unlock wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := blockchain.NewUTXOTransaction(wallets, from, to, amount, feeRate, &UTXOSet)
 	if err != nil {
 		fmt.Printf("Failed to create UTXO transaction: %v\n", err)
 		os.Exit(1)
 	}
-	cb, err := blockchain.NewCoinbaseTransaction(from, "") // For simplicity make the sender the miner
+	if wallets.HasSeed() {
+		if err = wallets.SaveToFile(); err != nil {
+			fmt.Printf("Failed to save wallets: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	mempool := blockchain.NewMempool(bc)
+	if err = mempool.Add(tx); err != nil {
+		fmt.Printf("Failed to add transaction to the mempool: %v\n", err)
+		os.Exit(1)
+	}
+
+	txs, fees := mempool.BlockTransactions(blockchain.MaxBlockSize)
+	cb, err := blockchain.NewCoinbaseTransaction(from, "", fees) // For simplicity make the sender the miner
 	if err != nil {
 		fmt.Printf("Failed to create coinbase transaction: %v\n", err)
+		os.Exit(1)
 	}
 
-	newBlock, err := bc.MineBlock([]*blockchain.Transaction{tx, cb})
-	if err != nil {
+	if _, err = bc.MineBlock(append([]*blockchain.Transaction{cb}, txs...)); err != nil {
 		fmt.Printf("Failed to mine block: %v\n", err)
 		os.Exit(1)
 	}
 
-	UTXOSet.Update(newBlock)
-
 	fmt.Println("Success!")
 }
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// sendRawTransaction mines a block holding a signed transaction given in
+// hex, paying the block reward to miner
+func (cli *CLI) sendRawTransaction(txHex, miner string) {
+	if !blockchain.ValidateAddress(miner) {
+		fmt.Printf("Address is not valid")
+		os.Exit(1)
+	}
+
+	tx := parseRawTransaction(txHex)
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	mempool := blockchain.NewMempool(bc)
+	if err = mempool.Add(tx); err != nil {
+		fmt.Printf("Failed to add transaction to the mempool: %v\n", err)
+		os.Exit(1)
+	}
+
+	txs, fees := mempool.BlockTransactions(blockchain.MaxBlockSize)
+	cb, err := blockchain.NewCoinbaseTransaction(miner, "", fees)
+	if err != nil {
+		fmt.Printf("Failed to create coinbase transaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err = bc.MineBlock(append([]*blockchain.Transaction{cb}, txs...)); err != nil {
+		fmt.Printf("Failed to mine block: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Sent transaction %x\n", tx.ID)
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// signMultiSig adds the signatures of the wallet keys to a multisig
+// transaction made by spendmultisig
+func (cli *CLI) signMultiSig(txHex string) {
+	tx := parseRawTransaction(txHex)
+
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		fmt.Printf("Failed to retrieve wallets: %v\n", err)
+		os.Exit(1)
+	}
+	if err = unlockWallets(wallets); err != nil {
+		fmt.Printf("Failed to unlock wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	signed, err := wallets.SignMultiSig(tx)
+	if err != nil {
+		fmt.Printf("Failed to sign transaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Signatures added: %d\n", signed)
+	printRawTransaction(tx)
+}
+
+// parseRawTransaction decodes a transaction in hex, as printed by
+// printRawTransaction
+func parseRawTransaction(txHex string) *blockchain.Transaction {
+	data, err := hex.DecodeString(txHex)
+	if err != nil {
+		fmt.Printf("Transaction is not valid hex: %v\n", err)
+		os.Exit(1)
+	}
+
+	tx, err := blockchain.DeserializeTransaction(data)
+	if err != nil {
+		fmt.Printf("Failed to decode transaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	return tx
+}
+
+// printRawTransaction prints a multisig transaction in hex and whether it
+// has enough signatures to be sent
+func printRawTransaction(tx *blockchain.Transaction) {
+	complete, err := tx.IsMultiSigComplete()
+	if err != nil {
+		fmt.Printf("Failed to check signatures: %v\n", err)
+		os.Exit(1)
+	}
+
+	ser, err := tx.Serialize()
+	if err != nil {
+		fmt.Printf("Failed to serialize transaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Complete: %t\n", complete)
+	fmt.Printf("Transaction: %x\n", ser)
+}
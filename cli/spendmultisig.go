@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// spendMultiSig prints an unsigned transaction paying from a multisig
+// address of the wallet, to be signed with signmultisig
+func (cli *CLI) spendMultiSig(from, to string, amount, feeRate int) {
+	if !blockchain.ValidateAddress(to) {
+		fmt.Printf("Address is not valid")
+		os.Exit(1)
+	}
+
+	wallets, err := blockchain.NewWallets()
+	if err != nil {
+		fmt.Printf("Failed to retrieve wallets: %v\n", err)
+		os.Exit(1)
+	}
+	redeemScript := wallets.RedeemScript(from)
+	if redeemScript == nil {
+		fmt.Printf("Multisig address %s is not in the wallet, add it with createmultisig\n", from)
+		os.Exit(1)
+	}
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	UTXOSet := blockchain.UTXOSet{
+		Blockchain: bc,
+	}
+
+	tx, err := blockchain.NewMultiSigTransaction(redeemScript, to, amount, feeRate, &UTXOSet)
+	if err != nil {
+		fmt.Printf("Failed to create multisig transaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	printRawTransaction(tx)
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/spv"
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+// spvBalance syncs block headers from a node and prints balances computed
+// from Merkle proofs, without opening the full blockchain
+func (cli *CLI) spvBalance(node, address string) {
+	var addresses []string
+	if address != "" {
+		if !blockchain.ValidateAddress(address) {
+			fmt.Printf("Address is not valid")
+			os.Exit(1)
+		}
+		addresses = []string{address}
+	} else {
+		wallets, err := blockchain.NewWallets()
+		if err != nil {
+			fmt.Printf("Failed to retrieve wallets: %v\n", err)
+			os.Exit(1)
+		}
+		addresses = wallets.GetAddresses()
+	}
+
+	if len(addresses) == 0 {
+		fmt.Println("No addresses to check, create a wallet first")
+		os.Exit(1)
+	}
+
+	var pubKeyHashes [][]byte
+	for _, addr := range addresses {
+		pubKeyHash := util.Base58Decode([]byte(addr))
+		pubKeyHashes = append(pubKeyHashes, pubKeyHash[1:len(pubKeyHash)-4])
+	}
+
+	store, err := spv.OpenHeaderStore(blockchain.DataPath(spv.DefaultHeadersFile))
+	if err != nil {
+		fmt.Printf("Failed to open header store: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	client, err := spv.Dial(node, blockchain.ActiveNetwork().Magic, store)
+	if err != nil {
+		fmt.Printf("Failed to connect to node: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	count, err := client.SyncHeaders()
+	if err != nil {
+		fmt.Printf("Failed to sync headers: %v\n", err)
+		os.Exit(1)
+	}
+
+	tip, err := store.Tip()
+	if err != nil || tip == nil {
+		fmt.Printf("Failed to get best header: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Synced %d new headers, best block %x at height %d\n", count, tip.Hash(), tip.Height)
+
+	txs, err := client.FetchTransactions(pubKeyHashes)
+	if err != nil {
+		fmt.Printf("Failed to fetch transactions: %v\n", err)
+		os.Exit(1)
+	}
+
+	for i, addr := range addresses {
+		fmt.Printf("Balance for '%s': %d\n", addr, spv.Balance(txs, pubKeyHashes[i]))
+	}
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/explorer"
+	"github.com/tcheard/blockchain/pkg/p2p"
+	"github.com/tcheard/blockchain/pkg/rest"
+	"github.com/tcheard/blockchain/pkg/rpc"
+)
+
+func (cli *CLI) startNode(port int, seeds string, rpcPort int, rpcConf string, restPort, explorerPort int) {
+	var rpcCfg *rpc.Config
+	if rpcPort != 0 {
+		if rpcConf == "" {
+			rpcConf = blockchain.DataPath(rpc.DefaultConfigFile)
+		}
+
+		var err error
+		if rpcCfg, err = rpc.LoadConfig(rpcConf); err != nil {
+			fmt.Printf("Failed to load RPC config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		fmt.Printf("Failed to get blockchain: %v\n", err)
+		os.Exit(1)
+	}
+	defer bc.DB.Close()
+
+	var seedAddrs []string
+	if seeds != "" {
+		seedAddrs = strings.Split(seeds, ",")
+	}
+
+	mempool := blockchain.NewMempool(bc)
+	bc.Subscribe(mempool)
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	server := p2p.NewServer(bc, mempool, p2p.Config{
+		ListenAddr: fmt.Sprintf(":%d", port),
+		Seeds:      seedAddrs,
+		Logger:     logger,
+	})
+	if err = server.Start(); err != nil {
+		fmt.Printf("Failed to start node: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Node listening on %s\n", server.Addr())
+
+	if rpcCfg != nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", rpcPort))
+		if err != nil {
+			fmt.Printf("Failed to start JSON-RPC server: %v\n", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+
+		go http.Serve(listener, rpc.NewServer(bc, mempool, server, *rpcCfg, logger))
+		fmt.Printf("JSON-RPC listening on %s\n", listener.Addr())
+	}
+
+	if restPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", restPort))
+		if err != nil {
+			fmt.Printf("Failed to start REST API: %v\n", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+
+		go http.Serve(listener, rest.NewAPI(bc).Handler())
+		fmt.Printf("REST API listening on %s\n", listener.Addr())
+	}
+
+	if explorerPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", explorerPort))
+		if err != nil {
+			fmt.Printf("Failed to start explorer: %v\n", err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+
+		go http.Serve(listener, explorer.NewExplorer(bc).Handler())
+		fmt.Printf("Explorer listening on %s\n", listener.Addr())
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	fmt.Println("Shutting down...")
+	server.Stop()
+}
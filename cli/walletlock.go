@@ -0,0 +1,15 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) walletLock(rpcPort int, rpcConf string) {
+	if err := nodeClient(rpcPort, rpcConf).Call("walletlock", nil, nil); err != nil {
+		fmt.Printf("Failed to lock wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Wallet locked")
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/rpc"
+)
+
+func (cli *CLI) walletPassphrase(rpcPort int, rpcConf string, timeout int) {
+	client := nodeClient(rpcPort, rpcConf)
+
+	passphrase, err := readPassphrase("Wallet passphrase: ")
+	if err != nil {
+		fmt.Printf("Failed to read passphrase: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err = client.Call("walletpassphrase", []interface{}{string(passphrase), timeout}, nil); err != nil {
+		fmt.Printf("Failed to unlock wallet: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wallet unlocked for %d seconds\n", timeout)
+}
+
+// nodeClient returns a client for the JSON-RPC server of the local node on
+// rpcPort, with the credentials in rpcConf or the default config file
+func nodeClient(rpcPort int, rpcConf string) *rpc.Client {
+	if rpcConf == "" {
+		rpcConf = blockchain.DataPath(rpc.DefaultConfigFile)
+	}
+
+	cfg, err := rpc.LoadConfig(rpcConf)
+	if err != nil {
+		fmt.Printf("Failed to load RPC config: %v\n", err)
+		os.Exit(1)
+	}
+
+	return rpc.NewClient(fmt.Sprintf("localhost:%d", rpcPort), *cfg)
+}
@@ -0,0 +1,164 @@
+// Package bip39 turns entropy into mnemonic sentences that can be written
+// down and back, and derives wallet seeds from them, as described by BIP39.
+// Only the English wordlist is supported, so sentences are not normalized
+package bip39
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// seedIterations is the number of PBKDF2 rounds a seed is derived with
+const seedIterations = 2048
+
+var (
+	wordList  = strings.Split(strings.TrimSpace(englishWords), "\n")
+	wordIndex = make(map[string]int, len(wordList))
+)
+
+func init() {
+	for i, word := range wordList {
+		wordIndex[word] = i
+	}
+}
+
+// ErrChecksum is returned for a sentence whose words are all in the
+// wordlist but whose checksum does not match, usually from a typo
+var ErrChecksum = errors.New("mnemonic checksum does not match")
+
+// NewEntropy returns bitSize random bits, which must be a multiple of 32
+// from 128 to 256
+func NewEntropy(bitSize int) ([]byte, error) {
+	if err := checkEntropySize(bitSize); err != nil {
+		return nil, err
+	}
+
+	entropy := make([]byte, bitSize/8)
+	if _, err := io.ReadFull(rand.Reader, entropy); err != nil {
+		return nil, err
+	}
+
+	return entropy, nil
+}
+
+// NewMnemonic returns the sentence encoding entropy: 12 words for 128 bits
+// up to 24 words for 256 bits. Each word holds 11 bits of the entropy
+// followed by the first bits of its SHA-256 hash as a checksum
+func NewMnemonic(entropy []byte) (string, error) {
+	bitSize := len(entropy) * 8
+	if err := checkEntropySize(bitSize); err != nil {
+		return "", err
+	}
+
+	checksumSize := bitSize / 32
+	hash := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(checksumSize))
+	data.Or(data, big.NewInt(int64(hash[0]>>uint(8-checksumSize))))
+
+	words := make([]string, (bitSize+checksumSize)/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		index := new(big.Int).And(data, mask)
+		words[i] = wordList[index.Int64()]
+		data.Rsh(data, 11)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// EntropyFromMnemonic returns the entropy a sentence encodes, checking its
+// words and checksum
+func EntropyFromMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, fmt.Errorf("mnemonic has %d words, expected 12, 15, 18, 21 or 24", len(words))
+	}
+
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("%q is not in the wordlist", word)
+		}
+
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+
+	checksumSize := len(words) * 11 / 33
+	bitSize := len(words)*11 - checksumSize
+
+	checksum := new(big.Int).And(data, big.NewInt(1<<uint(checksumSize)-1))
+	data.Rsh(data, uint(checksumSize))
+
+	entropy := make([]byte, bitSize/8)
+	b := data.Bytes()
+	copy(entropy[len(entropy)-len(b):], b)
+
+	hash := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(hash[0]>>uint(8-checksumSize)) {
+		return nil, ErrChecksum
+	}
+
+	return entropy, nil
+}
+
+// NewSeed derives the 64 byte wallet seed of a sentence, which must have
+// been checked with EntropyFromMnemonic. The passphrase, which may be empty,
+// protects the seed should the sentence be found
+func NewSeed(mnemonic, passphrase string) []byte {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+
+	return pbkdf2(sha512.New, []byte(mnemonic), []byte("mnemonic"+passphrase), seedIterations, 64)
+}
+
+func checkEntropySize(bitSize int) error {
+	if bitSize%32 != 0 || bitSize < 128 || bitSize > 256 {
+		return fmt.Errorf("entropy of %d bits is not a multiple of 32 from 128 to 256", bitSize)
+	}
+
+	return nil
+}
+
+// pbkdf2 is PBKDF2 from RFC 8018 with HMAC as the pseudorandom function
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	key := make([]byte, 0, keyLen+prf.Size())
+
+	var counter [4]byte
+	u := make([]byte, prf.Size())
+	t := make([]byte, prf.Size())
+	for block := uint32(1); len(key) < keyLen; block++ {
+		binary.BigEndian.PutUint32(counter[:], block)
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
@@ -0,0 +1,108 @@
+package bip39
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Vectors from the BIP39 reference implementation, whose seeds are derived
+// with the passphrase "TREZOR"
+var vectors = []struct {
+	entropy, mnemonic, seed string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"80808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+		"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+	},
+	{
+		"ffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		"9e885d952ad362caeb4efe34a8e91bd2",
+		"ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+		"274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+		"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		entropy, err := hex.DecodeString(v.entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mnemonic, err := NewMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("NewMnemonic(%s): %v", v.entropy, err)
+		}
+		if mnemonic != v.mnemonic {
+			t.Errorf("NewMnemonic(%s) = %q, want %q", v.entropy, mnemonic, v.mnemonic)
+		}
+
+		decoded, err := EntropyFromMnemonic(v.mnemonic)
+		if err != nil {
+			t.Fatalf("EntropyFromMnemonic(%q): %v", v.mnemonic, err)
+		}
+		if hex.EncodeToString(decoded) != v.entropy {
+			t.Errorf("EntropyFromMnemonic(%q) = %x, want %s", v.mnemonic, decoded, v.entropy)
+		}
+
+		if seed := hex.EncodeToString(NewSeed(v.mnemonic, "TREZOR")); seed != v.seed {
+			t.Errorf("NewSeed(%q) = %s, want %s", v.mnemonic, seed, v.seed)
+		}
+	}
+}
+
+func TestEntropyFromMnemonicRejectsBadSentences(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		err      error
+	}{
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", ErrChecksum},
+		{"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo", ErrChecksum},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", nil},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandonn", nil},
+	}
+
+	for _, test := range tests {
+		_, err := EntropyFromMnemonic(test.mnemonic)
+		if err == nil {
+			t.Errorf("EntropyFromMnemonic(%q) did not fail", test.mnemonic)
+		} else if test.err != nil && err != test.err {
+			t.Errorf("EntropyFromMnemonic(%q) = %v, want %v", test.mnemonic, err, test.err)
+		}
+	}
+}
+
+func TestNewSeedNormalizesSpaces(t *testing.T) {
+	v := vectors[0]
+	spaced := "  " + strings.Replace(v.mnemonic, " ", "   ", -1) + "\n"
+
+	if seed := hex.EncodeToString(NewSeed(spaced, "TREZOR")); seed != v.seed {
+		t.Errorf("NewSeed with extra spaces = %s, want %s", seed, v.seed)
+	}
+}
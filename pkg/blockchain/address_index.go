@@ -0,0 +1,267 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+// addressIndexBucket records every transaction on the best chain that pays
+// or spends from a public key hash or script hash. Keys are the hash
+// followed by the big endian height and position of the transaction, so the
+// history of an address is a single ordered range. Like the transaction index it is
+// only kept once built with ReindexAddresses
+const addressIndexBucket = "addrindex"
+
+// AddressTx is a transaction in the history of an address. Delta is what the
+// transaction paid to the address less what it spent from it
+type AddressTx struct {
+	Txid   []byte
+	Height int
+	Delta  int
+}
+
+// addressDelta is the change a transaction makes to the balance of one
+// public key hash or script hash
+type addressDelta struct {
+	Hash     []byte
+	Position int
+	Txid     []byte
+	Delta    int
+}
+
+func (d addressDelta) key(height int) []byte {
+	key := make([]byte, len(d.Hash)+8)
+	copy(key, d.Hash)
+	binary.BigEndian.PutUint32(key[len(d.Hash):], uint32(height))
+	binary.BigEndian.PutUint32(key[len(d.Hash)+4:], uint32(d.Position))
+
+	return key
+}
+
+func (d addressDelta) serialize() []byte {
+	w := &util.Writer{}
+
+	w.WriteFixed(d.Txid, sha256.Size)
+	w.WriteUint64(uint64(d.Delta))
+
+	return w.Bytes()
+}
+
+// addressDeltas works out how each transaction of a block changes the
+// balances of the public key hashes it touches. The values of the outputs
+// spent come from the undo data of the block, which lists them in the order
+// of the inputs
+func addressDeltas(block *Block, undo *blockUndo) ([]addressDelta, error) {
+	var deltas []addressDelta
+	spent := 0
+
+	for i, tx := range block.Transactions {
+		var order []string
+		changes := make(map[string]int)
+		add := func(script []byte, value int) {
+			// Outputs with other scripts belong to no address
+			hash := addressHash(script)
+			if hash == nil {
+				return
+			}
+
+			k := string(hash)
+			if _, ok := changes[k]; !ok {
+				order = append(order, k)
+			}
+			changes[k] += value
+		}
+
+		if !tx.IsCoinbase() {
+			for range tx.Vin {
+				if spent >= len(undo.Spent) {
+					return nil, errors.Errorf("undo data of block %x is missing spent outputs", block.Hash)
+				}
+				entry := undo.Spent[spent].Entry
+				add(entry.ScriptPubKey, -entry.Value)
+				spent++
+			}
+		}
+
+		for _, out := range tx.Vout {
+			add(out.ScriptPubKey, out.Value)
+		}
+
+		for _, k := range order {
+			deltas = append(deltas, addressDelta{
+				Hash:     []byte(k),
+				Position: i,
+				Txid:     tx.ID,
+				Delta:    changes[k],
+			})
+		}
+	}
+
+	return deltas, nil
+}
+
+// HasAddressIndex reports whether the address index has been built
+func (bc *Blockchain) HasAddressIndex() (bool, error) {
+	found := false
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(addressIndexBucket)) != nil
+
+		return nil
+	})
+
+	return found, err
+}
+
+// ReindexAddresses builds the address index from the blocks of the best
+// chain and their undo data, replacing any existing index. From then on it
+// is updated as blocks are connected and disconnected
+func (bc *Blockchain) ReindexAddresses() error {
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(addressIndexBucket)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(addressIndexBucket)); err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte(blocksBucket))
+		heights := tx.Bucket([]byte(heightIndexBucket))
+
+		c := heights.Cursor()
+		for _, hash := c.First(); hash != nil; _, hash = c.Next() {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+
+			undo, err := getBlockUndo(tx, hash)
+			if err != nil {
+				return err
+			}
+
+			if err = indexAddresses(tx, block, undo); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// AddressHistory returns the transactions on the best chain that paid or
+// spent from the address paid by script, oldest first
+func (bc *Blockchain) AddressHistory(script []byte) ([]AddressTx, error) {
+	var history []AddressTx
+
+	hash := addressHash(script)
+	if hash == nil {
+		return nil, errors.New("script does not pay an address")
+	}
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(addressIndexBucket))
+		if b == nil {
+			return errors.New("the address index has not been built, run reindex -addrindex")
+		}
+
+		return forEachAddressTx(b, hash, func(height, position int, v []byte) error {
+			r := util.NewReader(v)
+			txid := r.ReadFixed(sha256.Size)
+			delta := int(int64(r.ReadUint64()))
+			if err := r.Finish(); err != nil {
+				return errors.Wrap(err, "Failed to decode address index entry")
+			}
+
+			history = append(history, AddressTx{
+				Txid:   txid,
+				Height: height,
+				Delta:  delta,
+			})
+
+			return nil
+		})
+	})
+
+	return history, err
+}
+
+// forEachAddressTx calls fn with the height, position and index entry of
+// each transaction in the history of a hash, oldest first
+func forEachAddressTx(b *bolt.Bucket, hash []byte, fn func(height, position int, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek(hash); k != nil && bytes.HasPrefix(k, hash); k, v = c.Next() {
+		// Longer hashes can share the prefix
+		if len(k) != len(hash)+8 {
+			continue
+		}
+
+		height := int(binary.BigEndian.Uint32(k[len(hash):]))
+		position := int(binary.BigEndian.Uint32(k[len(hash)+4:]))
+		if err := fn(height, position, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexAddresses adds the transactions of a block connected to the best
+// chain to the address index, if there is one
+func indexAddresses(tx *bolt.Tx, block *Block, undo *blockUndo) error {
+	b := tx.Bucket([]byte(addressIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	deltas, err := addressDeltas(block, undo)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deltas {
+		if err = b.Put(d.key(block.Height), d.serialize()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexAddresses removes the transactions of a block disconnected from
+// the best chain from the address index, if there is one
+func unindexAddresses(tx *bolt.Tx, block *Block, undo *blockUndo) error {
+	b := tx.Bucket([]byte(addressIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	deltas, err := addressDeltas(block, undo)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deltas {
+		if err = b.Delete(d.key(block.Height)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addressHash returns the hash the address index keys an output script by,
+// the public key hash or script hash it pays, or nil if it pays no address
+func addressHash(script []byte) []byte {
+	if pubKeyHash := ExtractPubKeyHash(script); pubKeyHash != nil {
+		return pubKeyHash
+	}
+
+	return ExtractScriptHash(script)
+}
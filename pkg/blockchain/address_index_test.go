@@ -0,0 +1,152 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// addressHistory returns the history of an address
+func addressHistory(t *testing.T, bc *Blockchain, address string) []AddressTx {
+	t.Helper()
+
+	script, err := PayToAddressScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := bc.AddressHistory(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return history
+}
+
+func TestAddressIndex(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiSig, err := wallets.AddMultiSig(1, [][]byte{wallets.GetWallet(bob).PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsidy := activeNet.Subsidy
+
+	aliceScript, err := PayToAddressScript(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.AddressHistory(aliceScript); err == nil {
+		t.Fatal("history was returned before the index was built")
+	}
+	if indexed, err := bc.HasAddressIndex(); err != nil || indexed {
+		t.Fatalf("address index exists before reindexing: %v", err)
+	}
+
+	first, err := bc.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payBob := spendOutput(t, wallets, alice, first.Transactions[0], 0, 40, bob)
+	second, err := bc.MineBlock([]*Transaction{coinbase(t, alice, subsidy-40), payBob})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks already on the chain are indexed from their undo data
+	if err = bc.ReindexAddresses(); err != nil {
+		t.Fatal(err)
+	}
+	if indexed, err := bc.HasAddressIndex(); err != nil || !indexed {
+		t.Fatalf("address index is missing after reindexing: %v", err)
+	}
+	checkBalance(t, bc, alice, 3, 2*subsidy-40)
+	checkBalance(t, bc, bob, 1, 40)
+
+	// Alice pays carol with change to herself, which the index records as a
+	// single entry, and bob pays all he has to a script hash address
+	toCarol, err := NewTXOutput(10, carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := NewTXOutput(2*subsidy-50, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payCarol := &Transaction{
+		Vin:  []*TXInput{{Txid: second.Transactions[0].ID, Vout: 0}},
+		Vout: []*TXOutput{toCarol, change},
+	}
+	privKey, err := wallets.PrivateKey(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevTXs := map[string]Transaction{hex.EncodeToString(second.Transactions[0].ID): *second.Transactions[0]}
+	if err = payCarol.Sign(privKey, prevTXs); err != nil {
+		t.Fatal(err)
+	}
+	if err = payCarol.setID(); err != nil {
+		t.Fatal(err)
+	}
+	payMultiSig := spendOutput(t, wallets, bob, payBob, 0, 30, multiSig)
+
+	third, err := bc.MineBlock([]*Transaction{coinbase(t, carol, 10), payCarol, payMultiSig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkBalance(t, bc, alice, 4, 2*subsidy-50)
+	checkBalance(t, bc, bob, 2, 0)
+	checkBalance(t, bc, carol, 2, subsidy+20)
+	checkBalance(t, bc, multiSig, 1, 30)
+
+	want := []AddressTx{
+		{Txid: first.Transactions[0].ID, Height: 1, Delta: subsidy},
+		{Txid: second.Transactions[0].ID, Height: 2, Delta: 2*subsidy - 40},
+		{Txid: payBob.ID, Height: 2, Delta: -subsidy},
+		{Txid: payCarol.ID, Height: 3, Delta: -10},
+	}
+	history := addressHistory(t, bc, alice)
+	for i := range want {
+		if i >= len(history) {
+			break
+		}
+		if !bytes.Equal(history[i].Txid, want[i].Txid) || history[i].Height != want[i].Height || history[i].Delta != want[i].Delta {
+			t.Errorf("entry %d of the history of alice is %x at %d with %d, want %x at %d with %d", i,
+				history[i].Txid, history[i].Height, history[i].Delta, want[i].Txid, want[i].Height, want[i].Delta)
+		}
+	}
+
+	// Rebuilding gives the same index as keeping it up to date
+	var before [][]AddressTx
+	for _, address := range []string{alice, bob, carol, multiSig} {
+		before = append(before, addressHistory(t, bc, address))
+	}
+	if err = bc.ReindexAddresses(); err != nil {
+		t.Fatal(err)
+	}
+	for i, address := range []string{alice, bob, carol, multiSig} {
+		if after := addressHistory(t, bc, address); !reflect.DeepEqual(after, before[i]) {
+			t.Errorf("history of %s changed on reindexing", address)
+		}
+	}
+
+	if err = bc.disconnectBlock(third.Hash); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, bc, alice, 3, 2*subsidy-40)
+	checkBalance(t, bc, bob, 1, 40)
+	checkBalance(t, bc, carol, 0, 0)
+	checkBalance(t, bc, multiSig, 0, 0)
+
+	if _, err = bc.AddressHistory([]byte{OpReturn}); err == nil {
+		t.Error("history of a script paying no address was returned")
+	}
+}
@@ -1,46 +1,60 @@
 package blockchain
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/tcheard/blockchain/pkg/util"
 )
 
-// Block stores the information for a block in the blockchain
+// MaxBlockSize is the largest serialized size of a valid block
+const MaxBlockSize = 1024 * 1024
+
+// Block stores the information for a block in the blockchain: its header,
+// the transactions it contains and the hash of the header
 type Block struct {
-	Timestamp     int64
-	Transactions  []*Transaction
-	PrevBlockHash []byte
-	Hash          []byte
-	Nonce         int64
+	BlockHeader
+	Transactions []*Transaction
+	Hash         []byte
+}
+
+// NewBlock creates a new block at the given height, mining it to the target
+// given in compact bits
+func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int, bits uint32) *Block {
+	return newBlock(transactions, prevBlockHash, height, bits, time.Now().Unix())
 }
 
-// NewBlock creates a new block
-func NewBlock(transactions []*Transaction, prevBlockHash []byte) *Block {
+// newBlock creates and mines a new block with the given timestamp
+func newBlock(transactions []*Transaction, prevBlockHash []byte, height int, bits uint32, timestamp int64) *Block {
 	block := &Block{
-		Timestamp:     time.Now().Unix(),
-		Transactions:  transactions,
-		PrevBlockHash: prevBlockHash,
-		Hash:          []byte{},
+		BlockHeader: BlockHeader{
+			Version:       BlockVersion,
+			Height:        height,
+			PrevBlockHash: prevBlockHash,
+			Timestamp:     timestamp,
+			Bits:          bits,
+		},
+		Transactions: transactions,
+		Hash:         []byte{},
 	}
+	block.MerkleRoot = block.HashTransactions()
 
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	// Mining only fails when its context is cancelled
+	DefaultMiner.Mine(context.Background(), block)
 
 	return block
 }
 
-// NewGenesisBlock creates a Block for the first block in a blockchain
-func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{})
-}
-
 // HashTransactions creates a hash of the transactions in the block
 func (b *Block) HashTransactions() []byte {
+	return b.MerkleTree().RootNode.Data
+}
+
+// MerkleTree builds the Merkle tree of the transactions in the block, whose
+// leaves are the serialized transactions
+func (b *Block) MerkleTree() *MerkleTree {
 	var transactions [][]byte
 
 	for _, tx := range b.Transactions {
@@ -50,33 +64,44 @@ func (b *Block) HashTransactions() []byte {
 		}
 		transactions = append(transactions, ser)
 	}
-	mTree := NewMerkleTree(transactions)
 
-	return mTree.RootNode.Data
+	return NewMerkleTree(transactions)
 }
 
-// Serialize serializes the block using the gob encoding
+// Serialize serializes the block in the canonical encoding described in
+// docs/serialization.md: the header followed by the transactions
 func (b *Block) Serialize() ([]byte, error) {
-	var result bytes.Buffer
+	w := &util.Writer{}
 
-	encoder := gob.NewEncoder(&result)
-	err := encoder.Encode(b)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to encode block")
+	b.BlockHeader.encode(w)
+	w.WriteUint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.encode(w)
 	}
 
-	return result.Bytes(), nil
+	return w.Bytes(), nil
 }
 
-// DeserializeBlock takes a gob encoded byte slice and decodes it into a Block
+// DeserializeBlock decodes a serialized block, computing its hash from the
+// header and the IDs of its transactions
 func DeserializeBlock(d []byte) (*Block, error) {
-	var block Block
+	r := util.NewReader(d)
+
+	header := decodeBlockHeader(r)
+	block := &Block{
+		BlockHeader: *header,
+	}
 
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
-	if err != nil {
+	count := r.ReadCount(minTxSize)
+	for i := 0; i < count; i++ {
+		block.Transactions = append(block.Transactions, decodeTransaction(r))
+	}
+
+	if err := r.Finish(); err != nil {
 		return nil, errors.Wrap(err, "Failed to decode block")
 	}
 
-	return &block, nil
+	block.Hash = block.BlockHeader.Hash()
+
+	return block, nil
 }
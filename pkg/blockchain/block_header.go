@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+const (
+	// BlockVersion is the version of the blocks created by this implementation
+	BlockVersion = 1
+
+	// BlockHeaderSize is the size of a serialized block header
+	BlockHeaderSize = 4 + 4 + sha256.Size + sha256.Size + 8 + 4 + 8
+)
+
+// BlockHeader holds the fields of a block that are hashed by the proof of
+// work. The transactions are committed to through the Merkle root, so the
+// header stays the same size however many transactions a block holds
+type BlockHeader struct {
+	Version       int32
+	Height        int
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Timestamp     int64
+	Bits          uint32
+	Nonce         int64
+}
+
+// Serialize encodes the header into its fixed size form. The previous block
+// hash of a genesis block is encoded as zeros
+func (h *BlockHeader) Serialize() []byte {
+	w := &util.Writer{}
+	h.encode(w)
+
+	return w.Bytes()
+}
+
+func (h *BlockHeader) encode(w *util.Writer) {
+	w.WriteUint32(uint32(h.Version))
+	w.WriteUint32(uint32(h.Height))
+	w.WriteFixed(h.PrevBlockHash, sha256.Size)
+	w.WriteFixed(h.MerkleRoot, sha256.Size)
+	w.WriteUint64(uint64(h.Timestamp))
+	w.WriteUint32(h.Bits)
+	w.WriteUint64(uint64(h.Nonce))
+}
+
+// DeserializeBlockHeader decodes a serialized block header
+func DeserializeBlockHeader(data []byte) (*BlockHeader, error) {
+	r := util.NewReader(data)
+	h := decodeBlockHeader(r)
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode block header: %v", err)
+	}
+
+	return h, nil
+}
+
+func decodeBlockHeader(r *util.Reader) *BlockHeader {
+	h := &BlockHeader{
+		Version:       int32(r.ReadUint32()),
+		Height:        int(r.ReadUint32()),
+		PrevBlockHash: r.ReadFixed(sha256.Size),
+		MerkleRoot:    r.ReadFixed(sha256.Size),
+		Timestamp:     int64(r.ReadUint64()),
+		Bits:          r.ReadUint32(),
+		Nonce:         int64(r.ReadUint64()),
+	}
+
+	// Only the genesis block has no previous block
+	if bytes.Equal(h.PrevBlockHash, make([]byte, sha256.Size)) {
+		h.PrevBlockHash = []byte{}
+	}
+
+	return h
+}
+
+// Hash returns the hash of the serialized header, which identifies the block
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
+// CheckProofOfWork checks that the target of the header is usable and that
+// its hash is below it
+func (h *BlockHeader) CheckProofOfWork() error {
+	if err := checkTarget(h.Bits); err != nil {
+		return err
+	}
+
+	hash := new(big.Int).SetBytes(h.Hash())
+	if hash.Cmp(CompactToBig(h.Bits)) >= 0 {
+		return errors.New("block has an invalid proof of work")
+	}
+
+	return nil
+}
+
+// Work returns the expected number of hashes needed to mine a block with
+// the target of the header, 2^256 / (target + 1)
+func (h *BlockHeader) Work() *big.Int {
+	target := new(big.Int).Add(CompactToBig(h.Bits), big.NewInt(1))
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, target)
+}
@@ -0,0 +1,166 @@
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+const (
+	blockIndexBucket = "blockindex"
+	undoBucket       = "undo"
+)
+
+// blockIndexEntry records where a stored block sits in the tree of blocks,
+// including blocks on side chains that are not part of the best chain
+type blockIndexEntry struct {
+	PrevHash  []byte
+	Height    int
+	Timestamp int64
+	Bits      uint32
+	ChainWork []byte
+	Invalid   bool
+}
+
+// work returns the cumulative work of the chain ending in the block
+func (e *blockIndexEntry) work() *big.Int {
+	return new(big.Int).SetBytes(e.ChainWork)
+}
+
+func (e blockIndexEntry) serialize() []byte {
+	w := &util.Writer{}
+
+	w.WriteBytes(e.PrevHash)
+	w.WriteUint32(uint32(e.Height))
+	w.WriteUint64(uint64(e.Timestamp))
+	w.WriteUint32(e.Bits)
+	w.WriteBytes(e.ChainWork)
+	w.WriteBool(e.Invalid)
+
+	return w.Bytes()
+}
+
+func deserializeBlockIndexEntry(data []byte) (*blockIndexEntry, error) {
+	r := util.NewReader(data)
+
+	entry := &blockIndexEntry{
+		PrevHash:  r.ReadBytes(),
+		Height:    int(r.ReadUint32()),
+		Timestamp: int64(r.ReadUint64()),
+		Bits:      r.ReadUint32(),
+		ChainWork: r.ReadBytes(),
+		Invalid:   r.ReadBool(),
+	}
+
+	if err := r.Finish(); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode block index entry")
+	}
+
+	return entry, nil
+}
+
+// newBlockIndexEntry creates the index entry for a block whose parent has the
+// given entry, or nil for the genesis block
+func newBlockIndexEntry(block *Block, parent *blockIndexEntry) *blockIndexEntry {
+	work := block.Work()
+	height := 0
+
+	if parent != nil {
+		work.Add(work, parent.work())
+		height = parent.Height + 1
+	}
+
+	return &blockIndexEntry{
+		PrevHash:  block.PrevBlockHash,
+		Height:    height,
+		Timestamp: block.Timestamp,
+		Bits:      block.Bits,
+		ChainWork: work.Bytes(),
+	}
+}
+
+func getBlockIndexEntry(tx *bolt.Tx, hash []byte) (*blockIndexEntry, error) {
+	data := tx.Bucket([]byte(blockIndexBucket)).Get(hash)
+	if data == nil {
+		return nil, nil
+	}
+
+	return deserializeBlockIndexEntry(data)
+}
+
+// indexLookup returns the links of the blocks in the block index
+func indexLookup(tx *bolt.Tx) ChainLookup {
+	return func(hash []byte) (*ChainLink, error) {
+		entry, err := getBlockIndexEntry(tx, hash)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+
+		return &ChainLink{
+			PrevHash:  entry.PrevHash,
+			Height:    entry.Height,
+			Timestamp: entry.Timestamp,
+			Bits:      entry.Bits,
+		}, nil
+	}
+}
+
+func putBlockIndexEntry(tx *bolt.Tx, hash []byte, entry *blockIndexEntry) error {
+	return tx.Bucket([]byte(blockIndexBucket)).Put(hash, entry.serialize())
+}
+
+// spentOutput is a UTXO entry removed from the UTXO set by a block
+type spentOutput struct {
+	Outpoint Outpoint
+	Entry    UTXOEntry
+}
+
+// blockUndo holds the outputs spent by a block so that it can be
+// disconnected from the best chain again during a reorganisation
+type blockUndo struct {
+	Spent []spentOutput
+}
+
+func (u blockUndo) serialize() []byte {
+	w := &util.Writer{}
+
+	w.WriteUint32(uint32(len(u.Spent)))
+	for _, spent := range u.Spent {
+		w.WriteBytes(spent.Outpoint.Txid)
+		w.WriteUint32(uint32(spent.Outpoint.Vout))
+		spent.Entry.encode(w)
+	}
+
+	return w.Bytes()
+}
+
+func getBlockUndo(tx *bolt.Tx, hash []byte) (*blockUndo, error) {
+	data := tx.Bucket([]byte(undoBucket)).Get(hash)
+	if data == nil {
+		return nil, errors.Errorf("no undo data for block %x", hash)
+	}
+
+	r := util.NewReader(data)
+	undo := &blockUndo{}
+
+	count := r.ReadCount(4 + 4 + 8 + 4 + 4 + 1)
+	for i := 0; i < count; i++ {
+		outpoint := Outpoint{
+			Txid: r.ReadBytes(),
+			Vout: int(r.ReadUint32()),
+		}
+		undo.Spent = append(undo.Spent, spentOutput{
+			Outpoint: outpoint,
+			Entry:    *decodeUTXOEntry(r),
+		})
+	}
+
+	if err := r.Finish(); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode block undo data")
+	}
+
+	return undo, nil
+}
@@ -2,35 +2,118 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
 
 const (
-	dbFile              = "blockchain.db"
-	blocksBucket        = "blocks"
-	genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+	dbFile       = "blockchain.db"
+	blocksBucket = "blocks"
 )
 
-// Blockchain represents the actual blockchain holding all its blocks
+// ErrDatabaseLocked is returned when the database is held open by another
+// process, such as a running node
+var ErrDatabaseLocked = errors.New("blockchain database is in use by another process")
+
+// Blockchain represents the actual blockchain holding all its blocks. It
+// can be read from several goroutines, but blocks must only be added by
+// one goroutine at a time
 type Blockchain struct {
-	tip []byte
-	DB  *bolt.DB
+	tip       []byte
+	tipMu     sync.RWMutex
+	DB        *bolt.DB
+	listeners []ChainListener
 }
 
 // NewBlockchain creates a new blockchain by reading from the database
 func NewBlockchain() (*Blockchain, error) {
+	bc, err := openBlockchain(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = bc.migrate(); err != nil {
+		bc.DB.Close()
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// migrate brings a database written by an older version up to date and
+// checks that it holds a chain of the active network
+func (bc *Blockchain) migrate() error {
+	if err := bc.migrateBlockIndex(); err != nil {
+		return err
+	}
+
+	if err := bc.migrateHeightIndex(); err != nil {
+		return err
+	}
+
+	if err := bc.checkGenesis(); err != nil {
+		return err
+	}
+
+	UTXOSet := UTXOSet{
+		Blockchain: bc,
+	}
+
+	return UTXOSet.Migrate()
+}
+
+// OpenBlockchainReadOnly opens the database without write access, for
+// serving the chain to readers. Any number of read-only openers can share
+// the database, but bolt locks it exclusively for a node, so this fails
+// with ErrDatabaseLocked once timeout passes while a node has it open. A
+// database that still needs migrating must be opened by a node first
+func OpenBlockchainReadOnly(timeout time.Duration) (*Blockchain, error) {
+	bc, err := openBlockchain(&bolt.Options{ReadOnly: true, Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = bc.DB.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{blockIndexBucket, heightIndexBucket, undoBucket} {
+			if tx.Bucket([]byte(name)) == nil {
+				return errors.New("blockchain needs migrating, start a node on it first")
+			}
+		}
+
+		meta := tx.Bucket([]byte(utxoMetaBucket))
+		if meta == nil || !bytes.Equal(meta.Get(utxoVersionKey), encodeUint32(utxoVersion)) {
+			return errors.New("blockchain needs migrating, start a node on it first")
+		}
+
+		return nil
+	})
+	if err == nil {
+		err = bc.checkGenesis()
+	}
+	if err != nil {
+		bc.DB.Close()
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+func openBlockchain(options *bolt.Options) (*Blockchain, error) {
 	if !dbExists() {
 		return nil, errors.New("create a blockchain first")
 	}
 
 	var tip []byte
 
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := bolt.Open(DataPath(dbFile), 0600, options)
+	if err == bolt.ErrTimeout {
+		return nil, ErrDatabaseLocked
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -39,37 +122,45 @@ func NewBlockchain() (*Blockchain, error) {
 		b := tx.Bucket([]byte(blocksBucket))
 		tip = b.Get([]byte("l"))
 
+		// Blocks from before the block header was introduced cannot be
+		// validated, and their hashes cannot be recomputed to convert them
+		block, err := DeserializeBlock(b.Get(tip))
+		if err != nil || block.Version == 0 {
+			return errors.New("blockchain predates the current block format, create a new blockchain")
+		}
+
 		return nil
 	})
 
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return &Blockchain{tip: tip, DB: db}, nil
 }
 
-// CreateBlockchain starts a brand new blockchain
+// CreateBlockchain starts a new blockchain from the genesis block of the
+// network. If address is not empty the first block after genesis is mined
+// paying it
 func CreateBlockchain(address string) (*Blockchain, error) {
 	if dbExists() {
 		return nil, errors.New("blockchain already exists")
 	}
 
-	var tip []byte
+	genesis := activeNet.GenesisBlock()
+	if err := CheckGenesisHash(genesis.Hash); err != nil {
+		return nil, err
+	}
 
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := bolt.Open(DataPath(dbFile), 0600, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		cbtx, err := NewCoinbaseTransaction(address, genesisCoinbaseData)
-		if err != nil {
-			return err
-		}
-
-		genesis := NewGenesisBlock(cbtx)
+	bc := &Blockchain{DB: db}
 
+	err = db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucket([]byte(blocksBucket))
 		if err != nil {
 			return err
@@ -90,31 +181,67 @@ func CreateBlockchain(address string) (*Blockchain, error) {
 			return err
 		}
 
-		tip = genesis.Hash
+		if err = createChainBuckets(tx); err != nil {
+			return err
+		}
 
-		return nil
+		_, err = bc.initBlock(tx, genesis, nil)
+		return err
 	})
 
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &Blockchain{tip: tip, DB: db}, nil
+	bc.tip = genesis.Hash
+
+	if address != "" {
+		cbtx, err := NewCoinbaseTransaction(address, "", 0)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		if _, err = bc.MineBlock([]*Transaction{cbtx}); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return bc, nil
 }
 
 // FindTransaction finds a transaction by its ID
 func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	block, index, err := bc.FindTransactionBlock(ID)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	return *block.Transactions[index], nil
+}
+
+// FindTransactionBlock finds the block on the main chain holding a
+// transaction and the position of the transaction in it, through the
+// transaction index if it has been built and by scanning back from the tip
+// otherwise
+func (bc *Blockchain) FindTransactionBlock(ID []byte) (*Block, int, error) {
+	if block, i, indexed, err := bc.lookupTransaction(ID); indexed {
+		return block, i, err
+	}
+
 	bci := bc.Iterator()
 
 	for {
 		b, err := bci.Next()
 		if err != nil {
-			return Transaction{}, err
+			return nil, 0, err
 		}
 
-		for _, tx := range b.Transactions {
+		for i, tx := range b.Transactions {
 			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
+				return b, i, nil
 			}
 		}
 
@@ -123,13 +250,15 @@ func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
 		}
 	}
 
-	return Transaction{}, errors.New("transaction is not found")
+	return nil, 0, errors.New("transaction is not found")
 }
 
-// FindUTXO finds all unspent transaction outputs and returns transactions with spent outputs removed
-func (bc *Blockchain) FindUTXO() (map[string]*TXOutputs, error) {
-	UTXO := make(map[string]*TXOutputs)
-	spentTXOs := make(map[string][]int)
+// FindUTXO finds all unspent transaction outputs by walking the blockchain from the tip
+func (bc *Blockchain) FindUTXO() ([]*UTXO, error) {
+	var UTXOs []*UTXO
+	var depths []int
+	spentTXOs := make(map[string]bool)
+	depth := 0
 	bci := bc.Iterator()
 
 	for {
@@ -138,31 +267,26 @@ func (bc *Blockchain) FindUTXO() (map[string]*TXOutputs, error) {
 			return nil, err
 		}
 
-		for _, tx := range b.Transactions {
-			txID := hex.EncodeToString(tx.ID)
-
-		Outputs:
+		// Transactions can spend the outputs of earlier ones in the block,
+		// so those are walked last like earlier blocks
+		for i := len(b.Transactions) - 1; i >= 0; i-- {
+			tx := b.Transactions[i]
 			for outIdx, out := range tx.Vout {
-				if spentTXOs[txID] != nil {
-					for _, spentOut := range spentTXOs[txID] {
-						if spentOut == outIdx {
-							continue Outputs
-						}
-					}
+				outpoint := Outpoint{Txid: tx.ID, Vout: outIdx}
+				if spentTXOs[outpoint.String()] {
+					continue
 				}
 
-				outs := UTXO[txID]
-				if outs == nil {
-					outs = &TXOutputs{}
-				}
-				outs.Outputs = append(outs.Outputs, out)
-				UTXO[txID] = outs
+				UTXOs = append(UTXOs, &UTXO{
+					Outpoint: outpoint,
+					Entry:    NewUTXOEntry(out, 0, tx.IsCoinbase()),
+				})
+				depths = append(depths, depth)
 			}
 
 			if !tx.IsCoinbase() {
 				for _, in := range tx.Vin {
-					inTxID := hex.EncodeToString(in.Txid)
-					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
+					spentTXOs[in.Outpoint().String()] = true
 				}
 			}
 		}
@@ -170,75 +294,171 @@ func (bc *Blockchain) FindUTXO() (map[string]*TXOutputs, error) {
 		if len(b.PrevBlockHash) == 0 {
 			break
 		}
+		depth++
 	}
 
-	return UTXO, nil
+	// The chain is walked from the tip so heights are only known once the genesis block is reached
+	for i, utxo := range UTXOs {
+		utxo.Entry.Height = depth - depths[i]
+	}
+
+	return UTXOs, nil
 }
 
 // Iterator retrieves an iterator for the blockchain
 func (bc *Blockchain) Iterator() *BIterator {
 	return &BIterator{
-		currentHash: bc.tip,
+		currentHash: bc.GetBestBlockHash(),
 		db:          bc.DB,
 	}
 }
 
 // MineBlock creates a new block with the provided transactions
 func (bc *Blockchain) MineBlock(transactions []*Transaction) (*Block, error) {
-	var lastHash []byte
+	prevHash, height, bits, past, err := bc.nextHeader()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, tx := range transactions {
-		success, err := bc.VerifyTransaction(tx)
-		if err != nil {
-			return nil, err
-		}
+	if err = bc.validateTransactions(transactions, height); err != nil {
+		return nil, err
+	}
 
-		if !success {
-			return nil, errors.New("invalid transaction")
-		}
+	newBlock := newBlock(transactions, prevHash, height, bits, blockTime(past))
+	if err := bc.AddBlock(newBlock); err != nil {
+		return nil, err
 	}
 
+	return newBlock, nil
+}
+
+// GetBestBlockHash returns the hash of the block at the tip of the blockchain
+func (bc *Blockchain) GetBestBlockHash() []byte {
+	bc.tipMu.RLock()
+	defer bc.tipMu.RUnlock()
+
+	return bc.tip
+}
+
+func (bc *Blockchain) setTip(hash []byte) {
+	bc.tipMu.Lock()
+	bc.tip = hash
+	bc.tipMu.Unlock()
+}
+
+// GetBlock retrieves a block by its hash
+func (bc *Blockchain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+
+		encodedBlock := b.Get(hash)
+		if encodedBlock == nil {
+			return errors.New("block is not found")
+		}
+
+		var err error
+		block, err = DeserializeBlock(encodedBlock)
+		return err
+	})
+
+	return block, err
+}
+
+// HasBlock checks whether a block is stored in the blockchain
+func (bc *Blockchain) HasBlock(hash []byte) (bool, error) {
+	found := false
+
 	err := bc.DB.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
+		found = b.Get(hash) != nil
 
 		return nil
 	})
-	if err != nil {
-		return nil, err
+
+	return found, err
+}
+
+// BlockLocator returns hashes walking back from the tip, densely for the
+// most recent blocks and then doubling the step, always ending in genesis.
+// A peer uses it to find the last block the two chains have in common
+func (bc *Blockchain) BlockLocator() ([][]byte, error) {
+	var locator [][]byte
+	step := 1
+	skip := 0
+	bci := bc.Iterator()
+
+	for {
+		b, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(b.PrevBlockHash) == 0 {
+			return append(locator, b.Hash), nil
+		}
+
+		if skip == 0 {
+			locator = append(locator, b.Hash)
+			if len(locator) >= 10 {
+				step *= 2
+			}
+			skip = step
+		}
+		skip--
 	}
+}
 
-	newBlock := NewBlock(transactions, lastHash)
+// GetBlockHashes returns up to max hashes of the blocks that follow the
+// first locator hash found in the blockchain, oldest first, stopping after
+// the stop hash. If no locator hash is known it starts from genesis
+func (bc *Blockchain) GetBlockHashes(locator [][]byte, stop []byte, max int) ([][]byte, error) {
+	var hashes [][]byte
+	known := make(map[string]bool)
+	bci := bc.Iterator()
 
-	err = bc.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
+	for _, hash := range locator {
+		known[hex.EncodeToString(hash)] = true
+	}
 
-		nbSer, err := newBlock.Serialize()
+	for {
+		b, err := bci.Next()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if err = b.Put(newBlock.Hash, nbSer); err != nil {
-			return err
+		if known[hex.EncodeToString(b.Hash)] {
+			break
 		}
 
-		if err = b.Put([]byte("l"), newBlock.Hash); err != nil {
-			return err
+		hashes = append(hashes, b.Hash)
+
+		if len(b.PrevBlockHash) == 0 {
+			break
 		}
+	}
 
-		bc.tip = newBlock.Hash
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
 
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	for i, hash := range hashes {
+		if bytes.Equal(hash, stop) {
+			hashes = hashes[:i+1]
+			break
+		}
 	}
 
-	return newBlock, nil
+	if len(hashes) > max {
+		hashes = hashes[:max]
+	}
+
+	return hashes, nil
 }
 
 // SignTransaction signs the inputs of a transaction
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
+func (bc *Blockchain) SignTransaction(tx *Transaction, privKey *PrivateKey) error {
 	prevTXs := make(map[string]Transaction)
 
 	for _, vin := range tx.Vin {
@@ -250,13 +470,17 @@ func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey)
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
-
-	return nil
+	return tx.Sign(privKey, prevTXs)
 }
 
 // VerifyTransaction verifies transaction input signatures
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) (bool, error) {
+	return bc.verifyTransaction(tx, nil)
+}
+
+// verifyTransaction verifies transaction input signatures, looking up the
+// transactions spent from in pending, keyed by hex ID, before the blockchain
+func (bc *Blockchain) verifyTransaction(tx *Transaction, pending map[string]*Transaction) (bool, error) {
 	if tx.IsCoinbase() {
 		return true, nil
 	}
@@ -264,19 +488,25 @@ func (bc *Blockchain) VerifyTransaction(tx *Transaction) (bool, error) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, vin := range tx.Vin {
+		key := hex.EncodeToString(vin.Txid)
+		if prevTX, ok := pending[key]; ok {
+			prevTXs[key] = *prevTX
+			continue
+		}
+
 		prevTX, err := bc.FindTransaction(vin.Txid)
 		if err != nil {
 			return false, err
 		}
 
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+		prevTXs[key] = prevTX
 	}
 
 	return tx.Verify(prevTXs)
 }
 
 func dbExists() bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+	if _, err := os.Stat(DataPath(dbFile)); os.IsNotExist(err) {
 		return false
 	}
 
@@ -0,0 +1,208 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RetargetInterval is the number of blocks between difficulty adjustments
+	RetargetInterval = 20
+
+	// TargetBlockSpacing is the time the difficulty aims to keep between blocks
+	TargetBlockSpacing = time.Minute
+
+	// maxRetargetFactor limits how far a single adjustment can move the target
+	maxRetargetFactor = 4
+
+	// DefaultGenesisBits is the target of a new blockchain on the main
+	// network and of its genesis block, requiring the hash of a block to start
+	// with 24 zero bits
+	DefaultGenesisBits = 0x1e010000
+)
+
+// powLimit returns the easiest target a block of the selected network may use
+func powLimit() *big.Int {
+	return CompactToBig(activeNet.PowLimitBits)
+}
+
+// CompactToBig converts a target in the compact representation stored in
+// block headers to a big integer. The compact form holds the size of the
+// target in bytes in the high byte and its most significant bytes in the
+// lower three, with 0x00800000 as a sign bit
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	negative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = big.NewInt(int64(mantissa))
+	} else {
+		target = big.NewInt(int64(mantissa))
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	if negative {
+		target.Neg(target)
+	}
+
+	return target
+}
+
+// BigToCompact converts a target to the compact representation stored in
+// block headers, losing all but its three most significant bytes
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Abs(target)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// The sign bit is part of the mantissa, so move a set high bit into an
+	// extra byte of exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+// TargetBitsToCompact returns the compact target requiring a block hash to
+// start with the given number of zero bits
+func TargetBitsToCompact(targetBits int) uint32 {
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-targetBits))
+
+	return BigToCompact(target)
+}
+
+// checkTarget checks that compact bits describe a usable target
+func checkTarget(bits uint32) error {
+	target := CompactToBig(bits)
+
+	if target.Sign() <= 0 {
+		return errors.Errorf("target %08x is not positive", bits)
+	}
+
+	if target.Cmp(powLimit()) > 0 {
+		return errors.Errorf("target %08x is easier than the limit", bits)
+	}
+
+	return nil
+}
+
+// nextHeader returns the hash of the current tip along with the height and
+// target of a block mined on it, and the timestamps of the blocks its
+// timestamp must be later than the median of
+func (bc *Blockchain) nextHeader() ([]byte, int, uint32, []int64, error) {
+	var height int
+	var bits uint32
+	var past []int64
+	tipHash := bc.GetBestBlockHash()
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		tip, err := getBlockIndexEntry(tx, tipHash)
+		if err != nil {
+			return err
+		}
+		if tip == nil {
+			return errors.Errorf("block %x is not known", tipHash)
+		}
+
+		height = tip.Height + 1
+		if bits, err = NextBits(tipHash, indexLookup(tx)); err != nil {
+			return err
+		}
+
+		past, err = PastTimestamps(tipHash, indexLookup(tx))
+		return err
+	})
+
+	return tipHash, height, bits, past, err
+}
+
+// ChainLink is what the difficulty and median time rules need to know
+// about a stored block
+type ChainLink struct {
+	PrevHash  []byte
+	Height    int
+	Timestamp int64
+	Bits      uint32
+}
+
+// ChainLookup returns the link of a stored block, or nil if the block is not
+// known. It lets full nodes and light clients share the header rules
+type ChainLookup func(hash []byte) (*ChainLink, error)
+
+// NextBits returns the target of a block whose parent has the given hash.
+// The target stays the same except every RetargetInterval blocks on networks
+// that retarget, when it is scaled by how long the blocks since the last
+// adjustment took compared to TargetBlockSpacing
+func NextBits(parentHash []byte, lookup ChainLookup) (uint32, error) {
+	parent, err := lookup(parentHash)
+	if err != nil {
+		return 0, err
+	}
+	if parent == nil {
+		return 0, errors.Errorf("block %x is not known", parentHash)
+	}
+
+	if !IsRetargetHeight(parent.Height + 1) {
+		return parent.Bits, nil
+	}
+
+	first := parent
+	for i := 0; i < RetargetInterval-1; i++ {
+		if first, err = lookup(first.PrevHash); err != nil {
+			return 0, err
+		}
+		if first == nil {
+			return 0, errors.Errorf("ancestor of block %x is not known", parentHash)
+		}
+	}
+
+	return RetargetBits(parent.Bits, first.Timestamp, parent.Timestamp), nil
+}
+
+// RetargetBits returns the target following an adjustment, given the target
+// before it and the timestamps of the first and last blocks of the
+// RetargetInterval blocks leading up to it
+func RetargetBits(bits uint32, firstTimestamp, lastTimestamp int64) uint32 {
+	expected := int64((RetargetInterval - 1) * TargetBlockSpacing / time.Second)
+	actual := lastTimestamp - firstTimestamp
+	if actual < expected/maxRetargetFactor {
+		actual = expected / maxRetargetFactor
+	}
+	if actual > expected*maxRetargetFactor {
+		actual = expected * maxRetargetFactor
+	}
+
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+
+	if limit := powLimit(); target.Cmp(limit) > 0 {
+		target.Set(limit)
+	}
+
+	return BigToCompact(target)
+}
@@ -0,0 +1,218 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// useRetargetingNetwork switches the test network to one that retargets,
+// which regtest otherwise never does
+func useRetargetingNetwork() {
+	params := *activeNet
+	params.NoRetargeting = false
+	activeNet = &params
+}
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		target  string
+	}{
+		{0x00000000, "0"},
+		{0x01003456, "0"},
+		{0x01123456, "12"},
+		{0x02008000, "80"},
+		{0x03123456, "123456"},
+		{0x04123456, "12345600"},
+		{0x04923456, "-12345600"},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{0x207fffff, "7fffff0000000000000000000000000000000000000000000000000000000000"},
+		// The exponent can describe targets far larger than a hash
+		{0x22123456, "12345600000000000000000000000000000000000000000000000000000000000000"},
+	}
+
+	for _, test := range tests {
+		want, _ := new(big.Int).SetString(test.target, 16)
+		if got := CompactToBig(test.compact); got.Cmp(want) != 0 {
+			t.Errorf("CompactToBig(%08x) = %x, want %x", test.compact, got, want)
+		}
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	tests := []struct {
+		target  string
+		compact uint32
+	}{
+		{"0", 0x00000000},
+		{"12", 0x01120000},
+		// A set high bit would read as the sign, so the exponent grows
+		{"80", 0x02008000},
+		{"-80", 0x02808000},
+		{"12345600", 0x04123456},
+		{"-12345600", 0x04923456},
+		// Bytes beyond the three most significant are dropped
+		{"123456789a", 0x05123456},
+		{"ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+		{"12345600000000000000000000000000000000000000000000000000000000000000", 0x22123456},
+	}
+
+	for _, test := range tests {
+		target, _ := new(big.Int).SetString(test.target, 16)
+		compact := BigToCompact(target)
+		if compact != test.compact {
+			t.Errorf("BigToCompact(%s) = %08x, want %08x", test.target, compact, test.compact)
+		}
+
+		// Targets that fit in the mantissa survive the round trip
+		if len(test.target) <= 8 && CompactToBig(compact).Cmp(target) != 0 {
+			t.Errorf("CompactToBig(BigToCompact(%s)) = %x", test.target, CompactToBig(compact))
+		}
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	useTestNetwork(t)
+
+	for _, bits := range []uint32{0x00000000, 0x01003456, 0x04923456, 0x20800001, 0x21008000, 0x22123456} {
+		if err := checkTarget(bits); err == nil {
+			t.Errorf("target %08x was accepted", bits)
+		}
+	}
+
+	for _, bits := range []uint32{RegTestParams.PowLimitBits, 0x1d00ffff, 0x01010000} {
+		if err := checkTarget(bits); err != nil {
+			t.Errorf("target %08x was rejected: %v", bits, err)
+		}
+	}
+}
+
+func TestRetargetBits(t *testing.T) {
+	useTestNetwork(t)
+
+	expected := int64((RetargetInterval - 1) * TargetBlockSpacing / time.Second)
+	limit := RegTestParams.PowLimitBits
+
+	tests := []struct {
+		name    string
+		bits    uint32
+		elapsed int64
+		want    uint32
+	}{
+		{"on time", 0x1c100000, expected, 0x1c100000},
+		{"twice as fast", 0x1c100000, expected / 2, 0x1c080000},
+		{"twice as slow", 0x1c100000, expected * 2, 0x1c200000},
+		{"four times as fast", 0x1c100000, expected / 4, 0x1c040000},
+		{"clamped when faster", 0x1c100000, 1, 0x1c040000},
+		{"clamped when timestamps go backwards", 0x1c100000, -expected, 0x1c040000},
+		{"four times as slow", 0x1c100000, expected * 4, 0x1c400000},
+		{"clamped when slower", 0x1c100000, expected * 100, 0x1c400000},
+		{"capped at the limit", 0x20200000, expected * 4, limit},
+		{"limit when slower", limit, expected * 2, limit},
+	}
+
+	for _, test := range tests {
+		first := int64(1000000)
+		if got := RetargetBits(test.bits, first, first+test.elapsed); got != test.want {
+			t.Errorf("%s: RetargetBits(%08x) = %08x, want %08x", test.name, test.bits, got, test.want)
+		}
+	}
+}
+
+func TestNextBits(t *testing.T) {
+	useTestNetwork(t)
+	useRetargetingNetwork()
+
+	// A chain of links whose hashes are their heights, a block every
+	// half a target spacing
+	spacing := int64(TargetBlockSpacing/time.Second) / 2
+	links := make(map[string]*ChainLink)
+	hash := func(height int) []byte {
+		if height < 0 {
+			return nil
+		}
+		return []byte{byte(height)}
+	}
+	for height := 0; height < 2*RetargetInterval; height++ {
+		links[string(hash(height))] = &ChainLink{
+			PrevHash:  hash(height - 1),
+			Height:    height,
+			Timestamp: int64(height) * spacing,
+			Bits:      0x1c100000,
+		}
+	}
+	lookup := func(hash []byte) (*ChainLink, error) {
+		return links[string(hash)], nil
+	}
+
+	bits, err := NextBits(hash(RetargetInterval-2), lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits != 0x1c100000 {
+		t.Errorf("target before a retarget height is %08x, want that of the parent", bits)
+	}
+
+	bits, err = NextBits(hash(RetargetInterval-1), lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits != 0x1c080000 {
+		t.Errorf("target at a retarget height is %08x, want it halved to 1c080000", bits)
+	}
+
+	delete(links, string(hash(0)))
+	if _, err = NextBits(hash(RetargetInterval-1), lookup); err == nil {
+		t.Error("retarget without the first block of the interval succeeded")
+	}
+	if _, err = NextBits(hash(2*RetargetInterval), lookup); err == nil {
+		t.Error("target of a block with an unknown parent was found")
+	}
+}
+
+func TestAddBlockChecksRetargetBits(t *testing.T) {
+	bc, _, alice := newTestChain(t)
+	useRetargetingNetwork()
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks a second apart, with the first retarget staying at the limit as
+	// the interval reaches back to the genesis block
+	for tip.Height < 2*RetargetInterval-1 {
+		_, _, bits, _, err := bc.nextHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tip = newBlock([]*Transaction{coinbase(t, alice, 0)}, tip.Hash, tip.Height+1, bits, tip.Timestamp+1)
+		if err = bc.AddBlock(tip); err != nil {
+			t.Fatalf("adding block %d: %v", tip.Height, err)
+		}
+	}
+
+	_, _, bits, _, err := bc.nextHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := RetargetBits(tip.Bits, 0, 0); bits != want {
+		t.Fatalf("target after fast blocks is %08x, want %08x", bits, want)
+	}
+
+	unchanged := buildBlock(tip, coinbase(t, alice, 0))
+	err = bc.AddBlock(unchanged)
+	if err == nil {
+		t.Fatal("block keeping the old target at a retarget height was accepted")
+	}
+	if !IsRuleError(err) {
+		t.Errorf("wrong target is not a rule error: %v", err)
+	}
+
+	retargeted := newBlock([]*Transaction{coinbase(t, alice, 0)}, tip.Hash, tip.Height+1, bits, tip.Timestamp+1)
+	if err = bc.AddBlock(retargeted); err != nil {
+		t.Fatalf("block with the new target was rejected: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// GenesisBlock returns the genesis block of the network, which every
+// blockchain of the network starts from. Its coinbase carries
+// GenesisCoinbaseData and pays the subsidy to an output that cannot be spent
+func (p *NetParams) GenesisBlock() *Block {
+	coinbase := &Transaction{
+		Vin: []*TXInput{{
+			Txid:      []byte{},
+			Vout:      -1,
+			ScriptSig: []byte(p.GenesisCoinbaseData),
+		}},
+		Vout: []*TXOutput{{
+			Value:        p.Subsidy,
+			ScriptPubKey: []byte{OpReturn},
+		}},
+	}
+	// Hashing only fails for transactions too large to encode
+	id, err := coinbase.Hash()
+	if err != nil {
+		panic(err)
+	}
+	coinbase.ID = id
+
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:       1,
+			Height:        0,
+			PrevBlockHash: []byte{},
+			Timestamp:     p.GenesisTimestamp,
+			Bits:          p.GenesisBits,
+			Nonce:         p.GenesisNonce,
+		},
+		Transactions: []*Transaction{coinbase},
+	}
+	block.MerkleRoot = block.HashTransactions()
+	block.Hash = block.BlockHeader.Hash()
+
+	return block
+}
+
+// CheckGenesisHash checks that hash is the hash of the genesis block of the
+// active network
+func CheckGenesisHash(hash []byte) error {
+	if want := activeNet.GenesisHash; hex.EncodeToString(hash) != want {
+		return fmt.Errorf("genesis block %x is not the %s genesis block %s", hash, activeNet.Name, want)
+	}
+
+	return nil
+}
+
+// checkGenesis checks that the blockchain starts from the genesis block of
+// the active network, which blockchains created before it was fixed do not
+func (bc *Blockchain) checkGenesis() error {
+	hash, err := bc.GetBlockHashByHeight(0)
+	if err != nil {
+		return err
+	}
+
+	if err = CheckGenesisHash(hash); err != nil {
+		return fmt.Errorf("blockchain does not start from the genesis block of the network, create it again: %v", err)
+	}
+
+	return nil
+}
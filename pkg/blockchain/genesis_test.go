@@ -0,0 +1,41 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestGenesisBlocks(t *testing.T) {
+	for _, params := range []*NetParams{MainNetParams, TestNetParams, RegTestParams} {
+		genesis := params.GenesisBlock()
+
+		if hash := hex.EncodeToString(genesis.Hash); hash != params.GenesisHash {
+			t.Errorf("%s genesis block hash is %s, want %s", params.Name, hash, params.GenesisHash)
+		}
+		if err := genesis.CheckProofOfWork(); err != nil {
+			t.Errorf("%s genesis block: %v", params.Name, err)
+		}
+	}
+}
+
+func TestAddBlockRejectsOtherGenesis(t *testing.T) {
+	bc, _, alice := newTestChain(t)
+
+	genesisHash, err := bc.GetBlockHashByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckGenesisHash(genesisHash); err != nil {
+		t.Fatal(err)
+	}
+
+	cb, err := NewCoinbaseTransaction(alice, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newBlock([]*Transaction{cb}, []byte{}, 0, RegTestParams.GenesisBits, RegTestParams.GenesisTimestamp)
+
+	if err = bc.AddBlock(other); err == nil {
+		t.Fatal("a different genesis block was accepted")
+	}
+}
@@ -0,0 +1,260 @@
+package blockchain
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+
+	"github.com/tcheard/blockchain/pkg/hdkey"
+	"github.com/tcheard/blockchain/pkg/secp256k1"
+)
+
+// DefaultGapLimit is how many unused addresses in a row end the search for
+// the addresses of a restored wallet
+const DefaultGapLimit = 20
+
+// The chains of an account, receiving addresses handed out to payers and
+// change addresses that transactions pay themselves back to
+const (
+	receiveChain = 0
+	changeChain  = 1
+)
+
+// HDSeed is the seed the keys of a hierarchical deterministic wallet are
+// derived from, with the next unused index of each chain of its account.
+// Receiving keys are derived at m/account'/0/i and change keys at
+// m/account'/1/i, so the seed alone recovers every key
+type HDSeed struct {
+	Seed    []byte
+	Account uint32
+
+	// EncryptedSeed replaces Seed in an encrypted wallet
+	EncryptedSeed []byte
+
+	NextReceive uint32
+	NextChange  uint32
+}
+
+// HasSeed reports whether new keys are derived from a seed
+func (ws *Wallets) HasSeed() bool {
+	return ws.HD != nil
+}
+
+// SetSeed makes the wallet derive its keys from seed, in the given account.
+// Keys created before are kept
+func (ws *Wallets) SetSeed(seed []byte, account uint32) error {
+	if ws.HD != nil {
+		return errors.New("wallet already has a seed")
+	}
+	if account >= hdkey.HardenedOffset {
+		return fmt.Errorf("account %d is too large", account)
+	}
+	if _, err := hdkey.NewMaster(seed, secp256k1.S256()); err != nil {
+		return err
+	}
+
+	hd := &HDSeed{Account: account}
+	if ws.Encryption == nil {
+		hd.Seed = seed
+	} else {
+		if err := ws.encryptSeed(hd, seed); err != nil {
+			return err
+		}
+	}
+
+	ws.HD = hd
+
+	return nil
+}
+
+// ChangeAddress returns the address change from a payment by from is sent
+// to, which is a new change address of a wallet with a seed and from itself
+// otherwise
+func (ws *Wallets) ChangeAddress(from string) (string, error) {
+	if ws.HD == nil {
+		return from, nil
+	}
+
+	return ws.nextAddress(changeChain)
+}
+
+// RestoreAddresses adds the keys of the seed that have been paid, according
+// to UTXOSet, along with the unused keys before them. Each chain is searched
+// until gapLimit keys in a row are unused. Keys whose outputs have all been
+// spent look unused, and are found only when a later key was paid. It returns
+// the number of paid addresses
+func (ws *Wallets) RestoreAddresses(UTXOSet *UTXOSet, gapLimit int) (int, error) {
+	if ws.HD == nil {
+		return 0, errors.New("wallet has no seed")
+	}
+
+	paid, err := UTXOSet.PubKeyHashes()
+	if err != nil {
+		return 0, err
+	}
+
+	found := 0
+	for _, chain := range []uint32{receiveChain, changeChain} {
+		var derived []*Wallet
+		last := -1
+
+		for index, unused := uint32(0), 0; unused < gapLimit; index++ {
+			wallet, err := ws.deriveWallet(chain, index)
+			if err == hdkey.ErrInvalidKey {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			derived = append(derived, wallet)
+
+			pubKeyHash, err := HashPublicKey(wallet.PublicKey)
+			if err != nil {
+				return 0, err
+			}
+
+			if paid[string(pubKeyHash)] {
+				last = len(derived) - 1
+				unused = 0
+				found++
+			} else {
+				unused++
+			}
+		}
+
+		for _, wallet := range derived[:last+1] {
+			address, err := wallet.GetAddress()
+			if err != nil {
+				return 0, err
+			}
+			ws.Wallets[string(address)] = wallet
+		}
+
+		next := uint32(0)
+		if last >= 0 {
+			indexes, err := hdkey.ParsePath(derived[last].Path)
+			if err != nil {
+				return 0, err
+			}
+			next = indexes[len(indexes)-1] + 1
+		}
+
+		if chain == receiveChain {
+			ws.HD.NextReceive = next
+		} else {
+			ws.HD.NextChange = next
+		}
+	}
+
+	return found, nil
+}
+
+// nextAddress derives the next unused key of a chain and adds it to the
+// wallets
+func (ws *Wallets) nextAddress(chain uint32) (string, error) {
+	next := &ws.HD.NextReceive
+	if chain == changeChain {
+		next = &ws.HD.NextChange
+	}
+
+	for index := *next; ; index++ {
+		wallet, err := ws.deriveWallet(chain, index)
+		if err == hdkey.ErrInvalidKey {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		address, err := wallet.GetAddress()
+		if err != nil {
+			return "", err
+		}
+
+		ws.Wallets[string(address)] = wallet
+		*next = index + 1
+
+		return string(address), nil
+	}
+}
+
+// deriveWallet derives the key at an index of a chain. Only the public key
+// and path are kept, the private key is derived again when it is needed
+func (ws *Wallets) deriveWallet(chain, index uint32) (*Wallet, error) {
+	path := fmt.Sprintf("m/%d'/%d/%d", ws.HD.Account, chain, index)
+
+	private, err := ws.derivePrivateKey(path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Wallet{PublicKey: private.key.PubKey().SerializeCompressed(), Path: path}, nil
+}
+
+// derivePrivateKey derives the key at path from the seed, on P-256 for the
+// keys derived before wallets used secp256k1
+func (ws *Wallets) derivePrivateKey(path string, legacy bool) (*PrivateKey, error) {
+	seed, err := ws.seed()
+	if err != nil {
+		return nil, err
+	}
+
+	var curve elliptic.Curve = secp256k1.S256()
+	if legacy {
+		curve = elliptic.P256()
+	}
+
+	master, err := hdkey.NewMaster(seed, curve)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPrivateKey(key.Key(), legacy)
+}
+
+// seed returns the seed, decrypting it if the wallet is encrypted
+func (ws *Wallets) seed() ([]byte, error) {
+	if ws.HD == nil {
+		return nil, errors.New("wallet has no seed")
+	}
+
+	if ws.Encryption == nil {
+		return ws.HD.Seed, nil
+	}
+
+	ws.mu.Lock()
+	key := ws.key
+	ws.mu.Unlock()
+
+	if key == nil {
+		return nil, ErrWalletLocked
+	}
+
+	return open(key, ws.HD.EncryptedSeed, nil)
+}
+
+// encryptSeed sets the encrypted seed of hd under the held key
+func (ws *Wallets) encryptSeed(hd *HDSeed, seed []byte) error {
+	ws.mu.Lock()
+	key := ws.key
+	ws.mu.Unlock()
+
+	if key == nil {
+		return ErrWalletLocked
+	}
+
+	encrypted, err := seal(key, seed, nil)
+	if err != nil {
+		return err
+	}
+
+	hd.EncryptedSeed = encrypted
+	hd.Seed = nil
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// heightIndexBucket maps the height of each block on the best chain, as a
+// big endian uint32, to its hash
+const heightIndexBucket = "heightindex"
+
+// GetBestHeight returns the height of the tip of the best chain
+func (bc *Blockchain) GetBestHeight() (int, error) {
+	var height int
+	tipHash := bc.GetBestBlockHash()
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		tip, err := getBlockIndexEntry(tx, tipHash)
+		if err != nil {
+			return err
+		}
+		if tip == nil {
+			return errors.Errorf("block %x is not known", tipHash)
+		}
+
+		height = tip.Height
+		return nil
+	})
+
+	return height, err
+}
+
+// GetBlockHashByHeight returns the hash of the block at a height of the best
+// chain
+func (bc *Blockchain) GetBlockHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		hash, err = getHeightIndexHash(tx, height)
+		return err
+	})
+
+	return hash, err
+}
+
+// GetBlockByHeight returns the block at a height of the best chain
+func (bc *Blockchain) GetBlockByHeight(height int) (*Block, error) {
+	hash, err := bc.GetBlockHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.GetBlock(hash)
+}
+
+// Confirmations counts the blocks from a block to the tip of the best chain,
+// including the block itself. Blocks on a side chain have -1 confirmations
+func (bc *Blockchain) Confirmations(block *Block) (int, error) {
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return 0, err
+	}
+	if block.Height > bestHeight {
+		return -1, nil
+	}
+
+	hash, err := bc.GetBlockHashByHeight(block.Height)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(hash, block.Hash) {
+		return -1, nil
+	}
+
+	return bestHeight - block.Height + 1, nil
+}
+
+// ForwardIterator walks the best chain from a height towards the tip
+type ForwardIterator struct {
+	height int
+	bc     *Blockchain
+}
+
+// ForwardIterator returns an iterator starting at the block at height
+func (bc *Blockchain) ForwardIterator(height int) *ForwardIterator {
+	return &ForwardIterator{height: height, bc: bc}
+}
+
+// Next returns the next block, or nil once the tip has been passed
+func (i *ForwardIterator) Next() (*Block, error) {
+	best, err := i.bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if i.height > best {
+		return nil, nil
+	}
+
+	block, err := i.bc.GetBlockByHeight(i.height)
+	if err != nil {
+		return nil, err
+	}
+	i.height++
+
+	return block, nil
+}
+
+func getHeightIndexHash(tx *bolt.Tx, height int) ([]byte, error) {
+	if height < 0 {
+		return nil, errors.Errorf("no block at height %d", height)
+	}
+
+	hash := tx.Bucket([]byte(heightIndexBucket)).Get(encodeUint32(uint32(height)))
+	if hash == nil {
+		return nil, errors.Errorf("no block at height %d", height)
+	}
+
+	// The slice is only valid for the life of the transaction
+	return append([]byte{}, hash...), nil
+}
+
+func putHeightIndexHash(tx *bolt.Tx, height int, hash []byte) error {
+	return tx.Bucket([]byte(heightIndexBucket)).Put(encodeUint32(uint32(height)), hash)
+}
+
+func deleteHeightIndexHash(tx *bolt.Tx, height int) error {
+	return tx.Bucket([]byte(heightIndexBucket)).Delete(encodeUint32(uint32(height)))
+}
+
+// migrateHeightIndex builds the height index for a database created before
+// it existed by walking back from the tip
+func (bc *Blockchain) migrateHeightIndex() error {
+	indexed := false
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		indexed = tx.Bucket([]byte(heightIndexBucket)) != nil
+
+		return nil
+	})
+	if err != nil || indexed {
+		return err
+	}
+
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket([]byte(heightIndexBucket)); err != nil {
+			return err
+		}
+
+		hash := bc.tip
+		for len(hash) > 0 {
+			entry, err := getBlockIndexEntry(tx, hash)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				return errors.Errorf("block %x is not known", hash)
+			}
+
+			if err = putHeightIndexHash(tx, entry.Height, hash); err != nil {
+				return err
+			}
+
+			hash = entry.PrevHash
+		}
+
+		return nil
+	})
+}
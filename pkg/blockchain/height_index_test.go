@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// checkConfirmations checks the confirmations of a block
+func checkConfirmations(t *testing.T, bc *Blockchain, block *Block, want int) {
+	t.Helper()
+
+	confirmations, err := bc.Confirmations(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmations != want {
+		t.Errorf("block at height %d has %d confirmations, want %d", block.Height, confirmations, want)
+	}
+}
+
+func TestHeightIndex(t *testing.T) {
+	bc, _, alice := newTestChain(t)
+
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := bc.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := bc.MineBlock([]*Transaction{coinbase(t, alice, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := bc.MineBlock([]*Transaction{coinbase(t, alice, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := buildBlock(second, coinbase(t, alice, 0))
+	if err = bc.AddBlock(side); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBestChain(t, bc, genesis, first, second, third)
+	if _, err = bc.GetBlockHashByHeight(-1); err == nil {
+		t.Error("found a block at height -1")
+	}
+
+	checkConfirmations(t, bc, genesis, 4)
+	checkConfirmations(t, bc, third, 1)
+	checkConfirmations(t, bc, side, -1)
+
+	it := bc.ForwardIterator(1)
+	for _, want := range []*Block{first, second, third} {
+		block, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block == nil || !bytes.Equal(block.Hash, want.Hash) {
+			t.Fatalf("forward iterator did not return block %d", want.Height)
+		}
+	}
+	if block, err := it.Next(); err != nil || block != nil {
+		t.Errorf("forward iterator went past the tip: %v", err)
+	}
+
+	if err = bc.disconnectBlock(third.Hash); err != nil {
+		t.Fatal(err)
+	}
+	checkBestChain(t, bc, genesis, first, second)
+	checkConfirmations(t, bc, third, -1)
+	if height, err := bc.GetBestHeight(); err != nil || height != 2 {
+		t.Errorf("best height after disconnecting is %d, want 2: %v", height, err)
+	}
+
+	// A database without the index has it rebuilt from the tip
+	err = bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(heightIndexBucket))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.migrateHeightIndex(); err != nil {
+		t.Fatal(err)
+	}
+	checkBestChain(t, bc, genesis, first, second)
+}
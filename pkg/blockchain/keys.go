@@ -0,0 +1,138 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+
+	"github.com/tcheard/blockchain/pkg/secp256k1"
+)
+
+// Public keys are compressed secp256k1 keys of secp256k1.PubKeyLen bytes,
+// and signatures are R and S of 32 bytes each. Outputs paid to the legacy
+// P-256 keys of wallets from before secp256k1 can still be spent: their
+// public keys are X and Y with leading zeros dropped, and so are their R and
+// S until signatures became fixed width
+
+// PrivateKey signs the inputs spending from an address of the wallet
+type PrivateKey struct {
+	key    *secp256k1.PrivateKey
+	legacy *ecdsa.PrivateKey
+}
+
+// newPrivateKey returns the private key of a 32 byte scalar, on P-256 if it
+// is a legacy key
+func newPrivateKey(d []byte, legacy bool) (*PrivateKey, error) {
+	if !legacy {
+		key, err := secp256k1.PrivKeyFromBytes(d)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrivateKey{key: key}, nil
+	}
+
+	curve := elliptic.P256()
+	private := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return &PrivateKey{legacy: private}, nil
+}
+
+// PublicKey returns the public key in the form inputs push it in
+func (k *PrivateKey) PublicKey() []byte {
+	if k.legacy == nil {
+		return k.key.PubKey().SerializeCompressed()
+	}
+
+	return append(k.legacy.X.Bytes(), k.legacy.Y.Bytes()...)
+}
+
+// Sign signs a hash
+func (k *PrivateKey) Sign(hash []byte) ([]byte, error) {
+	if k.legacy == nil {
+		return k.key.Sign(hash).SerializeCompact(), nil
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, k.legacy, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(paddedBytes(r, 32), paddedBytes(s, 32)...), nil
+}
+
+// VerifySignature reports whether signature is a valid signature of hash by
+// the public key
+func VerifySignature(pubKey, hash, signature []byte) bool {
+	if len(pubKey) != secp256k1.PubKeyLen {
+		return verifyLegacySignature(pubKey, hash, signature)
+	}
+
+	key, err := secp256k1.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	sig, err := secp256k1.ParseCompactSignature(signature)
+	if err != nil {
+		return false
+	}
+
+	return sig.Verify(hash, key)
+}
+
+// verifyLegacySignature verifies a signature by a legacy P-256 key. Where
+// leading zeros were dropped it is not known where X ends and Y starts, or
+// R and S, so every split into halves of at most 32 bytes is tried. Only
+// the right split of a key is on the curve
+func verifyLegacySignature(pubKey, hash, signature []byte) bool {
+	curve := elliptic.P256()
+
+	for _, key := range splitHalves(pubKey) {
+		x, y := new(big.Int).SetBytes(key[0]), new(big.Int).SetBytes(key[1])
+		if !curve.IsOnCurve(x, y) {
+			continue
+		}
+
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		for _, sig := range splitHalves(signature) {
+			if ecdsa.Verify(pub, hash, new(big.Int).SetBytes(sig[0]), new(big.Int).SetBytes(sig[1])) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// splitHalves returns the ways of splitting b into two non-empty parts of
+// at most 32 bytes, with the even split first
+func splitHalves(b []byte) [][2][]byte {
+	var splits [][2][]byte
+	if len(b) < 2 || len(b) > 64 {
+		return splits
+	}
+
+	mid := len(b) / 2
+	splits = append(splits, [2][]byte{b[:mid], b[mid:]})
+
+	for i := len(b) - 32; i <= 32; i++ {
+		if i >= 1 && i != mid {
+			splits = append(splits, [2][]byte{b[:i], b[i:]})
+		}
+	}
+
+	return splits
+}
+
+// paddedBytes returns n as size big endian bytes
+func paddedBytes(n *big.Int, size int) []byte {
+	b := make([]byte, size)
+	nb := n.Bytes()
+	copy(b[size-len(nb):], nb)
+
+	return b
+}
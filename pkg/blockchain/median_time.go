@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// MedianTimeBlocks is the number of blocks before a block whose median
+	// timestamp the block's timestamp must be later than
+	MedianTimeBlocks = 11
+
+	// MaxFutureBlockTime is how far ahead of the local clock the timestamp
+	// of a block may be
+	MaxFutureBlockTime = 2 * time.Hour
+)
+
+// ErrTimeTooNew is returned for a block whose timestamp is more than
+// MaxFutureBlockTime ahead of the local clock. Such a block becomes valid
+// as time passes, so it is rejected without being stored or marked invalid
+var ErrTimeTooNew = errors.New("block timestamp is too far in the future")
+
+// MedianTimestamp returns the median of timestamps, or 0 if there are none
+func MedianTimestamp(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sorted := append([]int64{}, timestamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[len(sorted)/2]
+}
+
+// CheckMedianTime checks that a block timestamp is later than the median of
+// the timestamps of up to MedianTimeBlocks blocks before it, so that
+// timestamps cannot be set far into the past to lower the difficulty
+func CheckMedianTime(timestamp int64, past []int64) error {
+	if len(past) == 0 {
+		return nil
+	}
+
+	if median := MedianTimestamp(past); timestamp <= median {
+		return fmt.Errorf("block timestamp %d is not after %d, the median of the previous blocks", timestamp, median)
+	}
+
+	return nil
+}
+
+// CheckFutureTime checks that a block timestamp is no more than
+// MaxFutureBlockTime ahead of now, failing with ErrTimeTooNew otherwise
+func CheckFutureTime(timestamp int64, now time.Time) error {
+	if timestamp > now.Add(MaxFutureBlockTime).Unix() {
+		return ErrTimeTooNew
+	}
+
+	return nil
+}
+
+// PastTimestamps returns the timestamps of the block with the given hash and
+// of the blocks before it, up to MedianTimeBlocks in all
+func PastTimestamps(hash []byte, lookup ChainLookup) ([]int64, error) {
+	var timestamps []int64
+
+	for len(timestamps) < MedianTimeBlocks && len(hash) != 0 {
+		link, err := lookup(hash)
+		if err != nil {
+			return nil, err
+		}
+		if link == nil {
+			return nil, fmt.Errorf("block %x is not known", hash)
+		}
+
+		timestamps = append(timestamps, link.Timestamp)
+		hash = link.PrevHash
+	}
+
+	return timestamps, nil
+}
+
+// blockTime returns the timestamp for a new block, which is the current time
+// unless that is not after the median time of the blocks before it
+func blockTime(past []int64) int64 {
+	now := time.Now().Unix()
+	if min := MedianTimestamp(past) + 1; len(past) > 0 && now < min {
+		return min
+	}
+
+	return now
+}
@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMedianTimestamp(t *testing.T) {
+	tests := []struct {
+		timestamps []int64
+		median     int64
+	}{
+		{nil, 0},
+		{[]int64{5}, 5},
+		{[]int64{3, 1, 2}, 2},
+		{[]int64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5, 11}, 6},
+	}
+
+	for _, test := range tests {
+		if median := MedianTimestamp(test.timestamps); median != test.median {
+			t.Errorf("MedianTimestamp(%v) = %d, want %d", test.timestamps, median, test.median)
+		}
+	}
+}
+
+func TestCheckTimestamps(t *testing.T) {
+	past := []int64{100, 110, 120}
+	if err := CheckMedianTime(110, past); err == nil {
+		t.Error("timestamp equal to the median was accepted")
+	}
+	if err := CheckMedianTime(111, past); err != nil {
+		t.Errorf("timestamp after the median was rejected: %v", err)
+	}
+
+	now := time.Unix(1000000, 0)
+	if err := CheckFutureTime(now.Add(MaxFutureBlockTime).Unix(), now); err != nil {
+		t.Errorf("timestamp MaxFutureBlockTime ahead was rejected: %v", err)
+	}
+	if err := CheckFutureTime(now.Add(MaxFutureBlockTime).Unix()+1, now); err != ErrTimeTooNew {
+		t.Errorf("timestamp past MaxFutureBlockTime gave %v, want ErrTimeTooNew", err)
+	}
+}
+
+func TestAddBlockChecksTimestamp(t *testing.T) {
+	bc, _, alice := newTestChain(t)
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mine := func(timestamp int64) *Block {
+		cb, err := NewCoinbaseTransaction(alice, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return newBlock([]*Transaction{cb}, tip.Hash, tip.Height+1, tip.Bits, timestamp)
+	}
+
+	if err = bc.AddBlock(mine(tip.Timestamp)); err == nil {
+		t.Error("block with the median timestamp was accepted")
+	}
+	if err = bc.AddBlock(mine(time.Now().Add(MaxFutureBlockTime + time.Hour).Unix())); err != ErrTimeTooNew {
+		t.Errorf("block from the future gave %v, want ErrTimeTooNew", err)
+	}
+	if err = bc.AddBlock(mine(tip.Timestamp + 1)); err != nil {
+		t.Errorf("block after the median was rejected: %v", err)
+	}
+}
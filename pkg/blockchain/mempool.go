@@ -0,0 +1,460 @@
+package blockchain
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMempoolMaxSize is the default limit on the total serialized
+	// size of the transactions held in a Mempool
+	DefaultMempoolMaxSize = 32 * 1024 * 1024
+
+	// DefaultMempoolMaxAge is the default time a transaction may wait in a
+	// Mempool before it is evicted
+	DefaultMempoolMaxAge = 72 * time.Hour
+)
+
+// mempoolTx is a transaction waiting in the Mempool
+type mempoolTx struct {
+	tx    *Transaction
+	fee   int
+	size  int
+	added time.Time
+}
+
+// higherFeeRate compares fee rates without dividing by cross multiplying
+func (m *mempoolTx) higherFeeRate(other *mempoolTx) bool {
+	return m.fee*other.size > other.fee*m.size
+}
+
+// Mempool holds validated transactions that are waiting to be mined. It
+// tracks the outpoints spent by each transaction so that conflicting
+// transactions are rejected, and allows transactions to spend the outputs
+// of other unconfirmed transactions in the pool
+type Mempool struct {
+	Blockchain *Blockchain
+	MaxSize    int
+	MaxAge     time.Duration
+
+	mu      sync.Mutex
+	txs     map[string]*mempoolTx
+	spentBy map[string]string
+	size    int
+}
+
+// NewMempool creates an empty Mempool for the blockchain with the default limits
+func NewMempool(bc *Blockchain) *Mempool {
+	return &Mempool{
+		Blockchain: bc,
+		MaxSize:    DefaultMempoolMaxSize,
+		MaxAge:     DefaultMempoolMaxAge,
+		txs:        make(map[string]*mempoolTx),
+		spentBy:    make(map[string]string),
+	}
+}
+
+// Add validates a transaction against the UTXO set and the transactions
+// already in the pool and adds it
+func (mp *Mempool) Add(tx *Transaction) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return mp.add(tx, time.Now())
+}
+
+// Has checks whether a transaction is in the pool
+func (mp *Mempool) Has(txid []byte) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	_, ok := mp.txs[hex.EncodeToString(txid)]
+	return ok
+}
+
+// Get returns a transaction from the pool, or nil if it is not in the pool
+func (mp *Mempool) Get(txid []byte) *Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mtx, ok := mp.txs[hex.EncodeToString(txid)]; ok {
+		return mtx.tx
+	}
+
+	return nil
+}
+
+// Count returns the number of transactions in the pool
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return len(mp.txs)
+}
+
+// Size returns the total serialized size of the transactions in the pool
+func (mp *Mempool) Size() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return mp.size
+}
+
+// Transactions returns every transaction in the pool
+func (mp *Mempool) Transactions() []*Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var txs []*Transaction
+	for _, mtx := range mp.txs {
+		txs = append(txs, mtx.tx)
+	}
+
+	return txs
+}
+
+// BlockTransactions selects transactions for a block template in fee rate
+// order without exceeding maxSize bytes, returning them along with the total
+// fees they pay. A transaction is only selected after all of its unconfirmed
+// parents, so the result can be mined as is
+func (mp *Mempool) BlockTransactions(maxSize int) ([]*Transaction, int) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var selected []*Transaction
+	waiting := make(map[string]int)
+	candidates := &feeRateHeap{}
+	size := 0
+	fees := 0
+
+	for txid, mtx := range mp.txs {
+		parents := len(mp.parents(mtx.tx))
+		if parents == 0 {
+			heap.Push(candidates, mtx)
+		} else {
+			waiting[txid] = parents
+		}
+	}
+
+	for candidates.Len() > 0 {
+		mtx := heap.Pop(candidates).(*mempoolTx)
+		if size+mtx.size > maxSize {
+			continue
+		}
+
+		selected = append(selected, mtx.tx)
+		size += mtx.size
+		fees += mtx.fee
+
+		for _, child := range mp.children(mtx.tx) {
+			childID := hex.EncodeToString(child.tx.ID)
+			waiting[childID]--
+			if waiting[childID] == 0 {
+				heap.Push(candidates, child)
+			}
+		}
+	}
+
+	return selected, fees
+}
+
+// BlockConnected removes the transactions of a newly connected block from
+// the pool, along with any transactions that conflict with them
+func (mp *Mempool) BlockConnected(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		if mtx, ok := mp.txs[hex.EncodeToString(tx.ID)]; ok {
+			mp.remove(mtx)
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for _, vin := range tx.Vin {
+			if txid, ok := mp.spentBy[vin.Outpoint().String()]; ok {
+				mp.removeWithDescendants(mp.txs[txid])
+			}
+		}
+	}
+
+	mp.expire(time.Now())
+}
+
+// BlockDisconnected returns the transactions of a block removed from the
+// best chain to the pool. It must be called after the UTXO set has been
+// rolled back; transactions that are no longer valid are dropped, along
+// with the pool transactions that spent the outputs of the block's coinbase
+// or that cannot be mined at the lower height
+func (mp *Mempool) BlockDisconnected(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			mp.add(tx, time.Now())
+		}
+	}
+
+	mp.revalidate()
+}
+
+func (mp *Mempool) add(tx *Transaction, now time.Time) error {
+	txid := hex.EncodeToString(tx.ID)
+	if _, ok := mp.txs[txid]; ok {
+		return fmt.Errorf("transaction %x is already in the mempool", tx.ID)
+	}
+
+	if tx.IsCoinbase() {
+		return fmt.Errorf("transaction %x is a coinbase", tx.ID)
+	}
+
+	// Transactions are only accepted if they can be in the next block
+	bestHeight, err := mp.Blockchain.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	if !tx.IsFinal(bestHeight + 1) {
+		return fmt.Errorf("transaction %x is locked until height %d", tx.ID, tx.LockTime)
+	}
+
+	for _, vin := range tx.Vin {
+		if other, ok := mp.spentBy[vin.Outpoint().String()]; ok {
+			return fmt.Errorf("transaction %x conflicts with %s in the mempool", tx.ID, other)
+		}
+	}
+
+	if err := mp.Blockchain.checkUnspentOverwrite(tx); err != nil {
+		return err
+	}
+
+	fee, err := checkInputs(tx, make(map[string]bool), mp.findEntry)
+	if err != nil {
+		return err
+	}
+
+	prevTXs := make(map[string]Transaction)
+	for _, vin := range tx.Vin {
+		key := hex.EncodeToString(vin.Txid)
+		if parent, ok := mp.txs[key]; ok {
+			prevTXs[key] = *parent.tx
+			continue
+		}
+
+		prevTX, err := mp.Blockchain.FindTransaction(vin.Txid)
+		if err != nil {
+			return err
+		}
+		prevTXs[key] = prevTX
+	}
+
+	valid, err := tx.Verify(prevTXs)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("transaction %x has an invalid signature", tx.ID)
+	}
+
+	ser, err := tx.Serialize()
+	if err != nil {
+		return err
+	}
+
+	mtx := &mempoolTx{
+		tx:    tx,
+		fee:   fee,
+		size:  len(ser),
+		added: now,
+	}
+	mp.txs[txid] = mtx
+	for _, vin := range tx.Vin {
+		mp.spentBy[vin.Outpoint().String()] = txid
+	}
+	mp.size += mtx.size
+
+	mp.expire(now)
+	mp.trim()
+
+	if _, ok := mp.txs[txid]; !ok {
+		return errors.New("mempool is full")
+	}
+
+	return nil
+}
+
+// findEntry looks up an output in the pool before falling back to the UTXO set
+func (mp *Mempool) findEntry(outpoint Outpoint) (*UTXOEntry, error) {
+	if parent, ok := mp.txs[hex.EncodeToString(outpoint.Txid)]; ok {
+		if outpoint.Vout < 0 || outpoint.Vout >= len(parent.tx.Vout) {
+			return nil, nil
+		}
+
+		return NewUTXOEntry(parent.tx.Vout[outpoint.Vout], -1, false), nil
+	}
+
+	UTXOSet := UTXOSet{
+		Blockchain: mp.Blockchain,
+	}
+
+	return UTXOSet.FindEntry(outpoint)
+}
+
+// poolOutput is an output of a transaction in the pool
+type poolOutput struct {
+	outpoint Outpoint
+	value    int
+}
+
+// unspentOutputs returns the set of outpoints spent by transactions in the
+// pool along with the outputs of pool transactions locked with script that
+// no other pool transaction spends
+func (mp *Mempool) unspentOutputs(script []byte) (map[string]bool, []poolOutput) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	spent := make(map[string]bool)
+	for outpoint := range mp.spentBy {
+		spent[outpoint] = true
+	}
+
+	var outputs []poolOutput
+	for _, mtx := range mp.txs {
+		for outIdx, out := range mtx.tx.Vout {
+			outpoint := Outpoint{Txid: mtx.tx.ID, Vout: outIdx}
+			if bytes.Equal(out.ScriptPubKey, script) && !spent[outpoint.String()] {
+				outputs = append(outputs, poolOutput{outpoint, out.Value})
+			}
+		}
+	}
+
+	return spent, outputs
+}
+
+// parents returns the pool transactions whose outputs tx spends
+func (mp *Mempool) parents(tx *Transaction) []*mempoolTx {
+	var parents []*mempoolTx
+	seen := make(map[string]bool)
+
+	for _, vin := range tx.Vin {
+		txid := hex.EncodeToString(vin.Txid)
+		if parent, ok := mp.txs[txid]; ok && !seen[txid] {
+			parents = append(parents, parent)
+			seen[txid] = true
+		}
+	}
+
+	return parents
+}
+
+// children returns the pool transactions that spend outputs of tx
+func (mp *Mempool) children(tx *Transaction) []*mempoolTx {
+	var children []*mempoolTx
+	seen := make(map[string]bool)
+
+	for outIdx := range tx.Vout {
+		outpoint := Outpoint{Txid: tx.ID, Vout: outIdx}
+		if txid, ok := mp.spentBy[outpoint.String()]; ok && !seen[txid] {
+			children = append(children, mp.txs[txid])
+			seen[txid] = true
+		}
+	}
+
+	return children
+}
+
+func (mp *Mempool) remove(mtx *mempoolTx) {
+	delete(mp.txs, hex.EncodeToString(mtx.tx.ID))
+	for _, vin := range mtx.tx.Vin {
+		delete(mp.spentBy, vin.Outpoint().String())
+	}
+	mp.size -= mtx.size
+}
+
+// removeWithDescendants removes a transaction and every pool transaction
+// that depends on it, as they can no longer be mined
+func (mp *Mempool) removeWithDescendants(mtx *mempoolTx) {
+	children := mp.children(mtx.tx)
+	mp.remove(mtx)
+
+	for _, child := range children {
+		if _, ok := mp.txs[hex.EncodeToString(child.tx.ID)]; ok {
+			mp.removeWithDescendants(child)
+		}
+	}
+}
+
+// revalidate evicts the transactions that spend an output which is no
+// longer in the UTXO set or the pool, or that are not final in the next
+// block, along with their descendants
+func (mp *Mempool) revalidate() {
+	bestHeight, err := mp.Blockchain.GetBestHeight()
+	if err != nil {
+		return
+	}
+
+	for txid, mtx := range mp.txs {
+		if _, ok := mp.txs[txid]; !ok {
+			continue
+		}
+
+		if !mtx.tx.IsFinal(bestHeight + 1) {
+			mp.removeWithDescendants(mtx)
+			continue
+		}
+
+		for _, vin := range mtx.tx.Vin {
+			entry, err := mp.findEntry(vin.Outpoint())
+			if err != nil || entry == nil {
+				mp.removeWithDescendants(mtx)
+				break
+			}
+		}
+	}
+}
+
+// expire evicts transactions that have waited longer than MaxAge
+func (mp *Mempool) expire(now time.Time) {
+	for _, mtx := range mp.txs {
+		if _, ok := mp.txs[hex.EncodeToString(mtx.tx.ID)]; ok && now.Sub(mtx.added) > mp.MaxAge {
+			mp.removeWithDescendants(mtx)
+		}
+	}
+}
+
+// trim evicts the lowest fee rate transactions until the pool fits in MaxSize
+func (mp *Mempool) trim() {
+	for mp.size > mp.MaxSize {
+		var lowest *mempoolTx
+		for _, mtx := range mp.txs {
+			if lowest == nil || lowest.higherFeeRate(mtx) {
+				lowest = mtx
+			}
+		}
+
+		mp.removeWithDescendants(lowest)
+	}
+}
+
+// feeRateHeap orders mempool transactions with the highest fee rate first
+type feeRateHeap []*mempoolTx
+
+func (h feeRateHeap) Len() int            { return len(h) }
+func (h feeRateHeap) Less(i, j int) bool  { return h[i].higherFeeRate(h[j]) }
+func (h feeRateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *feeRateHeap) Push(x interface{}) { *h = append(*h, x.(*mempoolTx)) }
+func (h *feeRateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+
+	return item
+}
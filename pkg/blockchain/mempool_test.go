@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestMempoolBlockDisconnected(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mempool := NewMempool(bc)
+	bc.Subscribe(mempool)
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Block 2 pays alice its coinbase and confirms a payment to bob
+	confirmed := spendOutput(t, wallets, alice, tip.Transactions[0], 0, 40, bob)
+	cb, err := NewCoinbaseTransaction(alice, "", activeNet.Subsidy-40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := bc.MineBlock([]*Transaction{cb, confirmed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pool spends the coinbase of block 2 and, once it is mined, the
+	// payment to bob with a lock time only final above block 2
+	fromCoinbase := spendOutput(t, wallets, alice, cb, 0, 30, carol)
+	descendant := spendOutput(t, wallets, carol, fromCoinbase, 0, 20, bob)
+
+	locked := spendOutput(t, wallets, bob, confirmed, 0, 30, carol)
+	locked.LockTime = block.Height + 1
+	privKey, err := wallets.PrivateKey(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = locked.Sign(privKey, map[string]Transaction{hex.EncodeToString(confirmed.ID): *confirmed}); err != nil {
+		t.Fatal(err)
+	}
+	if err = locked.setID(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tx := range []*Transaction{fromCoinbase, descendant, locked} {
+		if err = mempool.Add(tx); err != nil {
+			t.Fatalf("adding %x to the mempool: %v", tx.ID, err)
+		}
+	}
+
+	if err = bc.disconnectBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mempool.Has(confirmed.ID) {
+		t.Error("transaction of the disconnected block was not returned to the pool")
+	}
+	for _, tx := range []*Transaction{fromCoinbase, descendant} {
+		if mempool.Has(tx.ID) {
+			t.Errorf("transaction %x spending the disconnected coinbase is still in the pool", tx.ID)
+		}
+	}
+	if mempool.Has(locked.ID) {
+		t.Error("transaction locked above the next block is still in the pool")
+	}
+
+	txs, fees := mempool.BlockTransactions(MaxBlockSize)
+	cb, err = NewCoinbaseTransaction(alice, "", fees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.MineBlock(append([]*Transaction{cb}, txs...)); err != nil {
+		t.Fatalf("mining the pool after a disconnect: %v", err)
+	}
+}
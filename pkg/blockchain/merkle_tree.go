@@ -1,12 +1,27 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"fmt"
 )
 
 // MerkleTree represent a Merkle tree
 type MerkleTree struct {
 	RootNode *MerkleNode
+
+	// levels holds the nodes of each level from the leaves up, including
+	// the duplicated last node of a level with an odd number of nodes
+	levels [][]MerkleNode
+	leaves int
+}
+
+// MerkleProof is the path from a leaf to the root of a Merkle tree: the hash
+// of the sibling of each node on the way up. Index is the position of the
+// leaf, and bit i of it says whether the sibling at level i is on the left
+type MerkleProof struct {
+	Index    int
+	Siblings [][]byte
 }
 
 // MerkleNode represent a Merkle tree node
@@ -16,12 +31,14 @@ type MerkleNode struct {
 	Data  []byte
 }
 
-// NewMerkleTree creates a new Merkle tree from a sequence of data
+// NewMerkleTree creates a new Merkle tree from a sequence of data. The tree
+// of no data has a root with no hash and proves nothing
 func NewMerkleTree(data [][]byte) *MerkleTree {
 	var nodes []MerkleNode
+	var levels [][]MerkleNode
 
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		return &MerkleTree{RootNode: &MerkleNode{}}
 	}
 
 	for _, datum := range data {
@@ -29,7 +46,15 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 		nodes = append(nodes, *node)
 	}
 
-	for i := 0; i < len(data)/2; i++ {
+	// Each level pairs up the nodes of the one below, duplicating the last
+	// node when there is an odd number of them. A single leaf is still
+	// paired with itself
+	for {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+		levels = append(levels, nodes)
+
 		var newLevel []MerkleNode
 
 		for j := 0; j < len(nodes); j += 2 {
@@ -37,11 +62,54 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 			newLevel = append(newLevel, *node)
 		}
 		nodes = newLevel
+
+		if len(nodes) == 1 {
+			break
+		}
 	}
 
 	return &MerkleTree{
 		RootNode: &nodes[0],
+		levels:   levels,
+		leaves:   len(data),
+	}
+}
+
+// Proof returns the proof that the leaf at index is in the tree
+func (t *MerkleTree) Proof(index int) (*MerkleProof, error) {
+	if index < 0 || index >= t.leaves {
+		return nil, fmt.Errorf("leaf %d is not in the tree", index)
+	}
+
+	proof := &MerkleProof{Index: index}
+	for _, level := range t.levels {
+		proof.Siblings = append(proof.Siblings, level[index^1].Data)
+		index /= 2
 	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that proof leads from the leaf hash to root. For
+// the Merkle root of a block the leaf hash is the ID of a transaction
+func VerifyMerkleProof(leaf []byte, proof *MerkleProof, root []byte) bool {
+	if proof == nil || proof.Index < 0 || len(proof.Siblings) == 0 {
+		return false
+	}
+
+	hash := leaf
+	index := proof.Index
+	for _, sibling := range proof.Siblings {
+		if index%2 == 0 {
+			hash = hashPair(hash, sibling)
+		} else {
+			hash = hashPair(sibling, hash)
+		}
+		index /= 2
+	}
+
+	// Any bits left in the index would make the proof fit other positions
+	return index == 0 && bytes.Equal(hash, root)
 }
 
 // NewMerkleNode creates a new Merkle tree node
@@ -52,9 +120,7 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 		hash := sha256.Sum256(data)
 		mNode.Data = hash[:]
 	} else {
-		prevHashes := append(left.Data, right.Data...)
-		hash := sha256.Sum256(prevHashes)
-		mNode.Data = hash[:]
+		mNode.Data = hashPair(left.Data, right.Data)
 	}
 
 	mNode.Left = left
@@ -62,3 +128,12 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 
 	return &mNode
 }
+
+func hashPair(left, right []byte) []byte {
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+// testLeaves returns n distinct pieces of data and their leaf hashes
+func testLeaves(n int) ([][]byte, [][]byte) {
+	var data, hashes [][]byte
+	for i := 0; i < n; i++ {
+		datum := []byte(fmt.Sprintf("tx %d", i))
+		hash := sha256.Sum256(datum)
+		data = append(data, datum)
+		hashes = append(hashes, hash[:])
+	}
+
+	return data, hashes
+}
+
+func TestMerkleTreeRoot(t *testing.T) {
+	_, h := testLeaves(3)
+
+	tests := []struct {
+		leaves int
+		root   []byte
+	}{
+		{1, hashPair(h[0], h[0])},
+		{2, hashPair(h[0], h[1])},
+		{3, hashPair(hashPair(h[0], h[1]), hashPair(h[2], h[2]))},
+	}
+
+	for _, test := range tests {
+		data, _ := testLeaves(test.leaves)
+		if root := NewMerkleTree(data).RootNode.Data; !bytes.Equal(root, test.root) {
+			t.Errorf("root of %d leaves is %x, want %x", test.leaves, root, test.root)
+		}
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		data, hashes := testLeaves(n)
+		tree := NewMerkleTree(data)
+		root := tree.RootNode.Data
+
+		for i := 0; i < n; i++ {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("proof of leaf %d of %d: %v", i, n, err)
+			}
+			if !VerifyMerkleProof(hashes[i], proof, root) {
+				t.Errorf("proof of leaf %d of %d does not verify", i, n)
+			}
+			if n > 1 && VerifyMerkleProof(hashes[(i+1)%n], proof, root) {
+				t.Errorf("proof of leaf %d of %d verifies another leaf", i, n)
+			}
+		}
+
+		for _, index := range []int{-1, n} {
+			if _, err := tree.Proof(index); err == nil {
+				t.Errorf("proof of leaf %d of %d was made", index, n)
+			}
+		}
+	}
+}
+
+func TestMerkleProofDuplicatedLastNode(t *testing.T) {
+	data, hashes := testLeaves(3)
+	tree := NewMerkleTree(data)
+
+	// The last leaf of an odd level is its own sibling
+	proof, err := tree.Proof(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof.Siblings[0], hashes[2]) {
+		t.Errorf("sibling of the last leaf is %x, want the leaf itself", proof.Siblings[0])
+	}
+	if !VerifyMerkleProof(hashes[2], proof, tree.RootNode.Data) {
+		t.Error("proof of the last leaf does not verify")
+	}
+
+	single, err := NewMerkleTree(data[:1]).Proof(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.Siblings) != 1 || !bytes.Equal(single.Siblings[0], hashes[0]) {
+		t.Errorf("proof of a single leaf is %x, want the leaf paired with itself", single.Siblings)
+	}
+}
+
+func TestMerkleProofRejectsTampering(t *testing.T) {
+	data, hashes := testLeaves(5)
+	tree := NewMerkleTree(data)
+	root := tree.RootNode.Data
+
+	proof, err := tree.Proof(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for level := range proof.Siblings {
+		tampered := &MerkleProof{Index: proof.Index, Siblings: append([][]byte{}, proof.Siblings...)}
+		tampered.Siblings[level] = append([]byte{}, tampered.Siblings[level]...)
+		tampered.Siblings[level][0] ^= 1
+		if VerifyMerkleProof(hashes[3], tampered, root) {
+			t.Errorf("proof with a tampered sibling at level %d verifies", level)
+		}
+	}
+
+	leftover := &MerkleProof{Index: proof.Index + 1<<uint(len(proof.Siblings)), Siblings: proof.Siblings}
+	if VerifyMerkleProof(hashes[3], leftover, root) {
+		t.Error("proof with bits left in the index verifies")
+	}
+
+	for _, bad := range []*MerkleProof{nil, {Index: 3}, {Index: -1, Siblings: proof.Siblings}} {
+		if VerifyMerkleProof(hashes[3], bad, root) {
+			t.Errorf("proof %+v verifies", bad)
+		}
+	}
+}
+
+func TestEmptyMerkleTree(t *testing.T) {
+	tree := NewMerkleTree(nil)
+	if tree.RootNode.Data != nil {
+		t.Errorf("root of no leaves is %x, want none", tree.RootNode.Data)
+	}
+	if _, err := tree.Proof(0); err == nil {
+		t.Error("proof of a leaf of an empty tree was made")
+	}
+}
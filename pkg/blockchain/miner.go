@@ -0,0 +1,191 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultHashRateInterval is how often a Miner reports its hash rate
+	defaultHashRateInterval = 5 * time.Second
+
+	// cancelCheckInterval is the number of hashes a worker tries between
+	// checks for the search being over
+	cancelCheckInterval = 1 << 16
+)
+
+var maxNonce int64 = math.MaxInt64
+
+// Miner searches for a proof of work for blocks using several goroutines
+type Miner struct {
+	// Workers is the number of goroutines hashing, defaulting to the
+	// number of CPUs
+	Workers int
+
+	// HashRate is called with the number of hashes per second while mining
+	HashRate func(hashesPerSecond float64)
+
+	// HashRateInterval is how often HashRate is called
+	HashRateInterval time.Duration
+}
+
+// DefaultMiner mines on every CPU without reporting its hash rate
+var DefaultMiner = &Miner{}
+
+// Mine searches for a nonce that gives the block a hash below its target,
+// setting the Nonce and Hash of the block when one is found. The nonce space
+// is split between the workers, and once it is exhausted the timestamp is
+// moved forward and the search starts again. Mining stops with the error of
+// ctx if it is cancelled first, such as when a new tip arrives
+func (m *Miner) Mine(ctx context.Context, block *Block) error {
+	workers := m.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var hashes uint64
+	done := make(chan struct{})
+	defer close(done)
+
+	if m.HashRate != nil {
+		go m.reportHashRate(&hashes, done)
+	}
+
+	target := CompactToBig(block.Bits)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		nonce, found := m.search(ctx, block.BlockHeader, target, workers, &hashes)
+		if found {
+			block.Nonce = nonce
+			block.Hash = block.BlockHeader.Hash()
+
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		block.Timestamp = rollTimestamp(block.Timestamp)
+	}
+}
+
+// search tries every nonce for the header, with worker i trying nonces i,
+// i + workers, i + 2 * workers and so on, until one worker finds a solution
+// or the nonce space is exhausted
+func (m *Miner) search(ctx context.Context, header BlockHeader, target *big.Int, workers int, hashes *uint64) (int64, bool) {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var nonce int64
+	found := false
+	stop := make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start int64) {
+			defer wg.Done()
+
+			if n, ok := mineRange(ctx, header, target, start, int64(workers), hashes, stop); ok {
+				once.Do(func() {
+					nonce = n
+					found = true
+					close(stop)
+				})
+			}
+		}(int64(i))
+	}
+
+	wg.Wait()
+
+	return nonce, found
+}
+
+// mineRange hashes the header with nonces from start in steps of step until
+// the hash is below target, the nonce space runs out or stop is closed
+func mineRange(ctx context.Context, header BlockHeader, target *big.Int, start, step int64, hashes *uint64, stop chan struct{}) (int64, bool) {
+	var hashInt big.Int
+
+	// Only the nonce changes, so the header is serialized once and the
+	// nonce in the last 8 bytes is overwritten for each attempt
+	data := header.Serialize()
+	nonceBytes := data[len(data)-8:]
+	tried := uint64(0)
+
+	for nonce := start; nonce <= maxNonce; nonce += step {
+		binary.BigEndian.PutUint64(nonceBytes, uint64(nonce))
+		hash := sha256.Sum256(data)
+		hashInt.SetBytes(hash[:])
+
+		if hashInt.Cmp(target) == -1 {
+			atomic.AddUint64(hashes, tried+1)
+			return nonce, true
+		}
+
+		tried++
+		if tried == cancelCheckInterval {
+			atomic.AddUint64(hashes, tried)
+			tried = 0
+
+			select {
+			case <-stop:
+				return 0, false
+			case <-ctx.Done():
+				return 0, false
+			default:
+			}
+		}
+
+		// Stepping past maxNonce would overflow
+		if nonce > maxNonce-step {
+			break
+		}
+	}
+
+	atomic.AddUint64(hashes, tried)
+
+	return 0, false
+}
+
+func (m *Miner) reportHashRate(hashes *uint64, done chan struct{}) {
+	interval := m.HashRateInterval
+	if interval <= 0 {
+		interval = defaultHashRateInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			count := atomic.SwapUint64(hashes, 0)
+			m.HashRate(float64(count) / now.Sub(last).Seconds())
+			last = now
+		}
+	}
+}
+
+// rollTimestamp returns a new timestamp for a block whose nonce space has
+// been exhausted, which is the current time unless that has not moved on
+func rollTimestamp(timestamp int64) int64 {
+	now := time.Now().Unix()
+	if now > timestamp {
+		return now
+	}
+
+	return timestamp + 1
+}
@@ -0,0 +1,334 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Multisig inputs are built unsigned and signed by each wallet in turn.
+// Until enough signatures are collected, the signature script of an input
+// pushes one signature per key of the redeem script, empty for the keys yet
+// to sign, followed by the redeem script. Once m keys have signed it is the
+// script CHECKMULTISIG accepts: the first m signatures in the order of the
+// keys followed by the redeem script. Signatures sign the transaction
+// without its signature scripts, so adding one leaves the others valid
+
+// AddMultiSig adds the pay-to-script-hash address of a redeem script needing
+// m signatures of pubKeys, in that order, and returns the address. The
+// wallets must be saved for it to last
+func (ws *Wallets) AddMultiSig(m int, pubKeys [][]byte) (string, error) {
+	redeemScript, err := MultiSigScript(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+
+	scriptHash, err := HashPublicKey(redeemScript)
+	if err != nil {
+		return "", err
+	}
+	address := ScriptHashToAddress(scriptHash)
+
+	if ws.Scripts == nil {
+		ws.Scripts = make(map[string][]byte)
+	}
+	ws.Scripts[address] = redeemScript
+
+	return address, nil
+}
+
+// RedeemScript returns the redeem script of a multisig address added to the
+// wallets, or nil if it is not in them
+func (ws *Wallets) RedeemScript(address string) []byte {
+	return ws.Scripts[address]
+}
+
+// NewMultiSigTransaction creates an unsigned transaction paying amount to an
+// address from the outputs paying the hash of a multisig redeem script,
+// with a fee of feeRate coins per 1000 bytes. Change goes back to the
+// multisig address. It is signed with SignMultiSig by enough wallets
+// holding the keys, whose copies can be merged with CombineMultiSig
+func NewMultiSigTransaction(redeemScript []byte, to string, amount, feeRate int, UTXOSet *UTXOSet) (*Transaction, error) {
+	_, pubKeys, err := parseMultiSigScript(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptHash, err := HashPublicKey(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, validOutputs, err := UTXOSet.FindSpendableOutputs(PayToScriptHashScript(scriptHash), amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := EstimateFee(len(validOutputs), 2, feeRate)
+	if acc < amount+fee {
+		return nil, errors.New("not enough funds")
+	}
+
+	tx := &Transaction{}
+	for _, outpoint := range validOutputs {
+		tx.Vin = append(tx.Vin, &TXInput{
+			Txid: outpoint.Txid,
+			Vout: outpoint.Vout,
+		})
+	}
+
+	output, err := NewTXOutput(amount, to)
+	if err != nil {
+		return nil, err
+	}
+	tx.Vout = append(tx.Vout, output)
+	if acc > amount+fee {
+		output, err = NewTXOutput(acc-amount-fee, ScriptHashToAddress(scriptHash))
+		if err != nil {
+			return nil, err
+		}
+		tx.Vout = append(tx.Vout, output)
+	}
+
+	for inID := range tx.Vin {
+		if err = tx.setMultiSigSlots(inID, redeemScript, make([][]byte, len(pubKeys))); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, tx.setID()
+}
+
+// SignMultiSig adds the signatures of the keys in wallets to the multisig
+// inputs of a transaction made by NewMultiSigTransaction that still need
+// them, returning how many were added. It fails with ErrWalletLocked if a
+// key is needed while the wallets are encrypted and locked
+func (ws *Wallets) SignMultiSig(tx *Transaction) (int, error) {
+	signed := 0
+
+	for inID := range tx.Vin {
+		redeemScript, sigs, err := tx.multiSigSlots(inID)
+		if err != nil {
+			return 0, err
+		}
+		m, pubKeys, err := parseMultiSigScript(redeemScript)
+		if err != nil {
+			return 0, err
+		}
+		if countSignatures(sigs) >= m {
+			continue
+		}
+
+		hash, err := tx.signatureHash(inID, redeemScript)
+		if err != nil {
+			return 0, err
+		}
+
+		for k, pubKey := range pubKeys {
+			if sigs[k] != nil || countSignatures(sigs) == m {
+				continue
+			}
+
+			pubKeyHash, err := HashPublicKey(pubKey)
+			if err != nil {
+				return 0, err
+			}
+			address := PubKeyHashToAddress(pubKeyHash)
+			if ws.GetWallet(address) == nil {
+				continue
+			}
+
+			privKey, err := ws.PrivateKey(address)
+			if err != nil {
+				return 0, err
+			}
+
+			if sigs[k], err = privKey.Sign(hash); err != nil {
+				return 0, err
+			}
+			signed++
+		}
+
+		if err = tx.setMultiSigSlots(inID, redeemScript, sigs); err != nil {
+			return 0, err
+		}
+	}
+
+	return signed, tx.setID()
+}
+
+// CombineMultiSig merges the signatures of copies of the same multisig
+// transaction signed by different wallets into one transaction
+func CombineMultiSig(txs []*Transaction) (*Transaction, error) {
+	if len(txs) == 0 {
+		return nil, errors.New("no transactions to combine")
+	}
+
+	ser, err := txs[0].Serialize()
+	if err != nil {
+		return nil, err
+	}
+	combined, err := DeserializeTransaction(ser)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := combined.TrimmedCopy()
+	want, err := trimmed.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range txs[1:] {
+		trimmed := tx.TrimmedCopy()
+		hash, err := trimmed.Hash()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(hash, want) {
+			return nil, errors.New("transactions do not spend and pay the same")
+		}
+	}
+
+	for inID := range combined.Vin {
+		redeemScript, sigs, err := combined.multiSigSlots(inID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range txs[1:] {
+			other, otherSigs, err := tx.multiSigSlots(inID)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(other, redeemScript) {
+				return nil, fmt.Errorf("input %d has different redeem scripts", inID)
+			}
+
+			for k, sig := range otherSigs {
+				if sigs[k] == nil {
+					sigs[k] = sig
+				}
+			}
+		}
+
+		if err = combined.setMultiSigSlots(inID, redeemScript, sigs); err != nil {
+			return nil, err
+		}
+	}
+
+	return combined, combined.setID()
+}
+
+// IsMultiSigComplete reports whether every multisig input of a transaction
+// has as many signatures as its redeem script needs
+func (tx *Transaction) IsMultiSigComplete() (bool, error) {
+	for inID := range tx.Vin {
+		redeemScript, sigs, err := tx.multiSigSlots(inID)
+		if err != nil {
+			return false, err
+		}
+		m, _, err := parseMultiSigScript(redeemScript)
+		if err != nil {
+			return false, err
+		}
+
+		if countSignatures(sigs) < m {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// multiSigSlots returns the redeem script of a multisig input and the
+// signature of each of its keys so far, nil for the keys yet to sign
+func (tx *Transaction) multiSigSlots(inID int) ([]byte, [][]byte, error) {
+	ops, err := parseScript(tx.Vin[inID].ScriptSig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ops) == 0 || !IsPushOnly(tx.Vin[inID].ScriptSig) {
+		return nil, nil, fmt.Errorf("input %d is not a multisig input", inID)
+	}
+
+	redeemScript := ops[len(ops)-1].data
+	_, pubKeys, err := parseMultiSigScript(redeemScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("input %d: %v", inID, err)
+	}
+
+	hash, err := tx.signatureHash(inID, redeemScript)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The signature scripts do not record which key made each signature,
+	// so it is found by checking the signature against the keys
+	sigs := make([][]byte, len(pubKeys))
+	for _, op := range ops[:len(ops)-1] {
+		if len(op.data) == 0 {
+			continue
+		}
+
+		k := 0
+		for k < len(pubKeys) && (sigs[k] != nil || !VerifySignature(pubKeys[k], hash, op.data)) {
+			k++
+		}
+		if k == len(pubKeys) {
+			return nil, nil, fmt.Errorf("input %d has a signature made by none of its keys", inID)
+		}
+		sigs[k] = op.data
+	}
+
+	return redeemScript, sigs, nil
+}
+
+// setMultiSigSlots sets the signature script of a multisig input from the
+// signature of each key, in the form CHECKMULTISIG accepts once there are
+// enough of them
+func (tx *Transaction) setMultiSigSlots(inID int, redeemScript []byte, sigs [][]byte) error {
+	m, _, err := parseMultiSigScript(redeemScript)
+	if err != nil {
+		return err
+	}
+	complete := countSignatures(sigs) >= m
+
+	var scriptSig []byte
+	pushed := 0
+	for _, sig := range sigs {
+		if complete {
+			if sig == nil || pushed == m {
+				continue
+			}
+			pushed++
+		}
+		scriptSig = appendPush(scriptSig, sig)
+	}
+	tx.Vin[inID].ScriptSig = appendPush(scriptSig, redeemScript)
+
+	return nil
+}
+
+// setID sets the ID of a transaction to its hash, which changes with every
+// signature added
+func (tx *Transaction) setID() error {
+	id, err := tx.Hash()
+	if err != nil {
+		return err
+	}
+	tx.ID = id
+
+	return nil
+}
+
+func countSignatures(sigs [][]byte) int {
+	n := 0
+	for _, sig := range sigs {
+		if sig != nil {
+			n++
+		}
+	}
+
+	return n
+}
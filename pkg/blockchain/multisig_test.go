@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestMultiSigSpend(t *testing.T) {
+	bc, miner, alice := newTestChain(t)
+
+	// Each key of the 2 of 3 address is held by a separate wallet
+	var holders []*Wallets
+	var pubKeys [][]byte
+	for i := 0; i < 3; i++ {
+		wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+		address, err := wallets.CreateWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		holders = append(holders, wallets)
+		pubKeys = append(pubKeys, wallets.GetWallet(address).PublicKey)
+	}
+
+	var address string
+	for _, wallets := range holders {
+		added, err := wallets.AddMultiSig(2, pubKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if address != "" && added != address {
+			t.Fatalf("holders created different addresses %s and %s", address, added)
+		}
+		address = added
+	}
+	redeemScript := holders[0].RedeemScript(address)
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	fund, err := NewUTXOTransaction(miner, alice, address, 30, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.MineBlock([]*Transaction{coinbase(t, alice, 0), fund}); err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned, err := NewMultiSigTransaction(redeemScript, alice, 20, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first and last holders sign copies of the unsigned transaction
+	var signed []*Transaction
+	for _, wallets := range []*Wallets{holders[0], holders[2]} {
+		ser, err := unsigned.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := DeserializeTransaction(ser)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := wallets.SignMultiSig(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("holder added %d signatures, want 1", n)
+		}
+		signed = append(signed, tx)
+	}
+
+	complete, err := signed[0].IsMultiSigComplete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete {
+		t.Fatal("transaction with one signature is complete")
+	}
+	if valid, err := bc.VerifyTransaction(signed[0]); err == nil && valid {
+		t.Fatal("transaction with one signature verified")
+	}
+
+	combined, err := CombineMultiSig(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete, err = combined.IsMultiSigComplete(); err != nil || !complete {
+		t.Fatalf("combined transaction is not complete: %v", err)
+	}
+	if valid, err := bc.VerifyTransaction(combined); err != nil || !valid {
+		t.Fatalf("combined transaction did not verify: %v", err)
+	}
+
+	// Signatures must be in the order of the keys
+	_, sigs, err := combined.multiSigSlots(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigs[0] == nil || sigs[1] != nil || sigs[2] == nil {
+		t.Fatal("signatures are not in the slots of the keys that made them")
+	}
+	reordered := *combined
+	reordered.Vin = []*TXInput{{Txid: combined.Vin[0].Txid, Vout: combined.Vin[0].Vout}}
+	reordered.Vin[0].ScriptSig = pushes(sigs[2], sigs[0], redeemScript)
+	if valid, err := bc.VerifyTransaction(&reordered); err == nil && valid {
+		t.Fatal("transaction with signatures out of order verified")
+	}
+
+	if _, err = bc.MineBlock([]*Transaction{coinbase(t, alice, 0), combined}); err != nil {
+		t.Fatalf("mining the multisig spend: %v", err)
+	}
+}
+
+func TestCombineMultiSigRejectsDifferentTransactions(t *testing.T) {
+	bc, miner, alice := newTestChain(t)
+
+	wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+	holder, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.AddMultiSig(1, [][]byte{wallets.GetWallet(holder).PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	fund, err := NewUTXOTransaction(miner, alice, address, 30, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.MineBlock([]*Transaction{coinbase(t, alice, 0), fund}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewMultiSigTransaction(wallets.RedeemScript(address), alice, 20, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewMultiSigTransaction(wallets.RedeemScript(address), alice, 10, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = CombineMultiSig([]*Transaction{a, b}); err == nil {
+		t.Fatal("transactions paying different amounts were combined")
+	}
+}
@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Outpoint references a single output of a transaction
+type Outpoint struct {
+	Txid []byte
+	Vout int
+}
+
+// Key returns the outpoint as a UTXO set key, the transaction ID followed by
+// the big endian output index
+func (o Outpoint) Key() []byte {
+	key := make([]byte, len(o.Txid)+4)
+	copy(key, o.Txid)
+	binary.BigEndian.PutUint32(key[len(o.Txid):], uint32(o.Vout))
+
+	return key
+}
+
+// String returns a human-readable representation of an outpoint
+func (o Outpoint) String() string {
+	return fmt.Sprintf("%x:%d", o.Txid, o.Vout)
+}
+
+// OutpointFromKey decodes an outpoint from a UTXO set key
+func OutpointFromKey(key []byte) (Outpoint, error) {
+	if len(key) <= 4 {
+		return Outpoint{}, errors.New("outpoint key is too short")
+	}
+
+	txid := make([]byte, len(key)-4)
+	copy(txid, key)
+
+	return Outpoint{
+		Txid: txid,
+		Vout: int(binary.BigEndian.Uint32(key[len(txid):])),
+	}, nil
+}
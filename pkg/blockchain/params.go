@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// NetParams holds everything that differs between networks. Chains, wallets
+// and peers of different networks cannot be mixed: blocks are checked
+// against the limits of the network, addresses carry its version byte and
+// messages its magic
+type NetParams struct {
+	// Name identifies the network on the command line
+	Name string
+
+	// Magic starts every message sent between peers of the network
+	Magic uint32
+
+	// AddressVersion is the first byte of the addresses of the network
+	// paying a public key hash
+	AddressVersion byte
+
+	// ScriptHashAddressVersion is the first byte of the addresses of the
+	// network paying a script hash
+	ScriptHashAddressVersion byte
+
+	// GenesisCoinbaseData is the data in the coinbase of the genesis block
+	GenesisCoinbaseData string
+
+	// GenesisTimestamp, GenesisBits and GenesisNonce complete the header of
+	// the genesis block, which GenesisBlock builds
+	GenesisTimestamp int64
+	GenesisBits      uint32
+	GenesisNonce     int64
+
+	// GenesisHash is the hash of the genesis block in hex. Blockchains and
+	// header chains starting from any other block are rejected
+	GenesisHash string
+
+	// PowLimitBits is the easiest target a block may use
+	PowLimitBits uint32
+
+	// NoRetargeting keeps the target of the genesis block for every block,
+	// so that blocks can be mined on demand for testing
+	NoRetargeting bool
+
+	// Subsidy is the number of new coins the coinbase of a block may claim
+	Subsidy int
+
+	// DataSubdir is where the files of the network are kept within the data
+	// directory, which is the data directory itself for the main network
+	DataSubdir string
+}
+
+// MainNetParams are the parameters of the main network, which are the ones
+// used before networks could be chosen
+var MainNetParams = &NetParams{
+	Name:                     "mainnet",
+	Magic:                    0x7463626b,
+	AddressVersion:           0x00,
+	ScriptHashAddressVersion: 0x05,
+	GenesisCoinbaseData:      "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+	GenesisTimestamp:         1514764800,
+	GenesisBits:              DefaultGenesisBits,
+	GenesisNonce:             31975377,
+	GenesisHash:              "000000ef1eb56e418f355b9760afb9d557db22cee9e4ba5ea21944de985d37cb",
+	PowLimitBits:             0x207fffff,
+	Subsidy:                  10,
+	DataSubdir:               "",
+}
+
+// TestNetParams are the parameters of the public test network, whose coins
+// have no value
+var TestNetParams = &NetParams{
+	Name:                     "testnet",
+	Magic:                    0x74637473,
+	AddressVersion:           0x6f,
+	ScriptHashAddressVersion: 0xc4,
+	GenesisCoinbaseData:      "Test network genesis block",
+	GenesisTimestamp:         1514764800,
+	GenesisBits:              0x1f100000,
+	GenesisNonce:             13019,
+	GenesisHash:              "0004894283f429192b57231d80ccf9fb07ba0dd1092d2b849e198437bcf0f40a",
+	PowLimitBits:             0x207fffff,
+	Subsidy:                  10,
+	DataSubdir:               "testnet",
+}
+
+// RegTestParams are the parameters of a private network for regression
+// testing, where blocks are mined instantly at the easiest target
+var RegTestParams = &NetParams{
+	Name:                     "regtest",
+	Magic:                    0x74637267,
+	AddressVersion:           0x6f,
+	ScriptHashAddressVersion: 0xc4,
+	GenesisCoinbaseData:      "Regression test genesis block",
+	GenesisTimestamp:         1514764800,
+	GenesisBits:              0x207fffff,
+	GenesisNonce:             1,
+	GenesisHash:              "10a987d23a55d8759042c7325f3333fbba47d66e7dd10468e2e7be7b9f9922f3",
+	PowLimitBits:             0x207fffff,
+	NoRetargeting:            true,
+	Subsidy:                  50,
+	DataSubdir:               "regtest",
+}
+
+var (
+	activeNet = MainNetParams
+	dataDir   = "."
+)
+
+// NetParamsByName returns the parameters of the network with the given name
+func NetParamsByName(name string) (*NetParams, error) {
+	for _, params := range []*NetParams{MainNetParams, TestNetParams, RegTestParams} {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown network %q, expected mainnet, testnet or regtest", name)
+}
+
+// UseNetwork selects the network and the data directory its files are kept
+// under, creating the directory if needed. It must be called before any
+// blockchain or wallet is opened
+func UseNetwork(params *NetParams, dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, params.DataSubdir), 0700); err != nil {
+		return err
+	}
+
+	activeNet = params
+	dataDir = dir
+
+	return nil
+}
+
+// ActiveNetwork returns the parameters of the selected network
+func ActiveNetwork() *NetParams {
+	return activeNet
+}
+
+// DataPath returns the path of a file of the selected network
+func DataPath(name string) string {
+	return filepath.Join(dataDir, activeNet.DataSubdir, name)
+}
+
+// IsRetargetHeight reports whether the target is adjusted at a block height
+func IsRetargetHeight(height int) bool {
+	return !activeNet.NoRetargeting && height%RetargetInterval == 0
+}
@@ -0,0 +1,508 @@
+package blockchain
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ChainListener is notified whenever a block is connected to or
+// disconnected from the best chain
+type ChainListener interface {
+	BlockConnected(block *Block)
+	BlockDisconnected(block *Block)
+}
+
+// Subscribe registers a listener for changes to the best chain
+func (bc *Blockchain) Subscribe(listener ChainListener) {
+	bc.listeners = append(bc.listeners, listener)
+}
+
+// AddBlock stores a block whose parent is already known. Blocks on a side
+// chain are kept, and once a side chain has more cumulative work than the
+// best chain the blockchain reorganises onto it
+func (bc *Blockchain) AddBlock(block *Block) error {
+	if err := checkBlock(block); err != nil {
+		// A block ahead of the local clock becomes valid as time passes
+		if err == ErrTimeTooNew {
+			return err
+		}
+
+		return ruleError{err}
+	}
+
+	// Every blockchain is created with the genesis block of the network,
+	// so any other block claiming to start a chain is rejected
+	if block.Height == 0 || len(block.PrevBlockHash) == 0 {
+		if err := CheckGenesisHash(block.Hash); err != nil {
+			return ruleError{err}
+		}
+	}
+
+	var entry *blockIndexEntry
+	var best *blockIndexEntry
+
+	err := bc.DB.Update(func(tx *bolt.Tx) error {
+		existing, err := getBlockIndexEntry(tx, block.Hash)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return errors.Errorf("block %x is already known", block.Hash)
+		}
+
+		parent, err := getBlockIndexEntry(tx, block.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if parent == nil {
+			return errors.Errorf("parent of block %x is not known", block.Hash)
+		}
+
+		if block.Height != parent.Height+1 {
+			return ruleError{errors.Errorf("block %x has height %d, expected %d", block.Hash, block.Height, parent.Height+1)}
+		}
+
+		bits, err := NextBits(block.PrevBlockHash, indexLookup(tx))
+		if err != nil {
+			return err
+		}
+		if block.Bits != bits {
+			return ruleError{errors.Errorf("block %x has target %08x, expected %08x", block.Hash, block.Bits, bits)}
+		}
+
+		past, err := PastTimestamps(block.PrevBlockHash, indexLookup(tx))
+		if err != nil {
+			return err
+		}
+		if err = CheckMedianTime(block.Timestamp, past); err != nil {
+			return ruleError{errors.Wrapf(err, "block %x", block.Hash)}
+		}
+
+		entry = newBlockIndexEntry(block, parent)
+		entry.Invalid = parent.Invalid
+
+		ser, err := block.Serialize()
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Bucket([]byte(blocksBucket)).Put(block.Hash, ser); err != nil {
+			return err
+		}
+
+		if err = putBlockIndexEntry(tx, block.Hash, entry); err != nil {
+			return err
+		}
+
+		best, err = getBlockIndexEntry(tx, bc.tip)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if entry.Invalid {
+		return ruleError{errors.Errorf("block %x extends an invalid block", block.Hash)}
+	}
+
+	if entry.work().Cmp(best.work()) <= 0 {
+		return nil
+	}
+
+	return bc.reorganize(block.Hash)
+}
+
+// reorganize makes newTip the tip of the best chain, disconnecting blocks
+// back to the fork point and connecting the blocks of the new branch. If a
+// block on the new branch turns out to be invalid the previous best chain
+// is restored
+func (bc *Blockchain) reorganize(newTip []byte) error {
+	detach, attach, err := bc.findFork(bc.tip, newTip)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range detach {
+		if err = bc.disconnectBlock(hash); err != nil {
+			return err
+		}
+	}
+
+	for i, hash := range attach {
+		connectErr := bc.connectBlock(hash)
+		if connectErr == nil {
+			continue
+		}
+
+		// Only a block breaking the rules is marked invalid. Other failures,
+		// such as those of the database, say nothing about the block
+		if IsRuleError(connectErr) {
+			if err = bc.markInvalid(hash); err != nil {
+				return err
+			}
+		}
+
+		for j := i - 1; j >= 0; j-- {
+			if err = bc.disconnectBlock(attach[j]); err != nil {
+				return err
+			}
+		}
+
+		for j := len(detach) - 1; j >= 0; j-- {
+			if err = bc.connectBlock(detach[j]); err != nil {
+				return err
+			}
+		}
+
+		return connectErr
+	}
+
+	return nil
+}
+
+// findFork returns the blocks to disconnect from oldTip, tip first, and
+// the blocks to connect to reach newTip, oldest first
+func (bc *Blockchain) findFork(oldTip, newTip []byte) ([][]byte, [][]byte, error) {
+	var detach [][]byte
+	var attach [][]byte
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		oldHash, newHash := oldTip, newTip
+
+		oldEntry, err := getBlockIndexEntry(tx, oldHash)
+		if err != nil {
+			return err
+		}
+		newEntry, err := getBlockIndexEntry(tx, newHash)
+		if err != nil {
+			return err
+		}
+
+		for !bytes.Equal(oldHash, newHash) {
+			if oldEntry.Height >= newEntry.Height {
+				detach = append(detach, oldHash)
+				oldHash = oldEntry.PrevHash
+				if oldEntry, err = getBlockIndexEntry(tx, oldHash); err != nil {
+					return err
+				}
+			} else {
+				attach = append(attach, newHash)
+				newHash = newEntry.PrevHash
+				if newEntry, err = getBlockIndexEntry(tx, newHash); err != nil {
+					return err
+				}
+			}
+
+			if oldEntry == nil || newEntry == nil {
+				return errors.New("chains do not share a common block")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, j := 0, len(attach)-1; i < j; i, j = i+1, j-1 {
+		attach[i], attach[j] = attach[j], attach[i]
+	}
+
+	return detach, attach, nil
+}
+
+// connectBlock validates a stored block against the UTXO set and connects
+// it to the tip of the best chain, saving undo data for the outputs it spends
+func (bc *Blockchain) connectBlock(hash []byte) error {
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(block.PrevBlockHash, bc.tip) {
+		return errors.Errorf("block %x does not extend the current tip", hash)
+	}
+
+	// Bodies are checked against their header before they are stored, but
+	// a database written before duplicate transactions were rejected may
+	// hold a malleated body, which does not make the header invalid
+	if err = checkMerkleRoot(block); err != nil {
+		return errors.Wrapf(err, "stored block %x", hash)
+	}
+
+	if err = bc.validateTransactions(block.Transactions, block.Height); err != nil {
+		return ruleError{err}
+	}
+
+	err = bc.DB.Update(func(tx *bolt.Tx) error {
+		entry, err := getBlockIndexEntry(tx, hash)
+		if err != nil {
+			return err
+		}
+
+		UTXOSet := UTXOSet{
+			Blockchain: bc,
+		}
+		undo, err := UTXOSet.connect(tx, block, entry.Height)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Bucket([]byte(undoBucket)).Put(hash, undo.serialize()); err != nil {
+			return err
+		}
+
+		if err = putHeightIndexHash(tx, entry.Height, hash); err != nil {
+			return err
+		}
+
+		if err = indexTransactions(tx, block); err != nil {
+			return err
+		}
+
+		if err = indexAddresses(tx, block, undo); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte(blocksBucket)).Put([]byte("l"), hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.setTip(hash)
+	for _, listener := range bc.listeners {
+		listener.BlockConnected(block)
+	}
+
+	return nil
+}
+
+// disconnectBlock removes the block at the tip of the best chain, restoring
+// the outputs it spent from its undo data
+func (bc *Blockchain) disconnectBlock(hash []byte) error {
+	if !bytes.Equal(hash, bc.tip) {
+		return errors.Errorf("block %x is not the current tip", hash)
+	}
+
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		return err
+	}
+
+	err = bc.DB.Update(func(tx *bolt.Tx) error {
+		undo, err := getBlockUndo(tx, hash)
+		if err != nil {
+			return err
+		}
+
+		UTXOSet := UTXOSet{
+			Blockchain: bc,
+		}
+		if err = UTXOSet.disconnect(tx, block, undo); err != nil {
+			return err
+		}
+
+		if err = deleteHeightIndexHash(tx, block.Height); err != nil {
+			return err
+		}
+
+		if err = unindexTransactions(tx, block); err != nil {
+			return err
+		}
+
+		if err = unindexAddresses(tx, block, undo); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte(blocksBucket)).Put([]byte("l"), block.PrevBlockHash)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.setTip(block.PrevBlockHash)
+	for _, listener := range bc.listeners {
+		listener.BlockDisconnected(block)
+	}
+
+	return nil
+}
+
+// ruleError is returned for a block that breaks the consensus rules, as
+// opposed to one that could not be checked or stored
+type ruleError struct {
+	error
+}
+
+// IsRuleError reports whether an error returned by AddBlock means that the
+// block breaks the consensus rules, so that whoever sent it can be blamed
+func IsRuleError(err error) bool {
+	_, ok := err.(ruleError)
+	return ok
+}
+
+// markInvalid flags a block and every stored block built on it so that none
+// of them becomes part of the best chain, and blocks later built on them are
+// rejected without a reorganisation. The body of a block is checked against
+// its header before it is stored, so a block failing validation marks its
+// hash invalid rather than just the body that was received
+func (bc *Blockchain) markInvalid(hash []byte) error {
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		entry, err := getBlockIndexEntry(tx, hash)
+		if err != nil {
+			return err
+		}
+
+		// Descendants are found by height, so each is visited after its parent
+		var later []indexedBlock
+		err = tx.Bucket([]byte(blockIndexBucket)).ForEach(func(k, v []byte) error {
+			other, err := deserializeBlockIndexEntry(v)
+			if err != nil {
+				return err
+			}
+			if other.Height > entry.Height {
+				later = append(later, indexedBlock{append([]byte{}, k...), other})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(later, func(i, j int) bool { return later[i].entry.Height < later[j].entry.Height })
+
+		entry.Invalid = true
+		if err = putBlockIndexEntry(tx, hash, entry); err != nil {
+			return err
+		}
+
+		invalid := map[string]bool{string(hash): true}
+		for _, block := range later {
+			if !invalid[string(block.entry.PrevHash)] {
+				continue
+			}
+
+			invalid[string(block.hash)] = true
+			block.entry.Invalid = true
+			if err = putBlockIndexEntry(tx, block.hash, block.entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// indexedBlock is a block index entry along with the hash of its block
+type indexedBlock struct {
+	hash  []byte
+	entry *blockIndexEntry
+}
+
+// migrateBlockIndex builds the block index and undo data for a database
+// created before side chains were supported by replaying the blocks of the
+// best chain from genesis, which also rebuilds the UTXO set
+func (bc *Blockchain) migrateBlockIndex() error {
+	var hashes [][]byte
+	indexed := false
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		indexed = tx.Bucket([]byte(blockIndexBucket)) != nil
+
+		return nil
+	})
+	if err != nil || indexed {
+		return err
+	}
+
+	bci := bc.Iterator()
+	for {
+		b, err := bci.Next()
+		if err != nil {
+			return err
+		}
+
+		hashes = append([][]byte{b.Hash}, hashes...)
+
+		if len(b.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		if err := createChainBuckets(tx); err != nil {
+			return err
+		}
+
+		var parent *blockIndexEntry
+		for _, hash := range hashes {
+			block, err := DeserializeBlock(tx.Bucket([]byte(blocksBucket)).Get(hash))
+			if err != nil {
+				return err
+			}
+
+			if parent, err = bc.initBlock(tx, block, parent); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// initBlock indexes a block and connects it to the UTXO set without
+// validation, for blocks that were accepted when the chain was created
+func (bc *Blockchain) initBlock(tx *bolt.Tx, block *Block, parent *blockIndexEntry) (*blockIndexEntry, error) {
+	entry := newBlockIndexEntry(block, parent)
+	if err := putBlockIndexEntry(tx, block.Hash, entry); err != nil {
+		return nil, err
+	}
+
+	UTXOSet := UTXOSet{
+		Blockchain: bc,
+	}
+	undo, err := UTXOSet.connect(tx, block, entry.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Bucket([]byte(undoBucket)).Put(block.Hash, undo.serialize()); err != nil {
+		return nil, err
+	}
+
+	if err = putHeightIndexHash(tx, entry.Height, block.Hash); err != nil {
+		return nil, err
+	}
+
+	if err = indexTransactions(tx, block); err != nil {
+		return nil, err
+	}
+
+	if err = indexAddresses(tx, block, undo); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// createChainBuckets creates empty block index, height index, undo and UTXO
+// buckets, replacing any UTXO set that already exists
+func createChainBuckets(tx *bolt.Tx) error {
+	for _, name := range []string{utxoBucket, utxoMetaBucket} {
+		if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+
+	for _, name := range []string{blockIndexBucket, heightIndexBucket, undoBucket, utxoBucket, utxoMetaBucket} {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket([]byte(utxoMetaBucket)).Put(utxoVersionKey, encodeUint32(utxoVersion))
+}
@@ -0,0 +1,254 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// buildBlock mines a block of txs on parent, whichever chain it is on
+func buildBlock(parent *Block, txs ...*Transaction) *Block {
+	return newBlock(txs, parent.Hash, parent.Height+1, parent.Bits, parent.Timestamp+1)
+}
+
+// coinbase returns a coinbase paying to an address the subsidy and fees
+func coinbase(t *testing.T, to string, fees int) *Transaction {
+	cb, err := NewCoinbaseTransaction(to, "", fees)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cb
+}
+
+// checkOutput checks whether an output is in the UTXO set
+func checkOutput(t *testing.T, bc *Blockchain, tx *Transaction, vout int, unspent bool) {
+	t.Helper()
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	entry, err := UTXOSet.FindEntry(Outpoint{Txid: tx.ID, Vout: vout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (entry != nil) != unspent {
+		t.Errorf("output %x:%d unspent is %v, want %v", tx.ID, vout, entry != nil, unspent)
+	}
+}
+
+// checkBestChain checks that the height index holds each of blocks at its
+// height and that the last of them is the tip
+func checkBestChain(t *testing.T, bc *Blockchain, blocks ...*Block) {
+	t.Helper()
+
+	for _, block := range blocks {
+		hash, err := bc.GetBlockHashByHeight(block.Height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hash, block.Hash) {
+			t.Errorf("block at height %d is %x, want %x", block.Height, hash, block.Hash)
+		}
+	}
+
+	tip := blocks[len(blocks)-1]
+	if !bytes.Equal(bc.GetBestBlockHash(), tip.Hash) {
+		t.Errorf("tip is %x, want %x", bc.GetBestBlockHash(), tip.Hash)
+	}
+	if _, err := bc.GetBlockHashByHeight(tip.Height + 1); err == nil {
+		t.Errorf("height index has a block above the tip at height %d", tip.Height)
+	}
+}
+
+// checkIndexedTransaction checks whether the transaction index finds a
+// transaction and, if so, in which block
+func checkIndexedTransaction(t *testing.T, bc *Blockchain, tx *Transaction, block *Block) {
+	t.Helper()
+
+	found, _, indexed, err := bc.lookupTransaction(tx.ID)
+	if !indexed {
+		t.Fatal("transaction index is not built")
+	}
+	if block == nil {
+		if err == nil {
+			t.Errorf("transaction %x is still indexed", tx.ID)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("looking up %x: %v", tx.ID, err)
+	}
+	if !bytes.Equal(found.Hash, block.Hash) {
+		t.Errorf("transaction %x is indexed in block %x, want %x", tx.ID, found.Hash, block.Hash)
+	}
+}
+
+// checkBalance checks the sum of the history of an address and the number
+// of transactions in it
+func checkBalance(t *testing.T, bc *Blockchain, address string, txs, balance int) {
+	t.Helper()
+
+	script, err := PayToAddressScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := bc.AddressHistory(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := 0
+	for _, entry := range history {
+		sum += entry.Delta
+	}
+	if len(history) != txs || sum != balance {
+		t.Errorf("history of %s has %d transactions summing to %d, want %d summing to %d", address, len(history), sum, txs, balance)
+	}
+}
+
+func TestReorganizeOntoLongerSideChain(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.ReindexAddresses(); err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsidy := activeNet.Subsidy
+
+	// The best chain pays bob from the coinbase of the fork point
+	payBob := spendOutput(t, wallets, alice, fork.Transactions[0], 0, 40, bob)
+	mainTip := buildBlock(fork, coinbase(t, alice, subsidy-40), payBob)
+	if err = bc.AddBlock(mainTip); err != nil {
+		t.Fatal(err)
+	}
+
+	// The side chain spends the same output to carol instead
+	payCarol := spendOutput(t, wallets, alice, fork.Transactions[0], 0, 30, carol)
+	side1 := buildBlock(fork, coinbase(t, carol, subsidy-30), payCarol)
+	if err = bc.AddBlock(side1); err != nil {
+		t.Fatal(err)
+	}
+	checkBestChain(t, bc, fork, mainTip)
+
+	side2 := buildBlock(side1, coinbase(t, carol, 0))
+	if err = bc.AddBlock(side2); err != nil {
+		t.Fatalf("side chain with more work: %v", err)
+	}
+
+	checkBestChain(t, bc, fork, side1, side2)
+
+	checkOutput(t, bc, fork.Transactions[0], 0, false)
+	checkOutput(t, bc, payBob, 0, false)
+	checkOutput(t, bc, mainTip.Transactions[0], 0, false)
+	checkOutput(t, bc, payCarol, 0, true)
+	checkOutput(t, bc, side1.Transactions[0], 0, true)
+	checkOutput(t, bc, side2.Transactions[0], 0, true)
+
+	checkIndexedTransaction(t, bc, payBob, nil)
+	checkIndexedTransaction(t, bc, mainTip.Transactions[0], nil)
+	checkIndexedTransaction(t, bc, payCarol, side1)
+	checkIndexedTransaction(t, bc, side2.Transactions[0], side2)
+
+	checkBalance(t, bc, alice, 2, 0)
+	checkBalance(t, bc, bob, 0, 0)
+	checkBalance(t, bc, carol, 3, 3*subsidy)
+}
+
+func TestReorganizeRestoresChainOnInvalidBlock(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.ReindexAddresses(); err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsidy := activeNet.Subsidy
+
+	payBob := spendOutput(t, wallets, alice, fork.Transactions[0], 0, 40, bob)
+	main1 := buildBlock(fork, coinbase(t, alice, subsidy-40), payBob)
+	main2 := buildBlock(main1, coinbase(t, alice, 0))
+	main3 := buildBlock(main2, coinbase(t, alice, 0))
+	for _, block := range []*Block{main1, main2, main3} {
+		if err = bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second block of the side chain claims more than the subsidy,
+	// which is only found once the side chain is connected
+	side1 := buildBlock(fork, coinbase(t, bob, 0))
+	side2 := buildBlock(side1, coinbase(t, bob, 1))
+	side3 := buildBlock(side2, coinbase(t, bob, 0))
+	for _, block := range []*Block{side1, side2, side3} {
+		if err = bc.AddBlock(block); err != nil {
+			t.Fatalf("storing side chain block: %v", err)
+		}
+	}
+
+	side4 := buildBlock(side3, coinbase(t, bob, 0))
+	if err = bc.AddBlock(side4); err == nil {
+		t.Fatal("side chain with an invalid block was connected")
+	}
+
+	checkBestChain(t, bc, fork, main1, main2, main3)
+
+	checkOutput(t, bc, fork.Transactions[0], 0, false)
+	checkOutput(t, bc, payBob, 0, true)
+	checkOutput(t, bc, main3.Transactions[0], 0, true)
+	checkOutput(t, bc, side1.Transactions[0], 0, false)
+
+	checkIndexedTransaction(t, bc, payBob, main1)
+	checkIndexedTransaction(t, bc, side1.Transactions[0], nil)
+
+	checkBalance(t, bc, alice, 5, 4*subsidy-40)
+	checkBalance(t, bc, bob, 1, 40)
+
+	// The invalid block and everything stored on it are marked, so building
+	// on them fails without another reorganisation
+	err = bc.DB.View(func(tx *bolt.Tx) error {
+		for _, block := range []*Block{side1, side2, side3, side4} {
+			entry, err := getBlockIndexEntry(tx, block.Hash)
+			if err != nil {
+				return err
+			}
+			if want := block != side1; entry.Invalid != want {
+				t.Errorf("block at height %d of the side chain invalid is %v, want %v", block.Height, entry.Invalid, want)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	side5 := buildBlock(side4, coinbase(t, bob, 0))
+	if err = bc.AddBlock(side5); err == nil {
+		t.Fatal("block extending an invalid block was accepted")
+	}
+	checkBestChain(t, bc, fork, main1, main2, main3)
+}
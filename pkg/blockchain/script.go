@@ -0,0 +1,535 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Opcodes of the script language, with the values Bitcoin gives them.
+// Opcodes from 0x01 to 0x4b push that many bytes
+const (
+	Op0                   = 0x00
+	OpPushData1           = 0x4c
+	OpPushData2           = 0x4d
+	OpPushData4           = 0x4e
+	Op1                   = 0x51
+	Op16                  = 0x60
+	OpVerify              = 0x69
+	OpReturn              = 0x6a
+	OpDrop                = 0x75
+	OpDup                 = 0x76
+	OpEqual               = 0x87
+	OpEqualVerify         = 0x88
+	OpHash160             = 0xa9
+	OpCheckSig            = 0xac
+	OpCheckMultiSig       = 0xae
+	OpCheckLockTimeVerify = 0xb1
+)
+
+var opcodeNames = map[byte]string{
+	Op0:                   "0",
+	OpPushData1:           "PUSHDATA1",
+	OpPushData2:           "PUSHDATA2",
+	OpPushData4:           "PUSHDATA4",
+	OpVerify:              "VERIFY",
+	OpReturn:              "RETURN",
+	OpDrop:                "DROP",
+	OpDup:                 "DUP",
+	OpEqual:               "EQUAL",
+	OpEqualVerify:         "EQUALVERIFY",
+	OpHash160:             "HASH160",
+	OpCheckSig:            "CHECKSIG",
+	OpCheckMultiSig:       "CHECKMULTISIG",
+	OpCheckLockTimeVerify: "CHECKLOCKTIMEVERIFY",
+}
+
+// Limits on what a script may do, so that verifying one stays cheap
+const (
+	MaxScriptSize         = 10000
+	maxScriptElementSize  = 520
+	maxStackSize          = 1000
+	maxOpsPerScript       = 201
+	maxPubKeysPerMultiSig = 20
+
+	// maxScriptNumLen is the longest number read from the stack, such as
+	// the counts of CHECKMULTISIG. Lock times may use five bytes so that
+	// every uint32 fits
+	maxScriptNumLen   = 4
+	maxLockTimeNumLen = 5
+)
+
+// scriptOp is an opcode of a parsed script along with the data it pushes
+type scriptOp struct {
+	opcode byte
+	data   []byte
+}
+
+// isPush reports whether the opcode only pushes onto the stack
+func (op scriptOp) isPush() bool {
+	return op.opcode <= Op16 && op.opcode != 0x50
+}
+
+// parseScript splits a script into its opcodes, failing if a push runs past
+// the end of the script
+func parseScript(script []byte) ([]scriptOp, error) {
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("script of %d bytes exceeds the maximum size", len(script))
+	}
+
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+
+		length := 0
+		switch {
+		case opcode > Op0 && opcode < OpPushData1:
+			length = int(opcode)
+		case opcode == OpPushData1:
+			if i+1 > len(script) {
+				return nil, errors.New("script ends within a push length")
+			}
+			length = int(script[i])
+			i++
+		case opcode == OpPushData2:
+			if i+2 > len(script) {
+				return nil, errors.New("script ends within a push length")
+			}
+			length = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case opcode == OpPushData4:
+			if i+4 > len(script) {
+				return nil, errors.New("script ends within a push length")
+			}
+			length = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		}
+
+		if length < 0 || length > len(script)-i {
+			return nil, errors.New("script ends within pushed data")
+		}
+
+		op := scriptOp{opcode: opcode}
+		if opcode <= OpPushData4 {
+			op.data = script[i : i+length]
+		}
+		i += length
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// IsPushOnly reports whether a script only pushes data, as signature
+// scripts must
+func IsPushOnly(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+
+	for _, op := range ops {
+		if !op.isPush() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DisasmScript returns a script in a readable form, with pushed data in hex
+func DisasmScript(script []byte) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return fmt.Sprintf("[invalid script %x]", script)
+	}
+
+	var words []string
+	for _, op := range ops {
+		switch {
+		case op.opcode > Op0 && op.opcode <= OpPushData4:
+			words = append(words, hex.EncodeToString(op.data))
+		case op.opcode >= Op1 && op.opcode <= Op16:
+			words = append(words, fmt.Sprintf("%d", op.opcode-Op1+1))
+		case opcodeNames[op.opcode] != "":
+			words = append(words, opcodeNames[op.opcode])
+		default:
+			words = append(words, fmt.Sprintf("UNKNOWN(%#02x)", op.opcode))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// scriptEngine runs the scripts of one input of a transaction
+type scriptEngine struct {
+	tx    *Transaction
+	inID  int
+	stack [][]byte
+}
+
+// VerifyScript runs the signature script of an input followed by the
+// script of the output it spends, and succeeds if that leaves true on top
+// of the stack. Signature scripts may only push data, so that they cannot
+// change what the output script checks. When the output pays a script hash,
+// the last push of the signature script is the redeem script, which must
+// then succeed on the rest of what the signature script pushed
+func VerifyScript(tx *Transaction, inID int, scriptPubKey []byte) error {
+	scriptSig := tx.Vin[inID].ScriptSig
+	if !IsPushOnly(scriptSig) {
+		return errors.New("signature script does not only push data")
+	}
+
+	e := &scriptEngine{tx: tx, inID: inID}
+	if err := e.execute(scriptSig); err != nil {
+		return err
+	}
+	pushed := append([][]byte{}, e.stack...)
+
+	if err := e.run(scriptPubKey); err != nil {
+		return err
+	}
+
+	if ExtractScriptHash(scriptPubKey) == nil {
+		return nil
+	}
+
+	redeemScript := pushed[len(pushed)-1]
+	e.stack = pushed[:len(pushed)-1]
+	if err := e.run(redeemScript); err != nil {
+		return fmt.Errorf("redeem script: %v", err)
+	}
+
+	return nil
+}
+
+// run executes a script and checks that it leaves true on top of the stack
+func (e *scriptEngine) run(script []byte) error {
+	if err := e.execute(script); err != nil {
+		return err
+	}
+
+	if len(e.stack) == 0 || !castToBool(e.stack[len(e.stack)-1]) {
+		return errors.New("script leaves false on the stack")
+	}
+
+	return nil
+}
+
+// execute runs a script on the stack. Signatures checked by the script sign
+// the transaction with the script in place of the input's signature script
+func (e *scriptEngine) execute(script []byte) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, op := range ops {
+		if len(op.data) > maxScriptElementSize {
+			return fmt.Errorf("push of %d bytes exceeds the maximum element size", len(op.data))
+		}
+		if op.opcode > Op16 {
+			count++
+			if count > maxOpsPerScript {
+				return errors.New("script has too many operations")
+			}
+		}
+
+		if err = e.step(op, script); err != nil {
+			return fmt.Errorf("%s: %v", DisasmScript([]byte{op.opcode}), err)
+		}
+
+		if len(e.stack) > maxStackSize {
+			return errors.New("stack exceeds the maximum size")
+		}
+	}
+
+	return nil
+}
+
+func (e *scriptEngine) step(op scriptOp, script []byte) error {
+	switch {
+	case op.opcode <= OpPushData4:
+		e.push(op.data)
+		return nil
+
+	case op.opcode >= Op1 && op.opcode <= Op16:
+		e.push(encodeScriptNum(int64(op.opcode - Op1 + 1)))
+		return nil
+	}
+
+	switch op.opcode {
+	case OpVerify:
+		return e.verify()
+
+	case OpReturn:
+		return errors.New("output cannot be spent")
+
+	case OpDrop:
+		_, err := e.pop()
+		return err
+
+	case OpDup:
+		top, err := e.peek()
+		if err != nil {
+			return err
+		}
+		e.push(top)
+
+	case OpEqual, OpEqualVerify:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.pushBool(bytes.Equal(a, b))
+
+		if op.opcode == OpEqualVerify {
+			return e.verify()
+		}
+
+	case OpHash160:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash, err := HashPublicKey(data)
+		if err != nil {
+			return err
+		}
+		e.push(hash)
+
+	case OpCheckSig:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := e.pop()
+		if err != nil {
+			return err
+		}
+
+		hash, err := e.tx.signatureHash(e.inID, script)
+		if err != nil {
+			return err
+		}
+		e.pushBool(len(sig) > 0 && VerifySignature(pubKey, hash, sig))
+
+	case OpCheckMultiSig:
+		return e.checkMultiSig(script)
+
+	case OpCheckLockTimeVerify:
+		top, err := e.peek()
+		if err != nil {
+			return err
+		}
+		lockTime, err := decodeScriptNum(top, maxLockTimeNumLen)
+		if err != nil {
+			return err
+		}
+		if lockTime < 0 {
+			return errors.New("lock time is negative")
+		}
+		if lockTime > int64(e.tx.LockTime) {
+			return fmt.Errorf("transaction lock time %d is below %d", e.tx.LockTime, lockTime)
+		}
+
+	default:
+		return errors.New("opcode is not supported")
+	}
+
+	return nil
+}
+
+// checkMultiSig pops the number of keys N, the keys, the number of
+// signatures M needed and the signatures, and pushes whether the signatures
+// are by M of the keys in the same order as the keys. Unlike Bitcoin no
+// extra element is popped
+func (e *scriptEngine) checkMultiSig(script []byte) error {
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > maxPubKeysPerMultiSig {
+		return fmt.Errorf("%d keys is not from 0 to %d", n, maxPubKeysPerMultiSig)
+	}
+	pubKeys, err := e.popN(int(n))
+	if err != nil {
+		return err
+	}
+
+	m, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if m < 0 || m > n {
+		return fmt.Errorf("%d signatures is not from 0 to %d", m, n)
+	}
+	sigs, err := e.popN(int(m))
+	if err != nil {
+		return err
+	}
+
+	hash, err := e.tx.signatureHash(e.inID, script)
+	if err != nil {
+		return err
+	}
+
+	// Each signature is matched against the keys after the key of the one
+	// before it, so no key signs twice
+	k := 0
+	for _, sig := range sigs {
+		for k < len(pubKeys) && !(len(sig) > 0 && VerifySignature(pubKeys[k], hash, sig)) {
+			k++
+		}
+		if k == len(pubKeys) {
+			e.pushBool(false)
+			return nil
+		}
+		k++
+	}
+
+	e.pushBool(true)
+
+	return nil
+}
+
+func (e *scriptEngine) push(data []byte) {
+	e.stack = append(e.stack, data)
+}
+
+func (e *scriptEngine) pushBool(v bool) {
+	if v {
+		e.push([]byte{1})
+	} else {
+		e.push(nil)
+	}
+}
+
+func (e *scriptEngine) peek() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, errors.New("stack is empty")
+	}
+
+	return e.stack[len(e.stack)-1], nil
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	top, err := e.peek()
+	if err != nil {
+		return nil, err
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return top, nil
+}
+
+// popN pops n elements, returning them in the order they were pushed
+func (e *scriptEngine) popN(n int) ([][]byte, error) {
+	if n > len(e.stack) {
+		return nil, errors.New("stack has too few elements")
+	}
+
+	elements := make([][]byte, n)
+	copy(elements, e.stack[len(e.stack)-n:])
+	e.stack = e.stack[:len(e.stack)-n]
+
+	return elements, nil
+}
+
+func (e *scriptEngine) popInt() (int64, error) {
+	top, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeScriptNum(top, maxScriptNumLen)
+}
+
+func (e *scriptEngine) verify() error {
+	top, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(top) {
+		return errors.New("verify failed")
+	}
+
+	return nil
+}
+
+// castToBool reads an element as false if it is zero, including negative
+// zero, and as true otherwise
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
+
+// encodeScriptNum encodes a number as scripts do, in the fewest little
+// endian bytes of its magnitude with the sign in the top bit of the last
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append(b, byte(n))
+	}
+
+	if b[len(b)-1]&0x80 != 0 {
+		b = append(b, 0)
+	}
+	if negative {
+		b[len(b)-1] |= 0x80
+	}
+
+	return b
+}
+
+// decodeScriptNum decodes a number of at most maxLen bytes, which must be
+// encoded in the fewest bytes
+func decodeScriptNum(b []byte, maxLen int) (int64, error) {
+	if len(b) > maxLen {
+		return 0, fmt.Errorf("number of %d bytes is longer than %d", len(b), maxLen)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	last := b[len(b)-1]
+	if last&0x7f == 0 && (len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+		return 0, errors.New("number is not minimally encoded")
+	}
+
+	var n int64
+	for i, v := range b {
+		n |= int64(v) << uint(8*i)
+	}
+
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << uint(8*(len(b)-1))
+		n = -n
+	}
+
+	return n, nil
+}
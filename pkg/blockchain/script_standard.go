@@ -0,0 +1,210 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/tcheard/blockchain/pkg/secp256k1"
+)
+
+// PayToPubKeyHashScript returns the script of an output paying a public key
+// hash, which is spent by a signature script pushing a signature and the
+// public key: DUP HASH160 <pubKeyHash> EQUALVERIFY CHECKSIG
+func PayToPubKeyHashScript(pubKeyHash []byte) []byte {
+	script := []byte{OpDup, OpHash160}
+	script = appendPush(script, pubKeyHash)
+
+	return append(script, OpEqualVerify, OpCheckSig)
+}
+
+// PayToScriptHashScript returns the script of an output paying the hash of
+// a redeem script, which is spent by a signature script pushing what the
+// redeem script needs followed by the redeem script: HASH160 <scriptHash>
+// EQUAL
+func PayToScriptHashScript(scriptHash []byte) []byte {
+	script := []byte{OpHash160}
+	script = appendPush(script, scriptHash)
+
+	return append(script, OpEqual)
+}
+
+// MultiSigScript returns a redeem script needing signatures by m of the
+// public keys, in the order of the keys: m <pubKeys...> n CHECKMULTISIG
+func MultiSigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("%d signatures of %d keys is not possible", m, n)
+	}
+	if n > 16 {
+		return nil, fmt.Errorf("%d keys is more than 16", n)
+	}
+
+	script := appendInt(nil, int64(m))
+	for _, pubKey := range pubKeys {
+		if _, err := secp256k1.ParsePubKey(pubKey); err != nil {
+			return nil, err
+		}
+		script = appendPush(script, pubKey)
+	}
+	script = appendInt(script, int64(n))
+	script = append(script, OpCheckMultiSig)
+
+	// The redeem script is pushed by signature scripts
+	if len(script) > maxScriptElementSize {
+		return nil, errors.New("redeem script is too large to push, use fewer keys")
+	}
+
+	return script, nil
+}
+
+// PayToAddressScript returns the script of an output paying an address
+func PayToAddressScript(address string) ([]byte, error) {
+	version, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == activeNet.ScriptHashAddressVersion {
+		return PayToScriptHashScript(hash), nil
+	}
+
+	return PayToPubKeyHashScript(hash), nil
+}
+
+// ScriptAddress returns the address a pay-to-pubkey-hash or
+// pay-to-script-hash script pays, or nothing for any other script
+func ScriptAddress(script []byte) string {
+	if pubKeyHash := ExtractPubKeyHash(script); pubKeyHash != nil {
+		return PubKeyHashToAddress(pubKeyHash)
+	}
+	if scriptHash := ExtractScriptHash(script); scriptHash != nil {
+		return ScriptHashToAddress(scriptHash)
+	}
+
+	return ""
+}
+
+// SignatureScript returns the signature script spending a
+// pay-to-pubkey-hash output: <signature> <pubKey>
+func SignatureScript(signature, pubKey []byte) []byte {
+	return appendPush(appendPush(nil, signature), pubKey)
+}
+
+// ExtractPubKeyHash returns the public key hash paid by a
+// pay-to-pubkey-hash script, or nil for any other script
+func ExtractPubKeyHash(script []byte) []byte {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) != 5 {
+		return nil
+	}
+
+	if ops[0].opcode != OpDup || ops[1].opcode != OpHash160 || len(ops[2].data) != 20 ||
+		ops[3].opcode != OpEqualVerify || ops[4].opcode != OpCheckSig {
+		return nil
+	}
+
+	return ops[2].data
+}
+
+// ExtractScriptHash returns the script hash paid by a pay-to-script-hash
+// script, or nil for any other script
+func ExtractScriptHash(script []byte) []byte {
+	if len(script) != 23 || script[0] != OpHash160 || script[1] != 20 || script[22] != OpEqual {
+		return nil
+	}
+
+	return script[2:22]
+}
+
+// parseMultiSigScript returns the number of signatures and the keys of a
+// redeem script made by MultiSigScript
+func parseMultiSigScript(script []byte) (int, [][]byte, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	n := len(ops) - 3
+	if n < 1 || ops[len(ops)-1].opcode != OpCheckMultiSig {
+		return 0, nil, errors.New("script is not a multisig script")
+	}
+
+	m, err := smallInt(ops[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	count, err := smallInt(ops[len(ops)-2])
+	if err != nil {
+		return 0, nil, err
+	}
+	if count != n || m < 1 || m > n {
+		return 0, nil, errors.New("multisig script has inconsistent counts")
+	}
+
+	var pubKeys [][]byte
+	for _, op := range ops[1 : 1+n] {
+		if op.opcode == Op0 || op.opcode > OpPushData4 {
+			return 0, nil, errors.New("multisig script does not push a key")
+		}
+		pubKeys = append(pubKeys, op.data)
+	}
+
+	return m, pubKeys, nil
+}
+
+// smallInt returns the number from 0 to 16 pushed by an opcode
+func smallInt(op scriptOp) (int, error) {
+	switch {
+	case op.opcode == Op0:
+		return 0, nil
+	case op.opcode >= Op1 && op.opcode <= Op16:
+		return int(op.opcode-Op1) + 1, nil
+	}
+
+	return 0, errors.New("opcode does not push a small number")
+}
+
+// extractSignaturePubKey returns the public key pushed by the signature
+// script of a pay-to-pubkey-hash input, or nil for any other script
+func extractSignaturePubKey(scriptSig []byte) []byte {
+	ops, err := parseScript(scriptSig)
+	if err != nil || len(ops) != 2 || !ops[0].isPush() || !ops[1].isPush() {
+		return nil
+	}
+
+	return ops[1].data
+}
+
+// appendPush appends the shortest push of data to a script
+func appendPush(script, data []byte) []byte {
+	switch n := len(data); {
+	case n == 0:
+		return append(script, Op0)
+	case n < OpPushData1:
+		script = append(script, byte(n))
+	case n <= 0xff:
+		script = append(script, OpPushData1, byte(n))
+	case n <= 0xffff:
+		script = append(script, OpPushData2, 0, 0)
+		binary.LittleEndian.PutUint16(script[len(script)-2:], uint16(n))
+	default:
+		script = append(script, OpPushData4, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(script[len(script)-4:], uint32(n))
+	}
+
+	return append(script, data...)
+}
+
+// appendInt appends a push of a number to a script, as a single opcode for
+// the numbers from 0 to 16
+func appendInt(script []byte, n int64) []byte {
+	switch {
+	case n == 0:
+		return append(script, Op0)
+	case n >= 1 && n <= 16:
+		return append(script, byte(Op1+n-1))
+	}
+
+	return appendPush(script, encodeScriptNum(n))
+}
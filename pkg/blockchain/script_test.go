@@ -0,0 +1,372 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/tcheard/blockchain/pkg/secp256k1"
+)
+
+// newTestKey returns a new secp256k1 private key
+func newTestKey(t *testing.T) *PrivateKey {
+	private, err := secp256k1.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newPrivateKey(private.Serialize(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// signInput signs the first input of tx as spending an output with script
+func signInput(t *testing.T, key *PrivateKey, tx *Transaction, script []byte) []byte {
+	hash, err := tx.signatureHash(0, script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.Sign(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sig
+}
+
+// pushes returns a script pushing each element in turn
+func pushes(elements ...[]byte) []byte {
+	var script []byte
+	for _, element := range elements {
+		script = appendPush(script, element)
+	}
+
+	return script
+}
+
+// repeat returns a script of n copies of ops
+func repeat(n int, ops ...byte) []byte {
+	var script []byte
+	for i := 0; i < n; i++ {
+		script = append(script, ops...)
+	}
+
+	return script
+}
+
+// scriptHashScript returns the pay-to-script-hash script of a redeem script
+func scriptHashScript(t *testing.T, redeemScript []byte) []byte {
+	hash, err := HashPublicKey(redeemScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return PayToScriptHashScript(hash)
+}
+
+func TestVerifyScript(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	hash, err := HashPublicKey(alice.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkh := PayToPubKeyHashScript(hash)
+
+	multiSig, err := MultiSigScript(2, [][]byte{alice.PublicKey(), bob.PublicKey(), carol.PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh := scriptHashScript(t, multiSig)
+
+	lockTime := 10
+	cltv := append(appendInt(nil, int64(lockTime)), OpCheckLockTimeVerify, OpDrop, Op1)
+	lockedUntil := func(n []byte) []byte {
+		return append(pushes(n), OpCheckLockTimeVerify, OpDrop, Op1)
+	}
+
+	bigElement := bytes.Repeat([]byte{1}, maxScriptElementSize)
+
+	tests := []struct {
+		name     string
+		lockTime int
+		scripts  func(tx *Transaction) (scriptSig, scriptPubKey []byte)
+		valid    bool
+	}{
+		{"p2pkh", 0, func(tx *Transaction) ([]byte, []byte) {
+			return SignatureScript(signInput(t, alice, tx, p2pkh), alice.PublicKey()), p2pkh
+		}, true},
+		{"p2pkh with another key", 0, func(tx *Transaction) ([]byte, []byte) {
+			return SignatureScript(signInput(t, bob, tx, p2pkh), bob.PublicKey()), p2pkh
+		}, false},
+		{"p2pkh signed by another key", 0, func(tx *Transaction) ([]byte, []byte) {
+			return SignatureScript(signInput(t, bob, tx, p2pkh), alice.PublicKey()), p2pkh
+		}, false},
+		{"p2pkh signing another script", 0, func(tx *Transaction) ([]byte, []byte) {
+			return SignatureScript(signInput(t, alice, tx, p2sh), alice.PublicKey()), p2pkh
+		}, false},
+		{"p2pkh with an empty signature", 0, func(tx *Transaction) ([]byte, []byte) {
+			return SignatureScript(nil, alice.PublicKey()), p2pkh
+		}, false},
+		{"signature script that is not push only", 0, func(tx *Transaction) ([]byte, []byte) {
+			sig := signInput(t, alice, tx, p2pkh)
+			return append(pushes(sig), OpDup, OpDrop), append(pushes(alice.PublicKey()), OpCheckSig)
+		}, false},
+
+		{"p2sh 2 of 3", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes(signInput(t, alice, tx, multiSig), signInput(t, carol, tx, multiSig), multiSig), p2sh
+		}, true},
+		{"p2sh signatures out of order", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes(signInput(t, carol, tx, multiSig), signInput(t, alice, tx, multiSig), multiSig), p2sh
+		}, false},
+		{"p2sh one signature twice", 0, func(tx *Transaction) ([]byte, []byte) {
+			sig := signInput(t, bob, tx, multiSig)
+			return pushes(sig, sig, multiSig), p2sh
+		}, false},
+		{"p2sh too few signatures", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes(signInput(t, bob, tx, multiSig), multiSig), p2sh
+		}, false},
+		{"p2sh signing the output script", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes(signInput(t, alice, tx, p2sh), signInput(t, bob, tx, p2sh), multiSig), p2sh
+		}, false},
+		{"p2sh another redeem script", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes([]byte{1}, []byte{Op1, OpEqual}), p2sh
+		}, false},
+		{"p2sh redeem script leaving true", 0, func(tx *Transaction) ([]byte, []byte) {
+			redeem := []byte{Op1, OpEqual}
+			return pushes([]byte{1}, redeem), scriptHashScript(t, redeem)
+		}, true},
+		{"p2sh redeem script leaving false", 0, func(tx *Transaction) ([]byte, []byte) {
+			redeem := []byte{Op1, OpEqual}
+			return pushes([]byte{2}, redeem), scriptHashScript(t, redeem)
+		}, false},
+		{"p2sh redeem script failing", 0, func(tx *Transaction) ([]byte, []byte) {
+			redeem := []byte{OpReturn}
+			return pushes(redeem), scriptHashScript(t, redeem)
+		}, false},
+
+		{"return", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, []byte{OpReturn}
+		}, false},
+		{"return after true", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, []byte{Op1, OpReturn}
+		}, false},
+		{"empty scripts", 0, func(tx *Transaction) ([]byte, []byte) {
+			return nil, nil
+		}, false},
+		{"negative zero is false", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes([]byte{0, 0x80}), nil
+		}, false},
+
+		// Pushes need not be the shortest, only numbers read from the stack
+		{"push with a longer opcode", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{OpPushData1, 1, 5}, append(pushes([]byte{5}), OpEqual)
+		}, true},
+		{"push past the end", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, []byte{3, 1, 2}
+		}, false},
+		{"push length past the end", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, []byte{OpPushData2, 1}
+		}, false},
+		{"number with a trailing zero", lockTime, func(tx *Transaction) ([]byte, []byte) {
+			return nil, lockedUntil([]byte{byte(lockTime), 0})
+		}, false},
+		{"multisig count with a trailing zero", 0, func(tx *Transaction) ([]byte, []byte) {
+			return nil, append(pushes(nil, []byte{0, 0}), OpCheckMultiSig)
+		}, false},
+
+		{"unsupported opcode", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1, Op1}, []byte{0x7e}
+		}, false},
+		{"reserved opcode in the signature script", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{0x50}, []byte{Op1}
+		}, false},
+		{"verify of false", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op0}, []byte{OpVerify, Op1}
+		}, false},
+		{"pop of an empty stack", 0, func(tx *Transaction) ([]byte, []byte) {
+			return nil, []byte{OpDrop, Op1}
+		}, false},
+
+		{"largest element", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes(bigElement), append(pushes(bigElement), OpEqual)
+		}, true},
+		{"element over the limit", 0, func(tx *Transaction) ([]byte, []byte) {
+			return pushes(append(bigElement, 1)), []byte{OpDrop, Op1}
+		}, false},
+		{"most operations", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, repeat(maxOpsPerScript/2, OpDup, OpDrop)
+		}, true},
+		{"operations over the limit", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, repeat(maxOpsPerScript/2+1, OpDup, OpDrop)
+		}, false},
+		{"largest stack", 0, func(tx *Transaction) ([]byte, []byte) {
+			return repeat(maxStackSize, Op1), []byte{OpDrop}
+		}, true},
+		{"stack over the limit", 0, func(tx *Transaction) ([]byte, []byte) {
+			return repeat(maxStackSize+1, Op1), []byte{OpDrop}
+		}, false},
+		{"script over the maximum size", 0, func(tx *Transaction) ([]byte, []byte) {
+			return []byte{Op1}, append(repeat(MaxScriptSize, OpDup), OpDrop)
+		}, false},
+		{"multisig with too many keys", 0, func(tx *Transaction) ([]byte, []byte) {
+			keys := append([]byte{Op0}, repeat(maxPubKeysPerMultiSig+1, Op1)...)
+			return nil, append(append(keys, pushes(encodeScriptNum(maxPubKeysPerMultiSig+1))...), OpCheckMultiSig)
+		}, false},
+
+		{"lock time reached", lockTime, func(tx *Transaction) ([]byte, []byte) {
+			return nil, cltv
+		}, true},
+		{"lock time passed", lockTime + 1, func(tx *Transaction) ([]byte, []byte) {
+			return nil, cltv
+		}, true},
+		{"lock time not reached", lockTime - 1, func(tx *Transaction) ([]byte, []byte) {
+			return nil, cltv
+		}, false},
+		{"negative lock time", lockTime, func(tx *Transaction) ([]byte, []byte) {
+			return nil, lockedUntil(encodeScriptNum(-1))
+		}, false},
+		{"five byte lock time", 1 << 32, func(tx *Transaction) ([]byte, []byte) {
+			return nil, lockedUntil(encodeScriptNum(1 << 32))
+		}, true},
+		{"six byte lock time", 1 << 40, func(tx *Transaction) ([]byte, []byte) {
+			return nil, lockedUntil(encodeScriptNum(1 << 40))
+		}, false},
+		{"lock time on an empty stack", lockTime, func(tx *Transaction) ([]byte, []byte) {
+			return nil, []byte{OpCheckLockTimeVerify}
+		}, false},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{
+			Vin:      []*TXInput{{Txid: bytes.Repeat([]byte{1}, 32)}},
+			Vout:     []*TXOutput{{Value: 1, ScriptPubKey: p2pkh}},
+			LockTime: test.lockTime,
+		}
+
+		scriptSig, scriptPubKey := test.scripts(tx)
+		tx.Vin[0].ScriptSig = scriptSig
+
+		err := VerifyScript(tx, 0, scriptPubKey)
+		if test.valid && err != nil {
+			t.Errorf("%s: rejected: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: accepted", test.name)
+		}
+	}
+}
+
+func TestScriptNum(t *testing.T) {
+	tests := []struct {
+		n       int64
+		encoded string
+	}{
+		{0, ""},
+		{1, "01"},
+		{-1, "81"},
+		{127, "7f"},
+		{128, "8000"},
+		{-128, "8080"},
+		{255, "ff00"},
+		{256, "0001"},
+		{-32768, "008080"},
+		{2147483647, "ffffff7f"},
+		{-2147483647, "ffffffff"},
+		{4294967295, "ffffffff00"},
+	}
+
+	for _, test := range tests {
+		encoded := encodeScriptNum(test.n)
+		if hex.EncodeToString(encoded) != test.encoded {
+			t.Errorf("encodeScriptNum(%d) = %x, want %s", test.n, encoded, test.encoded)
+		}
+
+		n, err := decodeScriptNum(encoded, maxLockTimeNumLen)
+		if err != nil || n != test.n {
+			t.Errorf("decodeScriptNum(%x) = %d, %v, want %d", encoded, n, err, test.n)
+		}
+	}
+
+	invalid := []struct {
+		encoded string
+		maxLen  int
+	}{
+		{"00", maxScriptNumLen},
+		{"80", maxScriptNumLen},
+		{"0100", maxScriptNumLen},
+		{"0180", maxScriptNumLen},
+		{"ffffffff00", maxScriptNumLen},
+		{"0000000080", maxLockTimeNumLen},
+		{"000000000001", maxLockTimeNumLen},
+	}
+
+	for _, test := range invalid {
+		b, _ := hex.DecodeString(test.encoded)
+		if n, err := decodeScriptNum(b, test.maxLen); err == nil {
+			t.Errorf("decodeScriptNum(%s, %d) = %d, want an error", test.encoded, test.maxLen, n)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 300)
+	script := append([]byte{Op0, 2, 1, 2, OpPushData1, 3, 4, 5, 6}, pushes(long)...)
+	script = append(script, Op16, OpCheckSig)
+
+	ops, err := parseScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []scriptOp{
+		{Op0, []byte{}},
+		{2, []byte{1, 2}},
+		{OpPushData1, []byte{4, 5, 6}},
+		{OpPushData2, long},
+		{Op16, nil},
+		{OpCheckSig, nil},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("parsed %d ops, want %d", len(ops), len(want))
+	}
+	for i := range want {
+		if ops[i].opcode != want[i].opcode || !bytes.Equal(ops[i].data, want[i].data) {
+			t.Errorf("op %d is %x %x, want %x %x", i, ops[i].opcode, ops[i].data, want[i].opcode, want[i].data)
+		}
+	}
+
+	if !IsPushOnly(script[:len(script)-1]) || IsPushOnly(script) {
+		t.Error("IsPushOnly does not stop at the first opcode that is not a push")
+	}
+
+	for _, bad := range [][]byte{{1}, {OpPushData1}, {OpPushData2, 1, 0}, {OpPushData4, 0xff, 0xff, 0xff, 0xff}} {
+		if _, err := parseScript(bad); err == nil {
+			t.Errorf("parseScript(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestCastToBool(t *testing.T) {
+	tests := []struct {
+		data string
+		v    bool
+	}{
+		{"", false},
+		{"00", false},
+		{"0000", false},
+		{"80", false},
+		{"0080", false},
+		{"01", true},
+		{"8000", true},
+		{"0001", true},
+	}
+
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.data)
+		if v := castToBool(b); v != test.v {
+			t.Errorf("castToBool(%s) = %v, want %v", test.data, v, test.v)
+		}
+	}
+}
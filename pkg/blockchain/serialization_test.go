@@ -0,0 +1,192 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+// serializationVector is an entry of testdata/serialization_vectors.json,
+// described in docs/serialization.md
+type serializationVector struct {
+	Name         string
+	Type         string
+	Transaction  *vectorTransaction
+	Header       *vectorHeader
+	Transactions []string
+	Hex          string
+	Hash         string
+}
+
+type vectorTransaction struct {
+	Vin []struct {
+		Txid      string
+		Vout      int
+		ScriptSig string
+	}
+	Vout []struct {
+		Value        int
+		ScriptPubKey string
+	}
+	LockTime int
+}
+
+type vectorHeader struct {
+	Version       int32
+	Height        int
+	PrevBlockHash string
+	MerkleRoot    string
+	Timestamp     int64
+	Bits          string
+	Nonce         int64
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func (v *vectorTransaction) transaction(t *testing.T) *Transaction {
+	tx := &Transaction{LockTime: v.LockTime}
+	for _, vin := range v.Vin {
+		tx.Vin = append(tx.Vin, &TXInput{
+			Txid:      mustDecodeHex(t, vin.Txid),
+			Vout:      vin.Vout,
+			ScriptSig: mustDecodeHex(t, vin.ScriptSig),
+		})
+	}
+	for _, vout := range v.Vout {
+		tx.Vout = append(tx.Vout, &TXOutput{
+			Value:        vout.Value,
+			ScriptPubKey: mustDecodeHex(t, vout.ScriptPubKey),
+		})
+	}
+
+	return tx
+}
+
+func (v *vectorHeader) header(t *testing.T) *BlockHeader {
+	bits, err := strconv.ParseUint(v.Bits, 16, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &BlockHeader{
+		Version:       v.Version,
+		Height:        v.Height,
+		PrevBlockHash: mustDecodeHex(t, v.PrevBlockHash),
+		MerkleRoot:    mustDecodeHex(t, v.MerkleRoot),
+		Timestamp:     v.Timestamp,
+		Bits:          uint32(bits),
+		Nonce:         v.Nonce,
+	}
+}
+
+func TestSerializationVectors(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/serialization_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []serializationVector
+	if err = json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+
+	// Blocks list their transactions by the hashes of transaction vectors
+	txs := make(map[string]*Transaction)
+
+	for _, v := range vectors {
+		want := mustDecodeHex(t, v.Hex)
+		var encoded, hash []byte
+
+		switch v.Type {
+		case "transaction":
+			tx := v.Transaction.transaction(t)
+			if encoded, err = tx.Serialize(); err != nil {
+				t.Fatalf("%s: %v", v.Name, err)
+			}
+			if hash, err = tx.Hash(); err != nil {
+				t.Fatalf("%s: %v", v.Name, err)
+			}
+			tx.ID = hash
+			txs[hex.EncodeToString(hash)] = tx
+
+			decoded, err := DeserializeTransaction(want)
+			if err != nil {
+				t.Fatalf("%s: decoding: %v", v.Name, err)
+			}
+			reencoded, err := decoded.Serialize()
+			if err != nil {
+				t.Fatalf("%s: %v", v.Name, err)
+			}
+			if !bytes.Equal(reencoded, want) {
+				t.Errorf("%s: decoding and encoding again gives %x", v.Name, reencoded)
+			}
+
+		case "header":
+			header := v.Header.header(t)
+			encoded, hash = header.Serialize(), header.Hash()
+
+			decoded, err := DeserializeBlockHeader(want)
+			if err != nil {
+				t.Fatalf("%s: decoding: %v", v.Name, err)
+			}
+			if reencoded := decoded.Serialize(); !bytes.Equal(reencoded, want) {
+				t.Errorf("%s: decoding and encoding again gives %x", v.Name, reencoded)
+			}
+
+		case "block":
+			block := &Block{BlockHeader: *v.Header.header(t)}
+			for _, txid := range v.Transactions {
+				tx, ok := txs[txid]
+				if !ok {
+					t.Fatalf("%s: transaction %s is not a vector", v.Name, txid)
+				}
+				block.Transactions = append(block.Transactions, tx)
+			}
+			if !bytes.Equal(block.HashTransactions(), block.MerkleRoot) {
+				t.Errorf("%s: Merkle root of the transactions is %x", v.Name, block.HashTransactions())
+			}
+			if encoded, err = block.Serialize(); err != nil {
+				t.Fatalf("%s: %v", v.Name, err)
+			}
+			hash = block.BlockHeader.Hash()
+
+			decoded, err := DeserializeBlock(want)
+			if err != nil {
+				t.Fatalf("%s: decoding: %v", v.Name, err)
+			}
+			reencoded, err := decoded.Serialize()
+			if err != nil {
+				t.Fatalf("%s: %v", v.Name, err)
+			}
+			if !bytes.Equal(reencoded, want) {
+				t.Errorf("%s: decoding and encoding again gives %x", v.Name, reencoded)
+			}
+			if hex.EncodeToString(decoded.Hash) != v.Hash {
+				t.Errorf("%s: decoded block has hash %x", v.Name, decoded.Hash)
+			}
+
+		default:
+			t.Fatalf("%s: unknown vector type %q", v.Name, v.Type)
+		}
+
+		if !bytes.Equal(encoded, want) {
+			t.Errorf("%s: encoding gives %x, want %s", v.Name, encoded, v.Hex)
+		}
+		if hex.EncodeToString(hash) != v.Hash {
+			t.Errorf("%s: hash is %x, want %s", v.Name, hash, v.Hash)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"fmt"
+)
+
+// BlockTemplate is an unmined block on the current tip along with the
+// fees paid by its transactions
+type BlockTemplate struct {
+	Block *Block
+	Fees  int
+}
+
+// NewBlockTemplate builds a block on the current tip for a miner, paying the
+// block reward to address. The coinbase comes first, followed by the pool
+// transactions with the highest fee rates that fit in MaxBlockSize. The
+// block still needs a proof of work before it can be added to the blockchain
+func (mp *Mempool) NewBlockTemplate(address string) (*BlockTemplate, error) {
+	if !ValidateAddress(address) {
+		return nil, fmt.Errorf("address %q is not valid", address)
+	}
+
+	prevHash, height, bits, past, err := mp.Blockchain.nextHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	coinbase, err := NewCoinbaseTransaction(address, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The size of the coinbase does not depend on the fees it collects
+	ser, err := coinbase.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	txs, fees := mp.BlockTransactions(MaxBlockSize - BlockHeaderSize - 4 - len(ser))
+
+	coinbase.Vout[0].Value += fees
+	if coinbase.ID, err = coinbase.Hash(); err != nil {
+		return nil, err
+	}
+
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:       BlockVersion,
+			Height:        height,
+			PrevBlockHash: prevHash,
+			Timestamp:     blockTime(past),
+			Bits:          bits,
+		},
+		Transactions: append([]*Transaction{coinbase}, txs...),
+	}
+	block.MerkleRoot = block.HashTransactions()
+
+	return &BlockTemplate{
+		Block: block,
+		Fees:  fees,
+	}, nil
+}
@@ -1,26 +1,39 @@
 package blockchain
 
 import (
-	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/big"
 	"strings"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+// Estimated serialized sizes used to work out the fee of a transaction
+// before its inputs are signed
+const (
+	txBaseSize   = 270
+	txInputSize  = 170
+	txOutputSize = 30
 )
 
-const subsidy = 10
+// EstimateFee returns the fee for a transaction with the given number of
+// inputs and outputs at feeRate coins per 1000 bytes, rounded up
+func EstimateFee(inputs, outputs, feeRate int) int {
+	size := txBaseSize + inputs*txInputSize + outputs*txOutputSize
 
-// Transaction represents a blockchain transaction
+	return (size*feeRate + 999) / 1000
+}
+
+// Transaction represents a blockchain transaction. It can only be in a
+// block at a height of at least LockTime
 type Transaction struct {
-	ID   []byte
-	Vin  []*TXInput
-	Vout []*TXOutput
+	ID       []byte
+	Vin      []*TXInput
+	Vout     []*TXOutput
+	LockTime int
 }
 
 // IsCoinbase checks whether the transaction is a coinbase transaction
@@ -28,24 +41,89 @@ func (tx Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
 }
 
-// Serialize serializes the transaction
+// IsFinal reports whether the transaction can be in a block at height
+func (tx *Transaction) IsFinal(height int) bool {
+	return tx.LockTime <= height
+}
+
+// Minimum encoded sizes, used to reject counts that cannot fit in the data
+const (
+	minTxSize       = 4 + 4 + 4
+	minTxInputSize  = 4 + 4 + 4
+	minTxOutputSize = 8 + 4
+)
+
+// Serialize serializes the transaction in the canonical encoding described
+// in docs/serialization.md. The ID is not included as it is the hash of the
+// serialized transaction
 func (tx Transaction) Serialize() ([]byte, error) {
-	var encoded bytes.Buffer
+	w := &util.Writer{}
+	tx.encode(w)
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		return nil, err
+	return w.Bytes(), nil
+}
+
+func (tx *Transaction) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(tx.Vin)))
+	for _, vin := range tx.Vin {
+		w.WriteBytes(vin.Txid)
+		w.WriteUint32(uint32(int32(vin.Vout)))
+		w.WriteBytes(vin.ScriptSig)
+	}
+
+	w.WriteUint32(uint32(len(tx.Vout)))
+	for _, vout := range tx.Vout {
+		w.WriteUint64(uint64(int64(vout.Value)))
+		w.WriteBytes(vout.ScriptPubKey)
 	}
 
-	return encoded.Bytes(), nil
+	w.WriteUint32(uint32(tx.LockTime))
 }
 
-// Hash returns the hash of the transaction
-func (tx *Transaction) Hash() ([]byte, error) {
-	txCopy := *tx
-	txCopy.ID = []byte{}
+// DeserializeTransaction decodes a serialized transaction and sets its ID
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	r := util.NewReader(data)
+	tx := decodeTransaction(r)
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %v", err)
+	}
+
+	return tx, nil
+}
 
+func decodeTransaction(r *util.Reader) *Transaction {
+	tx := &Transaction{}
+
+	inputs := r.ReadCount(minTxInputSize)
+	for i := 0; i < inputs; i++ {
+		tx.Vin = append(tx.Vin, &TXInput{
+			Txid:      r.ReadBytes(),
+			Vout:      int(int32(r.ReadUint32())),
+			ScriptSig: r.ReadBytes(),
+		})
+	}
+
+	outputs := r.ReadCount(minTxOutputSize)
+	for i := 0; i < outputs; i++ {
+		tx.Vout = append(tx.Vout, &TXOutput{
+			Value:        int(int64(r.ReadUint64())),
+			ScriptPubKey: r.ReadBytes(),
+		})
+	}
+
+	tx.LockTime = int(r.ReadUint32())
+
+	if r.Err() != nil {
+		return nil
+	}
+
+	tx.ID, _ = tx.Hash()
+
+	return tx
+}
+
+// Hash returns the hash of the transaction, which is used as its ID
+func (tx *Transaction) Hash() ([]byte, error) {
 	ser, err := tx.Serialize()
 	if err != nil {
 		return nil, err
@@ -56,8 +134,9 @@ func (tx *Transaction) Hash() ([]byte, error) {
 	return hash[:], nil
 }
 
-// Sign signs each input of a Transaction
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
+// Sign signs each input of a Transaction, which must all spend outputs
+// paying the public key hash of privKey
+func (tx *Transaction) Sign(privKey *PrivateKey, prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
 		return nil
 	}
@@ -68,32 +147,38 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-
-	for inID, vin := range txCopy.Vin {
+	for inID, vin := range tx.Vin {
 		prevTX := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTX.Vout[vin.Vout].PubKeyHash
-		h, err := txCopy.Hash()
+		if vin.Vout < 0 || vin.Vout >= len(prevTX.Vout) {
+			return fmt.Errorf("previous transaction %x has no output %d", vin.Txid, vin.Vout)
+		}
+
+		hash, err := tx.signatureHash(inID, prevTX.Vout[vin.Vout].ScriptPubKey)
 		if err != nil {
 			return err
 		}
-		txCopy.ID = h
-		txCopy.Vin[inID].PubKey = nil
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
+		sig, err := privKey.Sign(hash)
 		if err != nil {
 			return err
 		}
 
-		sig := append(r.Bytes(), s.Bytes()...)
-
-		tx.Vin[inID].Signature = sig
+		tx.Vin[inID].ScriptSig = SignatureScript(sig, privKey.PublicKey())
 	}
 
 	return nil
 }
 
+// signatureHash returns the hash an input's signatures sign: that of the
+// transaction with every signature script removed and the script being run
+// in place of the input's
+func (tx *Transaction) signatureHash(inID int, script []byte) ([]byte, error) {
+	txCopy := tx.TrimmedCopy()
+	txCopy.Vin[inID].ScriptSig = script
+
+	return txCopy.Hash()
+}
+
 // String returns a human-readable representation of a transaction
 func (tx Transaction) String() string {
 	var lines []string
@@ -104,14 +189,21 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Vout))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PubKey))
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("       Data:      %x", input.ScriptSig))
+		} else {
+			lines = append(lines, fmt.Sprintf("       Script:    %s", DisasmScript(input.ScriptSig)))
+		}
 	}
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("       Script: %x", output.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("       Script: %s", DisasmScript(output.ScriptPubKey)))
+	}
+
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     Lock time: %d", tx.LockTime))
 	}
 
 	return strings.Join(lines, "\n")
@@ -123,21 +215,22 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []*TXOutput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, &TXInput{vin.Txid, vin.Vout, nil, nil})
+		inputs = append(inputs, &TXInput{vin.Txid, vin.Vout, nil})
 	}
 
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, &TXOutput{vout.Value, vout.PubKeyHash})
+		outputs = append(outputs, &TXOutput{vout.Value, vout.ScriptPubKey})
 	}
 
 	return Transaction{
-		ID:   tx.ID,
-		Vin:  inputs,
-		Vout: outputs,
+		ID:       tx.ID,
+		Vin:      inputs,
+		Vout:     outputs,
+		LockTime: tx.LockTime,
 	}
 }
 
-// Verify verifies the signatures of the transaction inputs
+// Verify runs the scripts of each input with those of the outputs they spend
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) (bool, error) {
 	if tx.IsCoinbase() {
 		return true, nil
@@ -149,38 +242,13 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) (bool, error) {
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
 	for inID, vin := range tx.Vin {
 		prevTX := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTX.Vout[vin.Vout].PubKeyHash
-		h, err := txCopy.Hash()
-		if err != nil {
-			return false, err
-		}
-		txCopy.ID = h
-		txCopy.Vin[inID].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{
-			Curve: curve,
-			X:     &x,
-			Y:     &y,
+		if vin.Vout < 0 || vin.Vout >= len(prevTX.Vout) {
+			return false, nil
 		}
-		if !ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) {
+
+		if err := VerifyScript(tx, inID, prevTX.Vout[vin.Vout].ScriptPubKey); err != nil {
 			return false, nil
 		}
 	}
@@ -188,42 +256,48 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) (bool, error) {
 	return true, nil
 }
 
-// NewCoinbaseTransaction creates a new coinbase transaction
-func NewCoinbaseTransaction(to, data string) (*Transaction, error) {
+// NewCoinbaseTransaction creates a new coinbase transaction paying the
+// block subsidy and the fees of the other transactions in the block
+func NewCoinbaseTransaction(to, data string, fees int) (*Transaction, error) {
 	if data == "" {
-		data = fmt.Sprintf("Reward to '%s'", to)
+		// Random data keeps coinbase transactions paying the same address unique
+		randData := make([]byte, 20)
+		if _, err := rand.Read(randData); err != nil {
+			return nil, err
+		}
+
+		data = fmt.Sprintf("Reward to '%s' %x", to, randData)
 	}
 
 	txin := &TXInput{
 		Txid:      []byte{},
 		Vout:      -1,
-		Signature: nil,
-		PubKey:    []byte(data),
+		ScriptSig: []byte(data),
 	}
 
-	txout := NewTXOutput(subsidy, to)
+	txout, err := NewTXOutput(activeNet.Subsidy+fees, to)
+	if err != nil {
+		return nil, err
+	}
 
-	tx := Transaction{
+	tx := &Transaction{
 		ID:   nil,
 		Vin:  []*TXInput{txin},
 		Vout: []*TXOutput{txout},
 	}
 
-	id, err := tx.Hash()
-	if err != nil {
-		return nil, err
-	}
-	tx.ID = id
-
-	return &tx, nil
+	return tx, tx.setID()
 }
 
-// NewUTXOTransaction creates a new transaction
-func NewUTXOTransaction(from, to string, amount int, UTXOSet *UTXOSet) (*Transaction, error) {
+// NewUTXOTransaction creates a new transaction paying a fee of feeRate
+// coins per 1000 bytes from an address in wallets, failing with
+// ErrWalletLocked if they are encrypted and locked. Change goes to a new
+// change address of wallets with a seed, which must then be saved
+func NewUTXOTransaction(wallets *Wallets, from, to string, amount, feeRate int, UTXOSet *UTXOSet) (*Transaction, error) {
 	var inputs []*TXInput
 	var outputs []*TXOutput
 
-	wallets, err := NewWallets()
+	privateKey, err := wallets.PrivateKey(from)
 	if err != nil {
 		return nil, err
 	}
@@ -234,36 +308,41 @@ func NewUTXOTransaction(from, to string, amount int, UTXOSet *UTXOSet) (*Transac
 		return nil, err
 	}
 
-	acc, validOutputs, err := UTXOSet.FindSpendableOutputs(pubKeyHash, amount)
+	acc, validOutputs, err := UTXOSet.FindSpendableOutputs(PayToPubKeyHashScript(pubKeyHash), amount, feeRate)
 	if err != nil {
 		return nil, err
 	}
 
-	if acc < amount {
+	fee := EstimateFee(len(validOutputs), 2, feeRate)
+	if acc < amount+fee {
 		return nil, errors.New("not enough funds")
 	}
 
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			return nil, err
+	for _, outpoint := range validOutputs {
+		input := &TXInput{
+			Txid: outpoint.Txid,
+			Vout: outpoint.Vout,
 		}
 
-		for _, out := range outs {
-			input := &TXInput{
-				Txid:      txID,
-				Vout:      out,
-				Signature: nil,
-				PubKey:    wallet.PublicKey,
-			}
+		inputs = append(inputs, input)
+	}
 
-			inputs = append(inputs, input)
-		}
+	output, err := NewTXOutput(amount, to)
+	if err != nil {
+		return nil, err
 	}
+	outputs = append(outputs, output)
+	if acc > amount+fee {
+		change, err := wallets.ChangeAddress(from)
+		if err != nil {
+			return nil, err
+		}
 
-	outputs = append(outputs, NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, NewTXOutput(acc-amount, from)) // change
+		output, err = NewTXOutput(acc-amount-fee, change)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
 	}
 
 	tx := &Transaction{
@@ -272,16 +351,23 @@ func NewUTXOTransaction(from, to string, amount int, UTXOSet *UTXOSet) (*Transac
 		Vout: outputs,
 	}
 
-	id, err := tx.Hash()
-	if err != nil {
-		return nil, err
+	// The outputs spent may be those of unconfirmed transactions, so the
+	// transactions are looked up in the mempool as well as the blockchain
+	prevTXs := make(map[string]Transaction)
+	for _, vin := range tx.Vin {
+		prevTX, err := UTXOSet.findTransaction(vin.Txid)
+		if err != nil {
+			return nil, err
+		}
+
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
-	tx.ID = id
 
-	err = UTXOSet.Blockchain.SignTransaction(tx, wallet.PrivateKey)
-	if err != nil {
+	if err = tx.Sign(privateKey, prevTXs); err != nil {
 		return nil, err
 	}
 
-	return tx, nil
+	// The signatures are part of the serialized transaction, so the ID can
+	// only be worked out once it is signed
+	return tx, tx.setID()
 }
@@ -4,19 +4,33 @@ import (
 	"bytes"
 )
 
-// TXInput represents a transaction input
+// TXInput represents a transaction input. ScriptSig pushes what the script
+// of the output spent needs to succeed, or holds arbitrary data in a
+// coinbase
 type TXInput struct {
 	Txid      []byte
 	Vout      int
-	Signature []byte
-	PubKey    []byte
+	ScriptSig []byte
 }
 
 // UsesKey checks whether the address initiated the transaction
 func (in *TXInput) UsesKey(pubKeyHash []byte) (bool, error) {
-	lockingHash, err := HashPublicKey(in.PubKey)
+	pubKey := extractSignaturePubKey(in.ScriptSig)
+	if pubKey == nil {
+		return false, nil
+	}
+
+	lockingHash, err := HashPublicKey(pubKey)
 	if err != nil {
 		return false, err
 	}
 	return bytes.Compare(lockingHash, pubKeyHash) == 0, nil
 }
+
+// Outpoint returns the outpoint of the output spent by the input
+func (in *TXInput) Outpoint() Outpoint {
+	return Outpoint{
+		Txid: in.Txid,
+		Vout: in.Vout,
+	}
+}
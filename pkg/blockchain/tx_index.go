@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+// txIndexBucket maps the ID of every transaction on the best chain to the
+// block holding it. The index is optional: it is only kept up to date once
+// it has been built with ReindexTransactions
+const txIndexBucket = "txindex"
+
+// txIndexEntry locates a transaction within a block
+type txIndexEntry struct {
+	BlockHash []byte
+	Position  int
+}
+
+func (e txIndexEntry) serialize() []byte {
+	w := &util.Writer{}
+
+	w.WriteFixed(e.BlockHash, sha256.Size)
+	w.WriteUint32(uint32(e.Position))
+
+	return w.Bytes()
+}
+
+func deserializeTxIndexEntry(data []byte) (*txIndexEntry, error) {
+	r := util.NewReader(data)
+
+	entry := &txIndexEntry{
+		BlockHash: r.ReadFixed(sha256.Size),
+		Position:  int(r.ReadUint32()),
+	}
+
+	if err := r.Finish(); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode transaction index entry")
+	}
+
+	return entry, nil
+}
+
+// HasTxIndex reports whether the transaction index has been built
+func (bc *Blockchain) HasTxIndex() (bool, error) {
+	found := false
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(txIndexBucket)) != nil
+
+		return nil
+	})
+
+	return found, err
+}
+
+// ReindexTransactions builds the transaction index from the blocks of the
+// best chain, replacing any existing index. From then on it is updated as
+// blocks are connected and disconnected
+func (bc *Blockchain) ReindexTransactions() error {
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(txIndexBucket)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(txIndexBucket)); err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte(blocksBucket))
+		heights := tx.Bucket([]byte(heightIndexBucket))
+
+		c := heights.Cursor()
+		for _, hash := c.First(); hash != nil; _, hash = c.Next() {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+
+			if err = indexTransactions(tx, block); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// indexTransactions adds the transactions of a block connected to the best
+// chain to the index, if there is one
+func indexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for i, t := range block.Transactions {
+		entry := txIndexEntry{BlockHash: block.Hash, Position: i}
+		if err := b.Put(t.ID, entry.serialize()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexTransactions removes the transactions of a block disconnected from
+// the best chain from the index, if there is one
+func unindexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for _, t := range block.Transactions {
+		if err := b.Delete(t.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookupTransaction finds a transaction through the index. The last return
+// value is false when there is no index to look in
+func (bc *Blockchain) lookupTransaction(ID []byte) (*Block, int, bool, error) {
+	var entry *txIndexEntry
+	indexed := false
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+		if b == nil {
+			return nil
+		}
+		indexed = true
+
+		data := b.Get(ID)
+		if data == nil {
+			return nil
+		}
+
+		var err error
+		entry, err = deserializeTxIndexEntry(data)
+		return err
+	})
+	if err != nil || !indexed {
+		return nil, 0, indexed, err
+	}
+
+	if entry == nil {
+		return nil, 0, true, errors.New("transaction is not found")
+	}
+
+	block, err := bc.GetBlock(entry.BlockHash)
+	if err != nil {
+		return nil, 0, true, err
+	}
+
+	if entry.Position >= len(block.Transactions) || !bytes.Equal(block.Transactions[entry.Position].ID, ID) {
+		return nil, 0, true, errors.Errorf("transaction index entry for %x is corrupt, run reindex -txindex", ID)
+	}
+
+	return block, entry.Position, true, nil
+}
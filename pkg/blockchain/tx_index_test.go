@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// checkFindTransaction checks that FindTransactionBlock finds a transaction
+// at its position in block
+func checkFindTransaction(t *testing.T, bc *Blockchain, tx *Transaction, block *Block, position int) {
+	t.Helper()
+
+	found, i, err := bc.FindTransactionBlock(tx.ID)
+	if err != nil {
+		t.Fatalf("finding %x: %v", tx.ID, err)
+	}
+	if !bytes.Equal(found.Hash, block.Hash) || i != position {
+		t.Errorf("transaction %x found at %d of block %d, want %d of block %d", tx.ID, i, found.Height, position, block.Height)
+	}
+
+	got, err := bc.FindTransaction(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.ID, tx.ID) {
+		t.Errorf("FindTransaction(%x) returned %x", tx.ID, got.ID)
+	}
+}
+
+func TestTransactionIndex(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := bc.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payBob := spendOutput(t, wallets, alice, first.Transactions[0], 0, 40, bob)
+	second, err := bc.MineBlock([]*Transaction{coinbase(t, alice, activeNet.Subsidy-40), payBob})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the index transactions are found by scanning
+	if indexed, err := bc.HasTxIndex(); err != nil || indexed {
+		t.Fatalf("transaction index exists before reindexing: %v", err)
+	}
+	checkFindTransaction(t, bc, payBob, second, 1)
+
+	if err = bc.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	if indexed, err := bc.HasTxIndex(); err != nil || !indexed {
+		t.Fatalf("transaction index is missing after reindexing: %v", err)
+	}
+	checkIndexedTransaction(t, bc, first.Transactions[0], first)
+	checkIndexedTransaction(t, bc, payBob, second)
+	checkFindTransaction(t, bc, payBob, second, 1)
+
+	// Blocks connected once the index is built are added to it
+	payAlice := spendOutput(t, wallets, bob, payBob, 0, 30, alice)
+	third, err := bc.MineBlock([]*Transaction{coinbase(t, bob, 10), payAlice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndexedTransaction(t, bc, payAlice, third)
+	checkFindTransaction(t, bc, third.Transactions[0], third, 0)
+
+	if err = bc.disconnectBlock(third.Hash); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexedTransaction(t, bc, payAlice, nil)
+	checkIndexedTransaction(t, bc, third.Transactions[0], nil)
+	checkIndexedTransaction(t, bc, payBob, second)
+	if _, err = bc.FindTransaction(payAlice.ID); err == nil {
+		t.Error("found a transaction of a disconnected block")
+	}
+
+	// An entry pointing at the wrong transaction is reported, and
+	// reindexing repairs it
+	err = bc.DB.Update(func(tx *bolt.Tx) error {
+		entry := txIndexEntry{BlockHash: second.Hash, Position: 0}
+		return tx.Bucket([]byte(txIndexBucket)).Put(payBob.ID, entry.serialize())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.FindTransaction(payBob.ID); err == nil {
+		t.Error("corrupt index entry was not reported")
+	}
+
+	if err = bc.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	checkFindTransaction(t, bc, payBob, second, 1)
+	checkIndexedTransaction(t, bc, payAlice, nil)
+}
@@ -0,0 +1,291 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+// TxProof shows that a transaction is in a block to a client that only has
+// the block header
+type TxProof struct {
+	BlockHash   []byte
+	Transaction *Transaction
+	Proof       *MerkleProof
+}
+
+// Verify checks the proof against the header of the block it names
+func (p *TxProof) Verify(header *BlockHeader) error {
+	if !bytes.Equal(header.Hash(), p.BlockHash) {
+		return fmt.Errorf("proof is for block %x, not %x", p.BlockHash, header.Hash())
+	}
+
+	// The ID of a decoded transaction is always the hash of its encoding,
+	// but a proof may have been built by hand
+	id, err := p.Transaction.Hash()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(id, p.Transaction.ID) {
+		return fmt.Errorf("transaction %x does not match its ID", p.Transaction.ID)
+	}
+
+	if !VerifyMerkleProof(id, p.Proof, header.MerkleRoot) {
+		return fmt.Errorf("transaction %x is not in block %x", id, p.BlockHash)
+	}
+
+	return nil
+}
+
+// Serialize encodes the proof as the block hash, the transaction and the
+// index and siblings of the Merkle proof
+func (p *TxProof) Serialize() ([]byte, error) {
+	ser, err := p.Transaction.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &util.Writer{}
+	w.WriteFixed(p.BlockHash, sha256.Size)
+	w.WriteBytes(ser)
+	w.WriteUint32(uint32(p.Proof.Index))
+	w.WriteUint32(uint32(len(p.Proof.Siblings)))
+	for _, sibling := range p.Proof.Siblings {
+		w.WriteFixed(sibling, sha256.Size)
+	}
+
+	return w.Bytes(), nil
+}
+
+// DeserializeTxProof decodes a serialized proof
+func DeserializeTxProof(data []byte) (*TxProof, error) {
+	r := util.NewReader(data)
+	p := &TxProof{
+		BlockHash: r.ReadFixed(sha256.Size),
+		Proof:     &MerkleProof{},
+	}
+	ser := r.ReadBytes()
+	p.Proof.Index = int(r.ReadUint32())
+
+	count := r.ReadCount(sha256.Size)
+	for i := 0; i < count; i++ {
+		p.Proof.Siblings = append(p.Proof.Siblings, r.ReadFixed(sha256.Size))
+	}
+
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction proof: %v", err)
+	}
+
+	tx, err := DeserializeTransaction(ser)
+	if err != nil {
+		return nil, err
+	}
+	p.Transaction = tx
+
+	return p, nil
+}
+
+// TouchesKeys reports whether a transaction pays or spends from any of the
+// public key hashes
+func (tx *Transaction) TouchesKeys(pubKeyHashes [][]byte) (bool, error) {
+	for _, pubKeyHash := range pubKeyHashes {
+		for _, out := range tx.Vout {
+			if out.IsLockedWithKey(pubKeyHash) {
+				return true, nil
+			}
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for _, in := range tx.Vin {
+			uses, err := in.UsesKey(pubKeyHash)
+			if err != nil {
+				return false, err
+			}
+			if uses {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// FindTransactionProofs returns proofs for every transaction on the main
+// chain paying or spending from the public key hashes, oldest first. The
+// address index is used when it has been built, and otherwise every block
+// is scanned
+func (bc *Blockchain) FindTransactionProofs(pubKeyHashes [][]byte) ([]*TxProof, error) {
+	var proofs []*TxProof
+	indexed := false
+
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(addressIndexBucket))
+		if b == nil {
+			return nil
+		}
+
+		indexed = true
+		var err error
+		proofs, err = indexedTransactionProofs(tx, b, pubKeyHashes)
+		return err
+	})
+	if err != nil || indexed {
+		return proofs, err
+	}
+
+	return bc.scanTransactionProofs(pubKeyHashes)
+}
+
+// txPosition locates a transaction on the best chain
+type txPosition struct {
+	Height   int
+	Position int
+}
+
+// indexedTransactionProofs builds the proofs of FindTransactionProofs from
+// the address index, reading only the blocks that hold the transactions
+func indexedTransactionProofs(tx *bolt.Tx, b *bolt.Bucket, pubKeyHashes [][]byte) ([]*TxProof, error) {
+	var positions []txPosition
+	seen := make(map[txPosition]bool)
+
+	for _, pubKeyHash := range pubKeyHashes {
+		// An empty hash would match the whole index
+		if len(pubKeyHash) == 0 {
+			continue
+		}
+
+		err := forEachAddressTx(b, pubKeyHash, func(height, position int, v []byte) error {
+			pos := txPosition{Height: height, Position: position}
+			if !seen[pos] {
+				seen[pos] = true
+				positions = append(positions, pos)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Height != positions[j].Height {
+			return positions[i].Height < positions[j].Height
+		}
+		return positions[i].Position < positions[j].Position
+	})
+
+	var proofs []*TxProof
+	var block *Block
+	var tree *MerkleTree
+	for _, pos := range positions {
+		if block == nil || block.Height != pos.Height {
+			hash, err := getHeightIndexHash(tx, pos.Height)
+			if err != nil {
+				return nil, err
+			}
+			if block, err = DeserializeBlock(tx.Bucket([]byte(blocksBucket)).Get(hash)); err != nil {
+				return nil, err
+			}
+			tree = block.MerkleTree()
+		}
+
+		if pos.Position >= len(block.Transactions) {
+			return nil, fmt.Errorf("address index names transaction %d of block %x, which has %d", pos.Position, block.Hash, len(block.Transactions))
+		}
+
+		proof, err := tree.Proof(pos.Position)
+		if err != nil {
+			return nil, err
+		}
+
+		proofs = append(proofs, &TxProof{
+			BlockHash:   block.Hash,
+			Transaction: block.Transactions[pos.Position],
+			Proof:       proof,
+		})
+	}
+
+	return proofs, nil
+}
+
+// scanTransactionProofs builds the proofs of FindTransactionProofs by
+// checking every transaction of the main chain
+func (bc *Blockchain) scanTransactionProofs(pubKeyHashes [][]byte) ([]*TxProof, error) {
+	var proofs []*TxProof
+	bci := bc.Iterator()
+
+	for {
+		b, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var tree *MerkleTree
+		for i := len(b.Transactions) - 1; i >= 0; i-- {
+			tx := b.Transactions[i]
+
+			touches, err := tx.TouchesKeys(pubKeyHashes)
+			if err != nil {
+				return nil, err
+			}
+			if !touches {
+				continue
+			}
+
+			if tree == nil {
+				tree = b.MerkleTree()
+			}
+			proof, err := tree.Proof(i)
+			if err != nil {
+				return nil, err
+			}
+
+			proofs = append(proofs, &TxProof{
+				BlockHash:   b.Hash,
+				Transaction: tx,
+				Proof:       proof,
+			})
+		}
+
+		if len(b.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	for i, j := 0, len(proofs)-1; i < j; i, j = i+1, j-1 {
+		proofs[i], proofs[j] = proofs[j], proofs[i]
+	}
+
+	return proofs, nil
+}
+
+// GetBlockHeaders returns up to max headers of the blocks that follow the
+// first locator hash found in the blockchain, as for GetBlockHashes
+func (bc *Blockchain) GetBlockHeaders(locator [][]byte, stop []byte, max int) ([]*BlockHeader, error) {
+	hashes, err := bc.GetBlockHashes(locator, stop, max)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []*BlockHeader
+	for _, hash := range hashes {
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		header := block.BlockHeader
+		headers = append(headers, &header)
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// pubKeyHash returns the public key hash an address pays
+func pubKeyHash(t *testing.T, address string) []byte {
+	script, err := PayToAddressScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ExtractPubKeyHash(script)
+}
+
+// checkProofs checks that proofs prove exactly txs, in order
+func checkProofs(t *testing.T, bc *Blockchain, proofs []*TxProof, txs ...*Transaction) {
+	t.Helper()
+
+	if len(proofs) != len(txs) {
+		t.Fatalf("got %d proofs, want %d", len(proofs), len(txs))
+	}
+
+	for i, proof := range proofs {
+		if !bytes.Equal(proof.Transaction.ID, txs[i].ID) {
+			t.Errorf("proof %d is of %x, want %x", i, proof.Transaction.ID, txs[i].ID)
+		}
+
+		block, err := bc.GetBlock(proof.BlockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = proof.Verify(&block.BlockHeader); err != nil {
+			t.Errorf("proof %d: %v", i, err)
+		}
+	}
+}
+
+func TestFindTransactionProofs(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payBob := spendOutput(t, wallets, alice, first.Transactions[0], 0, 40, bob)
+	second, err := bc.MineBlock([]*Transaction{coinbase(t, alice, activeNet.Subsidy-40), payBob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payCarol := spendOutput(t, wallets, bob, payBob, 0, 30, carol)
+	if _, err = bc.MineBlock([]*Transaction{coinbase(t, carol, 10), payCarol}); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []struct {
+		name string
+		keys [][]byte
+		want []*Transaction
+	}{
+		{"bob", [][]byte{pubKeyHash(t, bob)}, []*Transaction{payBob, payCarol}},
+		{"alice and bob", [][]byte{pubKeyHash(t, bob), pubKeyHash(t, alice)}, []*Transaction{first.Transactions[0], second.Transactions[0], payBob, payCarol}},
+	}
+
+	// The same proofs come from scanning the chain and from the index
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			if err = bc.ReindexAddresses(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, q := range queries {
+			t.Run(q.name, func(t *testing.T) {
+				proofs, err := bc.FindTransactionProofs(q.keys)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkProofs(t, bc, proofs, q.want...)
+			})
+		}
+	}
+}
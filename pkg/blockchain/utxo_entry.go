@@ -0,0 +1,79 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+// UTXOEntry stores an unspent output in the UTXO set along with the
+// height of the block and whether it was created by a coinbase
+type UTXOEntry struct {
+	Value        int
+	ScriptPubKey []byte
+	Height       int
+	Coinbase     bool
+}
+
+// NewUTXOEntry creates a UTXOEntry for an output created at the given height
+func NewUTXOEntry(out *TXOutput, height int, coinbase bool) *UTXOEntry {
+	return &UTXOEntry{
+		Value:        out.Value,
+		ScriptPubKey: out.ScriptPubKey,
+		Height:       height,
+		Coinbase:     coinbase,
+	}
+}
+
+// PubKeyHash returns the public key hash the entry pays, or nil if it does
+// not pay to a public key hash
+func (e *UTXOEntry) PubKeyHash() []byte {
+	return ExtractPubKeyHash(e.ScriptPubKey)
+}
+
+// IsLockedWithKey checks if the entry can be used by the owner of the pubKey
+func (e *UTXOEntry) IsLockedWithKey(pubKeyHash []byte) bool {
+	return bytes.Compare(e.PubKeyHash(), pubKeyHash) == 0
+}
+
+// Serialize serializes the UTXOEntry
+func (e UTXOEntry) Serialize() ([]byte, error) {
+	w := &util.Writer{}
+	e.encode(w)
+
+	return w.Bytes(), nil
+}
+
+func (e *UTXOEntry) encode(w *util.Writer) {
+	w.WriteUint64(uint64(int64(e.Value)))
+	w.WriteBytes(e.ScriptPubKey)
+	w.WriteUint32(uint32(e.Height))
+	w.WriteBool(e.Coinbase)
+}
+
+// DeserializeUTXOEntry deserializes a UTXOEntry
+func DeserializeUTXOEntry(data []byte) (*UTXOEntry, error) {
+	r := util.NewReader(data)
+	entry := decodeUTXOEntry(r)
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode UTXO entry: %v", err)
+	}
+
+	return entry, nil
+}
+
+func decodeUTXOEntry(r *util.Reader) *UTXOEntry {
+	return &UTXOEntry{
+		Value:        int(int64(r.ReadUint64())),
+		ScriptPubKey: r.ReadBytes(),
+		Height:       int(r.ReadUint32()),
+		Coinbase:     r.ReadBool(),
+	}
+}
+
+// UTXO is an unspent output and the outpoint that references it
+type UTXO struct {
+	Outpoint Outpoint
+	Entry    *UTXOEntry
+}
@@ -1,52 +1,131 @@
 package blockchain
 
 import (
-	"encoding/hex"
+	"bytes"
+	"encoding/binary"
 
 	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
 )
 
-const utxoBucket = "chainstate"
+const (
+	utxoBucket     = "chainstate"
+	utxoMetaBucket = "chainstate_meta"
+
+	// utxoVersion is the layout version of the chainstate bucket. Version 2
+	// stores entries in the canonical binary encoding, version 1 keyed gob
+	// encoded entries by outpoint and earlier databases stored gob encoded
+	// TXOutputs keyed by transaction ID
+	utxoVersion = 2
+)
+
+var utxoVersionKey = []byte("version")
 
 // UTXOSet represents UTXO set
 type UTXOSet struct {
 	Blockchain *Blockchain
+
+	// Mempool, when not nil, is the pool of unconfirmed transactions that
+	// coin selection takes into account: outputs they spend are skipped and
+	// their outputs can be spent before they are mined
+	Mempool *Mempool
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
-	unspendOutputs := make(map[string][]int)
+// FindSpendableOutputs finds and returns unspent outputs locked with script
+// to reference in inputs. Enough outputs are selected to cover amount and
+// the fee at feeRate, which grows with every input added. Confirmed outputs
+// are selected before the unconfirmed outputs of the mempool
+func (u UTXOSet) FindSpendableOutputs(script []byte, amount, feeRate int) (int, []Outpoint, error) {
+	var unspentOutputs []Outpoint
 	accumulated := 0
 	db := u.Blockchain.DB
 
+	var spent map[string]bool
+	var unconfirmed []poolOutput
+	if u.Mempool != nil {
+		spent, unconfirmed = u.Mempool.unspentOutputs(script)
+	}
+
 	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			txID := hex.EncodeToString(k)
-			outs, err := DeserializeOutputs(v)
+		for k, v := c.First(); k != nil && accumulated < amount+EstimateFee(len(unspentOutputs), 2, feeRate); k, v = c.Next() {
+			entry, err := DeserializeUTXOEntry(v)
 			if err != nil {
 				return err
 			}
 
-			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspendOutputs[txID] = append(unspendOutputs[txID], outIdx)
-				}
+			if !bytes.Equal(entry.ScriptPubKey, script) {
+				continue
 			}
+
+			outpoint, err := OutpointFromKey(k)
+			if err != nil {
+				return err
+			}
+			if spent[outpoint.String()] {
+				continue
+			}
+
+			accumulated += entry.Value
+			unspentOutputs = append(unspentOutputs, outpoint)
 		}
 
 		return nil
 	})
+	if err != nil {
+		return 0, nil, err
+	}
 
-	return accumulated, unspendOutputs, err
+	for _, output := range unconfirmed {
+		if accumulated >= amount+EstimateFee(len(unspentOutputs), 2, feeRate) {
+			break
+		}
+
+		accumulated += output.value
+		unspentOutputs = append(unspentOutputs, output.outpoint)
+	}
+
+	return accumulated, unspentOutputs, nil
 }
 
-// FindUTXO finds UTXO for a public key hash
-func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]*TXOutput, error) {
-	var UTXOs []*TXOutput
+// findTransaction finds a transaction in the mempool or the blockchain by ID
+func (u UTXOSet) findTransaction(txid []byte) (Transaction, error) {
+	if u.Mempool != nil {
+		if tx := u.Mempool.Get(txid); tx != nil {
+			return *tx, nil
+		}
+	}
+
+	return u.Blockchain.FindTransaction(txid)
+}
+
+// PubKeyHashes returns the set of public key hashes with unspent outputs
+func (u UTXOSet) PubKeyHashes() (map[string]bool, error) {
+	pubKeyHashes := make(map[string]bool)
+
+	err := u.Blockchain.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(utxoBucket)).ForEach(func(k, v []byte) error {
+			entry, err := DeserializeUTXOEntry(v)
+			if err != nil {
+				return err
+			}
+
+			if pubKeyHash := entry.PubKeyHash(); pubKeyHash != nil {
+				pubKeyHashes[string(pubKeyHash)] = true
+			}
+			return nil
+		})
+	})
+
+	return pubKeyHashes, err
+}
+
+// FindUTXO finds the unspent outputs locked with script, which is that
+// paying an address as given by PayToAddressScript
+func (u UTXOSet) FindUTXO(script []byte) ([]*UTXO, error) {
+	var UTXOs []*UTXO
 	db := u.Blockchain.DB
 
 	err := db.View(func(tx *bolt.Tx) error {
@@ -54,16 +133,21 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]*TXOutput, error) {
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			outs, err := DeserializeOutputs(v)
+			entry, err := DeserializeUTXOEntry(v)
 			if err != nil {
-				return nil
+				return err
 			}
 
-			for _, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) {
-					UTXOs = append(UTXOs, out)
-				}
+			if !bytes.Equal(entry.ScriptPubKey, script) {
+				continue
 			}
+
+			outpoint, err := OutpointFromKey(k)
+			if err != nil {
+				return err
+			}
+
+			UTXOs = append(UTXOs, &UTXO{Outpoint: outpoint, Entry: entry})
 		}
 
 		return nil
@@ -72,19 +156,85 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]*TXOutput, error) {
 	return UTXOs, err
 }
 
+// FindEntry returns the unspent output referenced by an outpoint, or nil
+// if the output is missing or has already been spent
+func (u UTXOSet) FindEntry(outpoint Outpoint) (*UTXOEntry, error) {
+	var entry *UTXOEntry
+	db := u.Blockchain.DB
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+
+		entryBytes := b.Get(outpoint.Key())
+		if entryBytes == nil {
+			return nil
+		}
+
+		var err error
+		entry, err = DeserializeUTXOEntry(entryBytes)
+		return err
+	})
+
+	return entry, err
+}
+
+// HasOutputs checks whether the transaction with the given ID still has
+// unspent outputs in the UTXO set
+func (u UTXOSet) HasOutputs(txid []byte) (bool, error) {
+	found := false
+	db := u.Blockchain.DB
+
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(utxoBucket)).Cursor()
+
+		k, _ := c.Seek(txid)
+		found = k != nil && len(k) == len(txid)+4 && bytes.HasPrefix(k, txid)
+
+		return nil
+	})
+
+	return found, err
+}
+
+// Migrate rebuilds the UTXO set if it was written with an older layout.
+// The old layout dropped spent outputs from a list and so lost the original
+// output indexes, which means it cannot be converted in place and is instead
+// reindexed from the blocks
+func (u UTXOSet) Migrate() error {
+	current := true
+	db := u.Blockchain.DB
+
+	err := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(utxoBucket)) == nil {
+			return nil
+		}
+
+		meta := tx.Bucket([]byte(utxoMetaBucket))
+		current = meta != nil && bytes.Equal(meta.Get(utxoVersionKey), encodeUint32(utxoVersion))
+
+		return nil
+	})
+	if err != nil || current {
+		return err
+	}
+
+	return u.Reindex()
+}
+
 // Reindex rebuilds the UTXO set
 func (u UTXOSet) Reindex() error {
 	db := u.Blockchain.DB
 	bucketName := []byte(utxoBucket)
 
 	err := db.Update(func(tx *bolt.Tx) error {
-		if err := tx.DeleteBucket(bucketName); err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
+		for _, name := range [][]byte{bucketName, []byte(utxoMetaBucket)} {
+			if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
 
-		_, err := tx.CreateBucket(bucketName)
-		if err != nil {
-			return err
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -93,7 +243,7 @@ func (u UTXOSet) Reindex() error {
 		return err
 	}
 
-	UTXO, err := u.Blockchain.FindUTXO()
+	UTXOs, err := u.Blockchain.FindUTXO()
 	if err != nil {
 		return err
 	}
@@ -101,84 +251,100 @@ func (u UTXOSet) Reindex() error {
 	return db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketName)
 
-		for txID, outs := range UTXO {
-			key, err := hex.DecodeString(txID)
+		for _, utxo := range UTXOs {
+			ser, err := utxo.Entry.Serialize()
 			if err != nil {
 				return err
 			}
 
-			ser, err := outs.Serialize()
-			if err != nil {
-				return err
-			}
-
-			if err = b.Put(key, ser); err != nil {
+			if err = b.Put(utxo.Outpoint.Key(), ser); err != nil {
 				return err
 			}
 		}
-		return nil
+
+		return tx.Bucket([]byte(utxoMetaBucket)).Put(utxoVersionKey, encodeUint32(utxoVersion))
 	})
 }
 
-// Update updates the UTXO set with transactions from the Block
-// The Block is considered to be the tip of a blockchain
-func (u UTXOSet) Update(block *Block) error {
-	db := u.Blockchain.DB
+// connect applies the transactions of a block at the given height to the
+// UTXO set within an existing database transaction, returning the outputs
+// it spent so that the block can later be disconnected
+func (u UTXOSet) connect(dbTx *bolt.Tx, block *Block, height int) (*blockUndo, error) {
+	b := dbTx.Bucket([]byte(utxoBucket))
+	undo := &blockUndo{}
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, vin := range tx.Vin {
+				key := vin.Outpoint().Key()
+
+				entryBytes := b.Get(key)
+				if entryBytes == nil {
+					return nil, errors.Errorf("output %s is missing from the UTXO set", vin.Outpoint())
+				}
 
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+				entry, err := DeserializeUTXOEntry(entryBytes)
+				if err != nil {
+					return nil, err
+				}
+				undo.Spent = append(undo.Spent, spentOutput{Outpoint: vin.Outpoint(), Entry: *entry})
 
-		for _, tx := range block.Transactions {
-			if !tx.IsCoinbase() {
-				for _, vin := range tx.Vin {
-					updatedOuts := TXOutputs{}
-					outsBytes := b.Get(vin.Txid)
-					outs, err := DeserializeOutputs(outsBytes)
-					if err != nil {
-						return err
-					}
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.Vout {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(vin.Txid)
-						if err != nil {
-							return err
-						}
-					} else {
-						ser, err := updatedOuts.Serialize()
-						if err != nil {
-							return nil
-						}
-
-						err = b.Put(vin.Txid, ser)
-						if err != nil {
-							return err
-						}
-					}
+				if err = b.Delete(key); err != nil {
+					return nil, err
 				}
 			}
+		}
 
-			newOutputs := TXOutputs{}
-			for _, out := range tx.Vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
+		for outIdx, out := range tx.Vout {
+			outpoint := Outpoint{Txid: tx.ID, Vout: outIdx}
 
-			ser, err := newOutputs.Serialize()
+			ser, err := NewUTXOEntry(out, height, tx.IsCoinbase()).Serialize()
 			if err != nil {
-				return err
+				return nil, err
 			}
 
-			err = b.Put(tx.ID, ser)
-			if err != nil {
+			if err = b.Put(outpoint.Key(), ser); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return undo, nil
+}
+
+// disconnect reverses connect, restoring the outputs a block spent from its
+// undo data and removing the outputs it created. The undo data includes the
+// outputs of transactions in the block spent by later ones, so outputs are
+// removed after they are restored
+func (u UTXOSet) disconnect(dbTx *bolt.Tx, block *Block, undo *blockUndo) error {
+	b := dbTx.Bucket([]byte(utxoBucket))
+
+	for _, spent := range undo.Spent {
+		ser, err := spent.Entry.Serialize()
+		if err != nil {
+			return err
+		}
+
+		if err = b.Put(spent.Outpoint.Key(), ser); err != nil {
+			return err
+		}
+	}
+
+	for _, tx := range block.Transactions {
+		for outIdx := range tx.Vout {
+			outpoint := Outpoint{Txid: tx.ID, Vout: outIdx}
+			if err := b.Delete(outpoint.Key()); err != nil {
 				return err
 			}
 		}
+	}
 
-		return nil
-	})
+	return nil
+}
+
+func encodeUint32(n uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, n)
+
+	return buf
 }
@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestFindSpendableOutputsUsesMempool(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mempool := NewMempool(bc)
+	UTXOSet := UTXOSet{Blockchain: bc, Mempool: mempool}
+
+	first, err := NewUTXOTransaction(wallets, alice, bob, 10, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mempool.Add(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// The only confirmed output is spent by first, so the next payment has
+	// to spend its unconfirmed change
+	second, err := NewUTXOTransaction(wallets, alice, bob, 10, 0, &UTXOSet)
+	if err != nil {
+		t.Fatalf("paying from unconfirmed change: %v", err)
+	}
+	if len(second.Vin) != 1 || !bytes.Equal(second.Vin[0].Txid, first.ID) {
+		t.Fatalf("second payment does not spend the change of the first")
+	}
+	if err = mempool.Add(second); err != nil {
+		t.Fatalf("adding the second payment to the mempool: %v", err)
+	}
+}
+
+func TestReindexKeepsSpendsWithinBlock(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := spendOutput(t, wallets, alice, tip.Transactions[0], 0, 40, bob)
+	child := spendOutput(t, wallets, bob, parent, 0, 30, alice)
+	if _, err = bc.MineBlock([]*Transaction{coinbase(t, alice, activeNet.Subsidy-30), parent, child}); err != nil {
+		t.Fatal(err)
+	}
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	if err = UTXOSet.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkOutput(t, bc, tip.Transactions[0], 0, false)
+	checkOutput(t, bc, parent, 0, false)
+	checkOutput(t, bc, child, 0, true)
+}
+
+func TestNewBlockchainClosesDatabaseOnError(t *testing.T) {
+	bc, _, _ := newTestChain(t)
+	tip := bc.GetBestBlockHash()
+
+	// Without the height index or the entry of the tip the height index
+	// cannot be rebuilt
+	err := bc.DB.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(heightIndexBucket)); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte(blockIndexBucket)).Delete(tip)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.DB.Close()
+
+	if _, err = NewBlockchain(); err == nil {
+		t.Fatal("blockchain with a broken block index was opened")
+	}
+
+	db, err := bolt.Open(DataPath(dbFile), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("database is still locked after a failed open: %v", err)
+	}
+	db.Close()
+}
+
+func TestDisconnectRemovesOutputsSpentWithinBlock(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := spendOutput(t, wallets, alice, tip.Transactions[0], 0, 40, bob)
+	child := spendOutput(t, wallets, bob, parent, 0, 30, alice)
+	block, err := bc.MineBlock([]*Transaction{coinbase(t, alice, activeNet.Subsidy-30), parent, child})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bc.disconnectBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	checkOutput(t, bc, tip.Transactions[0], 0, true)
+	checkOutput(t, bc, parent, 0, false)
+	checkOutput(t, bc, child, 0, false)
+}
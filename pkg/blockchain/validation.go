@@ -0,0 +1,275 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxMoney is the most coins any output, transaction or block may be worth.
+// It keeps every sum of values far from overflowing
+const MaxMoney = 21000000 * 100000000
+
+// ValidateBlock checks that a block follows the consensus rules and can be
+// connected to the tip of the blockchain
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	if !bytes.Equal(block.PrevBlockHash, bc.tip) {
+		return errors.New("block does not extend the current tip")
+	}
+
+	if err := checkBlock(block); err != nil {
+		return err
+	}
+
+	_, height, bits, past, err := bc.nextHeader()
+	if err != nil {
+		return err
+	}
+	if block.Height != height {
+		return fmt.Errorf("block has height %d, expected %d", block.Height, height)
+	}
+	if block.Bits != bits {
+		return fmt.Errorf("block has target %08x, expected %08x", block.Bits, bits)
+	}
+	if err = CheckMedianTime(block.Timestamp, past); err != nil {
+		return err
+	}
+
+	return bc.validateTransactions(block.Transactions, height)
+}
+
+// checkBlock performs the checks that do not depend on the rest of the
+// blockchain: the header, proof of work, timestamp against the local clock,
+// Merkle root and size of the block
+func checkBlock(block *Block) error {
+	// Every block has at least its coinbase
+	if len(block.Transactions) == 0 {
+		return errors.New("block has no transactions")
+	}
+
+	if block.Version < 1 || block.Version > BlockVersion {
+		return fmt.Errorf("block version %d is not supported", block.Version)
+	}
+
+	if !bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+		return errors.New("block hash does not match its header")
+	}
+
+	if err := block.CheckProofOfWork(); err != nil {
+		return err
+	}
+
+	if err := CheckFutureTime(block.Timestamp, time.Now()); err != nil {
+		return err
+	}
+
+	if err := checkMerkleRoot(block); err != nil {
+		return err
+	}
+
+	ser, err := block.Serialize()
+	if err != nil {
+		return err
+	}
+	if len(ser) > MaxBlockSize {
+		return fmt.Errorf("block of %d bytes exceeds the maximum size", len(ser))
+	}
+
+	return nil
+}
+
+// checkMerkleRoot checks that the transactions of a block are the ones its
+// header commits to. Duplicating the last transactions of a level of the
+// Merkle tree leaves the root unchanged (CVE-2012-2459), so a body with a
+// repeated transaction is rejected as a malleated copy of a block that may
+// well be valid
+func checkMerkleRoot(block *Block) error {
+	if !bytes.Equal(block.HashTransactions(), block.MerkleRoot) {
+		return errors.New("block Merkle root does not match its transactions")
+	}
+
+	seen := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		hash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		key := hex.EncodeToString(hash)
+		if seen[key] {
+			return fmt.Errorf("block contains transaction %s more than once", key)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// validateTransactions checks the transactions of a block at height against
+// the UTXO set and the outputs of the transactions before them in the block.
+// The first transaction must be the only coinbase, every input must spend an
+// unspent output exactly once, no transaction may create more value than it
+// spends and every transaction must be final at height
+func (bc *Blockchain) validateTransactions(transactions []*Transaction, height int) error {
+	if len(transactions) == 0 {
+		return errors.New("block has no transactions")
+	}
+
+	if !transactions[0].IsCoinbase() {
+		return errors.New("first transaction is not a coinbase")
+	}
+
+	for _, tx := range transactions {
+		if !tx.IsFinal(height) {
+			return fmt.Errorf("transaction %x is locked until height %d", tx.ID, tx.LockTime)
+		}
+
+		if err := bc.checkUnspentOverwrite(tx); err != nil {
+			return err
+		}
+	}
+
+	UTXOSet := UTXOSet{
+		Blockchain: bc,
+	}
+	spent := make(map[string]bool)
+	fees := 0
+
+	// Outputs of earlier transactions in the block are not in the UTXO set
+	// until it is connected, so they are looked up in the block first
+	blockTXs := map[string]*Transaction{hex.EncodeToString(transactions[0].ID): transactions[0]}
+	lookup := func(outpoint Outpoint) (*UTXOEntry, error) {
+		if prevTX, ok := blockTXs[hex.EncodeToString(outpoint.Txid)]; ok {
+			if outpoint.Vout < 0 || outpoint.Vout >= len(prevTX.Vout) {
+				return nil, nil
+			}
+
+			return NewUTXOEntry(prevTX.Vout[outpoint.Vout], height, prevTX.IsCoinbase()), nil
+		}
+
+		return UTXOSet.FindEntry(outpoint)
+	}
+
+	for i, tx := range transactions[1:] {
+		if tx.IsCoinbase() {
+			return fmt.Errorf("transaction %d is an unexpected coinbase", i+1)
+		}
+
+		fee, err := checkInputs(tx, spent, lookup)
+		if err != nil {
+			return err
+		}
+		fees += fee
+		if fees > MaxMoney {
+			return fmt.Errorf("transactions pay more than %d in fees", MaxMoney)
+		}
+
+		valid, err := bc.verifyTransaction(tx, blockTXs)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("transaction %x has an invalid signature", tx.ID)
+		}
+
+		blockTXs[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	reward, err := sumOutputs(transactions[0])
+	if err != nil {
+		return err
+	}
+
+	if reward > activeNet.Subsidy+fees {
+		return fmt.Errorf("coinbase claims %d but only %d in subsidy and fees is available", reward, activeNet.Subsidy+fees)
+	}
+
+	return nil
+}
+
+// checkUnspentOverwrite rejects a transaction whose ID still has unspent
+// outputs, as connecting it would overwrite them in the UTXO set
+func (bc *Blockchain) checkUnspentOverwrite(tx *Transaction) error {
+	UTXOSet := UTXOSet{
+		Blockchain: bc,
+	}
+
+	unspent, err := UTXOSet.HasOutputs(tx.ID)
+	if err != nil {
+		return err
+	}
+	if unspent {
+		return fmt.Errorf("transaction %x would overwrite unspent outputs", tx.ID)
+	}
+
+	return nil
+}
+
+// checkInputs checks that every input of a non-coinbase transaction spends
+// an output found by lookup that is not already in spent, that no value is
+// above MaxMoney and that the outputs do not exceed the inputs. It returns
+// the fee paid by the transaction
+func checkInputs(tx *Transaction, spent map[string]bool, lookup func(Outpoint) (*UTXOEntry, error)) (int, error) {
+	if len(tx.Vin) == 0 {
+		return 0, fmt.Errorf("transaction %x has no inputs", tx.ID)
+	}
+
+	inputs := 0
+	for _, vin := range tx.Vin {
+		outpoint := vin.Outpoint()
+		if spent[outpoint.String()] {
+			return 0, fmt.Errorf("transaction %x spends %s more than once", tx.ID, outpoint)
+		}
+		spent[outpoint.String()] = true
+
+		entry, err := lookup(outpoint)
+		if err != nil {
+			return 0, err
+		}
+		if entry == nil {
+			return 0, fmt.Errorf("transaction %x spends %s which is missing or already spent", tx.ID, outpoint)
+		}
+
+		if entry.Value < 0 || entry.Value > MaxMoney {
+			return 0, fmt.Errorf("transaction %x spends %s of %d, which is out of range", tx.ID, outpoint, entry.Value)
+		}
+		inputs += entry.Value
+		if inputs > MaxMoney {
+			return 0, fmt.Errorf("transaction %x spends more than %d", tx.ID, MaxMoney)
+		}
+	}
+
+	outputs, err := sumOutputs(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if outputs > inputs {
+		return 0, fmt.Errorf("transaction %x spends %d but only has %d available", tx.ID, outputs, inputs)
+	}
+
+	return inputs - outputs, nil
+}
+
+// sumOutputs returns the total value of the outputs of a transaction,
+// rejecting negative outputs and any output or total above MaxMoney
+func sumOutputs(tx *Transaction) (int, error) {
+	total := 0
+	for _, vout := range tx.Vout {
+		if vout.Value < 0 {
+			return 0, fmt.Errorf("transaction %x has a negative output", tx.ID)
+		}
+		if vout.Value > MaxMoney {
+			return 0, fmt.Errorf("transaction %x has an output of more than %d", tx.ID, MaxMoney)
+		}
+
+		total += vout.Value
+		if total > MaxMoney {
+			return 0, fmt.Errorf("transaction %x pays more than %d", tx.ID, MaxMoney)
+		}
+	}
+
+	return total, nil
+}
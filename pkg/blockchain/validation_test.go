@@ -0,0 +1,236 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+// useTestNetwork switches to regtest in a temporary data directory, which
+// is removed along with the switch when the test ends
+func useTestNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevNet, prevDir := activeNet, dataDir
+	t.Cleanup(func() {
+		activeNet, dataDir = prevNet, prevDir
+		os.RemoveAll(dir)
+	})
+
+	if err = UseNetwork(RegTestParams, dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestChain creates a regtest blockchain in a temporary directory whose
+// first block after genesis pays the returned wallets' first address
+func newTestChain(t *testing.T) (*Blockchain, *Wallets, string) {
+	useTestNetwork(t)
+
+	wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := CreateBlockchain(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.DB.Close() })
+
+	return bc, wallets, address
+}
+
+// spendOutput returns a signed transaction paying value to an address from
+// output vout of prevTX, which pays from in wallets
+func spendOutput(t *testing.T, wallets *Wallets, from string, prevTX *Transaction, vout, value int, to string) *Transaction {
+	output, err := NewTXOutput(value, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &Transaction{
+		Vin:  []*TXInput{{Txid: prevTX.ID, Vout: vout}},
+		Vout: []*TXOutput{output},
+	}
+
+	privKey, err := wallets.PrivateKey(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Sign(privKey, map[string]Transaction{hex.EncodeToString(prevTX.ID): *prevTX}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.setID(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func TestBlockSpendsOutputsOfEarlierTransactions(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := spendOutput(t, wallets, alice, tip.Transactions[0], 0, 40, bob)
+	child := spendOutput(t, wallets, bob, parent, 0, 30, carol)
+
+	mempool := NewMempool(bc)
+	for _, tx := range []*Transaction{parent, child} {
+		if err = mempool.Add(tx); err != nil {
+			t.Fatalf("adding %x to the mempool: %v", tx.ID, err)
+		}
+	}
+
+	txs, fees := mempool.BlockTransactions(MaxBlockSize)
+	if len(txs) != 2 || fees != activeNet.Subsidy-30 {
+		t.Fatalf("got %d transactions paying %d in fees, want 2 paying %d", len(txs), fees, activeNet.Subsidy-30)
+	}
+
+	cb, err := NewCoinbaseTransaction(alice, "", fees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := bc.MineBlock(append([]*Transaction{cb}, txs...))
+	if err != nil {
+		t.Fatalf("mining a parent and child: %v", err)
+	}
+	if string(bc.GetBestBlockHash()) != string(block.Hash) {
+		t.Fatal("block with a parent and child did not become the tip")
+	}
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	entry, err := UTXOSet.FindEntry(Outpoint{Txid: child.ID, Vout: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || entry.Value != 30 {
+		t.Fatalf("output of the child is %+v, want 30 unspent", entry)
+	}
+}
+
+func TestBlockRejectsSpendOfLaterTransaction(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := spendOutput(t, wallets, alice, tip.Transactions[0], 0, 40, bob)
+	child := spendOutput(t, wallets, bob, parent, 0, 30, alice)
+
+	cb, err := NewCoinbaseTransaction(alice, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bc.MineBlock([]*Transaction{cb, child, parent}); err == nil {
+		t.Fatal("block spending an output of a later transaction was accepted")
+	}
+}
+
+func TestCheckInputsBoundsValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   int
+		outputs []int
+	}{
+		{"sum wraps around", 10, []int{math.MaxInt64, math.MaxInt64}},
+		{"output above MaxMoney", MaxMoney + 10, []int{MaxMoney + 1}},
+		{"sum above MaxMoney", MaxMoney, []int{MaxMoney / 2, MaxMoney/2 + 2}},
+		{"input above MaxMoney", MaxMoney + 1, []int{1}},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{ID: []byte{1}, Vin: []*TXInput{{Txid: []byte{2}}}}
+		for _, value := range test.outputs {
+			tx.Vout = append(tx.Vout, &TXOutput{Value: value})
+		}
+		lookup := func(Outpoint) (*UTXOEntry, error) {
+			return &UTXOEntry{Value: test.input}, nil
+		}
+
+		if fee, err := checkInputs(tx, make(map[string]bool), lookup); err == nil {
+			t.Errorf("%s: transaction was accepted with a fee of %d", test.name, fee)
+		}
+	}
+}
+
+func TestBlockRejectsOverflowingCoinbase(t *testing.T) {
+	bc, _, alice := newTestChain(t)
+
+	cb, err := NewCoinbaseTransaction(alice, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb.Vout = append(cb.Vout, &TXOutput{Value: math.MaxInt64, ScriptPubKey: cb.Vout[0].ScriptPubKey})
+	cb.Vout = append(cb.Vout, &TXOutput{Value: math.MaxInt64, ScriptPubKey: cb.Vout[0].ScriptPubKey})
+	if err = cb.setID(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = bc.MineBlock([]*Transaction{cb}); err == nil {
+		t.Fatal("coinbase whose outputs wrap around was accepted")
+	}
+}
+
+func TestAddBlockRejectsMalleatedBody(t *testing.T) {
+	bc, wallets, alice := newTestChain(t)
+	bob, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := spendOutput(t, wallets, alice, tip.Transactions[0], 0, 40, bob)
+	child := spendOutput(t, wallets, bob, parent, 0, 30, alice)
+	cb, err := NewCoinbaseTransaction(alice, "", activeNet.Subsidy-30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := newBlock([]*Transaction{cb, parent, child}, tip.Hash, tip.Height+1, tip.Bits, tip.Timestamp+1)
+
+	// Repeating the last of an odd number of transactions keeps the root
+	mutated := *block
+	mutated.Transactions = append([]*Transaction{cb, parent, child}, child)
+	if !bytes.Equal(mutated.HashTransactions(), block.MerkleRoot) {
+		t.Fatal("repeating the last transaction changed the Merkle root")
+	}
+
+	if err = bc.AddBlock(&mutated); err == nil {
+		t.Fatal("block with a repeated transaction was accepted")
+	}
+	if err = bc.AddBlock(block); err != nil {
+		t.Fatalf("block was rejected after a malleated copy of it: %v", err)
+	}
+	if !bytes.Equal(bc.GetBestBlockHash(), block.Hash) {
+		t.Fatal("block did not become the tip")
+	}
+}
@@ -2,35 +2,45 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"fmt"
 
 	"golang.org/x/crypto/ripemd160"
 
+	"github.com/tcheard/blockchain/pkg/secp256k1"
 	"github.com/tcheard/blockchain/pkg/util"
 )
 
 const (
-	version            = byte(0x00)
 	addressChecksumLen = 4
 )
 
-// Wallet stores private and public keys
+// Wallet stores a secp256k1 private key as 32 bytes and its compressed
+// public key. The private key of an encrypted wallet is kept in
+// EncryptedKey instead, and that of a key derived from the seed is not kept
+// at all but derived again from Path
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey
-	PublicKey  []byte
+	PrivateKey   []byte
+	PublicKey    []byte
+	EncryptedKey []byte
+	Path         string
+
+	// Legacy marks a P-256 key from before wallets used secp256k1, whose
+	// public key is stored as X and Y without leading zeros
+	Legacy bool
 }
 
 // NewWallet creates and returns a Wallet
 func NewWallet() (*Wallet, error) {
-	private, public, err := newKeyPair()
+	private, err := secp256k1.NewPrivateKey()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Wallet{PrivateKey: private, PublicKey: public}, nil
+	return &Wallet{
+		PrivateKey: private.Serialize(),
+		PublicKey:  private.PubKey().SerializeCompressed(),
+	}, nil
 }
 
 // GetAddress returns a wallet's address
@@ -40,15 +50,54 @@ func (w Wallet) GetAddress() ([]byte, error) {
 		return nil, err
 	}
 
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+	return []byte(PubKeyHashToAddress(pubKeyHash)), nil
+}
+
+// PubKeyHashToAddress returns the address paying to a public key hash
+func PubKeyHashToAddress(pubKeyHash []byte) string {
+	return encodeAddress(activeNet.AddressVersion, pubKeyHash)
+}
+
+// ScriptHashToAddress returns the address paying to the hash of a script
+func ScriptHashToAddress(scriptHash []byte) string {
+	return encodeAddress(activeNet.ScriptHashAddressVersion, scriptHash)
+}
+
+func encodeAddress(version byte, hash []byte) string {
+	versionedPayload := append([]byte{version}, hash...)
 	checksum := checksum(versionedPayload)
 
 	fullPayload := append(versionedPayload, checksum...)
 
-	return util.Base58Encode(fullPayload), nil
+	return string(util.Base58Encode(fullPayload))
+}
+
+// AddressToPubKeyHash returns the public key hash an address pays to
+func AddressToPubKeyHash(address string) ([]byte, error) {
+	version, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if version != activeNet.AddressVersion {
+		return nil, fmt.Errorf("address %q pays a script hash, not a public key hash", address)
+	}
+
+	return hash, nil
 }
 
-// HashPublicKey hashes a public key
+// decodeAddress returns the version byte of an address and the hash it pays
+func decodeAddress(address string) (byte, []byte, error) {
+	if !ValidateAddress(address) {
+		return 0, nil, fmt.Errorf("address %q is not valid", address)
+	}
+
+	payload := util.Base58Decode([]byte(address))
+
+	return payload[0], payload[1 : len(payload)-addressChecksumLen], nil
+}
+
+// HashPublicKey hashes a public key in the form it has in inputs, so that
+// addresses of compressed keys are those of Bitcoin
 func HashPublicKey(pubKey []byte) ([]byte, error) {
 	publicSHA := sha256.Sum256(pubKey)
 
@@ -64,24 +113,20 @@ func HashPublicKey(pubKey []byte) ([]byte, error) {
 // ValidateAddress checks if an address is valid
 func ValidateAddress(address string) bool {
 	pubKeyHash := util.Base58Decode([]byte(address))
+	if len(pubKeyHash) <= 1+addressChecksumLen {
+		return false
+	}
+
 	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
 	version := pubKeyHash[0]
+	if version != activeNet.AddressVersion && version != activeNet.ScriptHashAddressVersion {
+		return false
+	}
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
 	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
 	return bytes.Compare(actualChecksum, targetChecksum) == 0
 }
 
-func newKeyPair() (ecdsa.PrivateKey, []byte, error) {
-	c := elliptic.P256()
-	private, err := ecdsa.GenerateKey(c, rand.Reader)
-	if err != nil {
-		return ecdsa.PrivateKey{}, nil, err
-	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-
-	return *private, pubKey, nil
-}
-
 func checksum(payload []byte) []byte {
 	first := sha256.Sum256(payload)
 	second := sha256.Sum256(first[:])
@@ -2,18 +2,77 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/elliptic"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
 )
 
 const walletFile = "wallet.dat"
 
+// walletFileMagic starts wallet files written since keys moved to secp256k1.
+// Files without it hold legacy P-256 keys
+var walletFileMagic = []byte("wallet\x00\x02")
+
+// The scrypt parameters of newly encrypted wallets, which take about 32MB
+// and a tenth of a second to derive a key with
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// walletCheck is encrypted along with the keys so that a wrong passphrase is
+// noticed even when the wallet holds no keys
+var walletCheck = []byte("wallet passphrase check")
+
+var (
+	// ErrWalletLocked is returned when a private key of an encrypted wallet
+	// is needed while the wallet is locked
+	ErrWalletLocked = errors.New("wallet is locked, unlock it with walletpassphrase")
+
+	// ErrWrongPassphrase is returned when unlocking with the wrong passphrase
+	ErrWrongPassphrase = errors.New("passphrase is incorrect")
+)
+
 // Wallets stores a collection of wallets
 type Wallets struct {
 	Wallets map[string]*Wallet
+
+	// Encryption is set once the private keys are encrypted with a passphrase
+	Encryption *WalletEncryption
+
+	// HD is set when new keys are derived from a seed
+	HD *HDSeed
+
+	// Scripts holds the redeem scripts of the multisig addresses added with
+	// AddMultiSig, by address
+	Scripts map[string][]byte
+
+	mu        sync.Mutex
+	key       []byte
+	lockTimer *time.Timer
+}
+
+// WalletEncryption holds what is needed to derive the key of an encrypted
+// wallet from its passphrase
+type WalletEncryption struct {
+	Salt    []byte
+	N, R, P int
+
+	// Check is walletCheck encrypted with the key
+	Check []byte
 }
 
 // NewWallets creates Wallets and fills it from a file if it exists
@@ -24,8 +83,13 @@ func NewWallets() (*Wallets, error) {
 	return wallets, err
 }
 
-// CreateWallet adds a new wallet to wallets
+// CreateWallet adds a new wallet to wallets, deriving its key from the seed
+// if there is one
 func (ws *Wallets) CreateWallet() (string, error) {
+	if ws.HD != nil {
+		return ws.nextAddress(receiveChain)
+	}
+
 	wallet, err := NewWallet()
 	if err != nil {
 		return "", err
@@ -38,6 +102,12 @@ func (ws *Wallets) CreateWallet() (string, error) {
 
 	address := fmt.Sprintf("%s", wAddr)
 
+	if ws.Encryption != nil {
+		if err = ws.encryptKey(wallet); err != nil {
+			return "", err
+		}
+	}
+
 	ws.Wallets[address] = wallet
 
 	return address, nil
@@ -55,42 +125,298 @@ func (ws *Wallets) GetAddresses() []string {
 }
 
 // GetWallet returns a wallet by its address
-func (ws Wallets) GetWallet(address string) *Wallet {
+func (ws *Wallets) GetWallet(address string) *Wallet {
 	return ws.Wallets[address]
 }
 
 // LoadFromFile loads wallets from the file
 func (ws *Wallets) LoadFromFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(DataPath(walletFile)); os.IsNotExist(err) {
 		return err
 	}
 
-	fileContent, err := ioutil.ReadFile(walletFile)
+	fileContent, err := ioutil.ReadFile(DataPath(walletFile))
 	if err != nil {
 		return err
 	}
 
-	var wallets Wallets
-	gob.Register(elliptic.P256())
-	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	if err = decoder.Decode(&wallets); err != nil {
+	wallets := &Wallets{}
+	if bytes.HasPrefix(fileContent, walletFileMagic) {
+		decoder := gob.NewDecoder(bytes.NewReader(fileContent[len(walletFileMagic):]))
+		if err = decoder.Decode(wallets); err != nil {
+			return err
+		}
+	} else if wallets, err = decodeLegacyWallets(fileContent); err != nil {
 		return err
 	}
 
+	// A key derived for different encryption is of no use any more
+	if wallets.Encryption == nil || ws.Encryption == nil || !bytes.Equal(wallets.Encryption.Salt, ws.Encryption.Salt) {
+		ws.Lock()
+	}
+
 	ws.Wallets = wallets.Wallets
+	ws.Encryption = wallets.Encryption
+	ws.HD = wallets.HD
+	ws.Scripts = wallets.Scripts
 	return nil
 }
 
-// SaveToFile saves wallets to a file
+// SaveToFile saves wallets to a file. It fails with ErrLegacyWalletFile
+// rather than replace a legacy wallet file, which only MigrateWalletFile does
 func (ws *Wallets) SaveToFile() error {
-	var content bytes.Buffer
+	legacy, err := isLegacyWalletFile()
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return ErrLegacyWalletFile
+	}
+
+	return ws.writeFile()
+}
 
-	gob.Register(elliptic.P256())
+// writeFile writes wallets to the wallet file in the current format
+func (ws *Wallets) writeFile() error {
+	var content bytes.Buffer
+	content.Write(walletFileMagic)
 
 	encoder := gob.NewEncoder(&content)
 	if err := encoder.Encode(&ws); err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	// Write a new file and move it into place, so that a failure part way
+	// through cannot lose the keys
+	tmpFile := DataPath(walletFile) + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, DataPath(walletFile))
+}
+
+// IsEncrypted reports whether the private keys are encrypted
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.Encryption != nil
+}
+
+// IsLocked reports whether the private keys are encrypted and the key to
+// decrypt them is not held
+func (ws *Wallets) IsLocked() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.Encryption != nil && ws.key == nil
+}
+
+// Encrypt encrypts the private keys with a key derived from passphrase,
+// leaving the wallet locked. The wallets must be saved for it to last
+func (ws *Wallets) Encrypt(passphrase []byte) error {
+	if ws.Encryption != nil {
+		return errors.New("wallet is already encrypted")
+	}
+	if len(passphrase) == 0 {
+		return errors.New("passphrase must not be empty")
+	}
+
+	// Encrypting the keys is pointless while a copy of them is kept in
+	// the clear
+	if _, err := os.Stat(DataPath(legacyWalletFile)); err == nil {
+		return fmt.Errorf("%s holds the unencrypted keys of the wallet from before it was migrated, delete it before encrypting", DataPath(legacyWalletFile))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+
+	enc := &WalletEncryption{Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+	key, err := enc.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	if enc.Check, err = seal(key, walletCheck, nil); err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	ws.key = key
+	ws.mu.Unlock()
+
+	for _, wallet := range ws.Wallets {
+		// Derived keys are not stored, only the seed they come from
+		if wallet.Path != "" {
+			continue
+		}
+
+		if err = ws.encryptKey(wallet); err != nil {
+			ws.Lock()
+			return err
+		}
+	}
+
+	if ws.HD != nil {
+		if err = ws.encryptSeed(ws.HD, ws.HD.Seed); err != nil {
+			ws.Lock()
+			return err
+		}
+	}
+
+	ws.Encryption = enc
+	ws.Lock()
+
+	return nil
+}
+
+// Unlock derives the key of an encrypted wallet from passphrase and holds it
+// so that private keys can be used, locking again after timeout unless it
+// is zero
+func (ws *Wallets) Unlock(passphrase []byte, timeout time.Duration) error {
+	if ws.Encryption == nil {
+		return errors.New("wallet is not encrypted")
+	}
+
+	key, err := ws.Encryption.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	if _, err = open(key, ws.Encryption.Check, nil); err != nil {
+		return ErrWrongPassphrase
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.lockTimer != nil {
+		ws.lockTimer.Stop()
+		ws.lockTimer = nil
+	}
+
+	ws.key = key
+	if timeout > 0 {
+		ws.lockTimer = time.AfterFunc(timeout, ws.Lock)
+	}
+
+	return nil
+}
+
+// Lock forgets the key of an encrypted wallet
+func (ws *Wallets) Lock() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.lockTimer != nil {
+		ws.lockTimer.Stop()
+		ws.lockTimer = nil
+	}
+
+	for i := range ws.key {
+		ws.key[i] = 0
+	}
+	ws.key = nil
+}
+
+// PrivateKey returns the private key of an address, which needs the wallet
+// to be unlocked when it is encrypted
+func (ws *Wallets) PrivateKey(address string) (*PrivateKey, error) {
+	wallet := ws.GetWallet(address)
+	if wallet == nil {
+		return nil, fmt.Errorf("address %s is not in the wallet", address)
+	}
+
+	if wallet.Path != "" {
+		return ws.derivePrivateKey(wallet.Path, wallet.Legacy)
+	}
+
+	if ws.Encryption == nil {
+		return newPrivateKey(wallet.PrivateKey, wallet.Legacy)
+	}
+
+	ws.mu.Lock()
+	key := ws.key
+	ws.mu.Unlock()
+
+	if key == nil {
+		return nil, ErrWalletLocked
+	}
+
+	d, err := open(key, wallet.EncryptedKey, wallet.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key of %s: %v", address, err)
+	}
+
+	return newPrivateKey(d, wallet.Legacy)
+}
+
+// encryptKey replaces the private key of wallet with its encryption under
+// the held key
+func (ws *Wallets) encryptKey(wallet *Wallet) error {
+	ws.mu.Lock()
+	key := ws.key
+	ws.mu.Unlock()
+
+	if key == nil {
+		return ErrWalletLocked
+	}
+
+	// The public key is authenticated along with the private one, so that
+	// keys cannot be swapped between addresses
+	encrypted, err := seal(key, wallet.PrivateKey, wallet.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	wallet.EncryptedKey = encrypted
+	wallet.PrivateKey = nil
+
+	return nil
+}
+
+func (enc *WalletEncryption) deriveKey(passphrase []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, enc.Salt, enc.N, enc.R, enc.P, scryptKeyLen)
+}
+
+// seal encrypts plaintext with AES-256-GCM, returning the nonce followed by
+// the ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts what seal returned
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
 }
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+)
+
+// legacyWalletFile is where MigrateWalletFile keeps the wallet file it
+// replaces
+const legacyWalletFile = "wallet.dat.legacy"
+
+// ErrLegacyWalletFile is returned when saving wallets would replace a legacy
+// wallet file, which must be migrated first
+var ErrLegacyWalletFile = errors.New("wallet file holds P-256 keys from before secp256k1, run migratewallet first")
+
+// The wallet file as it was written before keys moved to secp256k1, when
+// each wallet held a gob encoded ecdsa.PrivateKey on P-256
+type legacyWallets struct {
+	Wallets    map[string]*legacyWallet
+	Encryption *WalletEncryption
+	HD         *HDSeed
+}
+
+type legacyWallet struct {
+	PrivateKey   legacyPrivateKey
+	PublicKey    []byte
+	EncryptedKey []byte
+	Path         string
+}
+
+type legacyPrivateKey struct {
+	PublicKey legacyPublicKey
+	D         *big.Int
+}
+
+type legacyPublicKey struct {
+	Curve interface{}
+	X, Y  *big.Int
+}
+
+// legacyCurve receives the P-256 curve stored with every legacy key, which
+// gob knows by the name of the type crypto/elliptic used for it
+type legacyCurve struct {
+	CurveParams *elliptic.CurveParams
+}
+
+func init() {
+	gob.RegisterName("crypto/elliptic.p256Curve", legacyCurve{})
+}
+
+// decodeLegacyWallets decodes a legacy wallet file, marking its keys as
+// legacy so that they are still used on P-256
+func decodeLegacyWallets(data []byte) (*Wallets, error) {
+	var legacy legacyWallets
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	wallets := &Wallets{
+		Wallets:    make(map[string]*Wallet),
+		Encryption: legacy.Encryption,
+		HD:         legacy.HD,
+	}
+
+	for address, w := range legacy.Wallets {
+		wallet := &Wallet{
+			PublicKey:    w.PublicKey,
+			EncryptedKey: w.EncryptedKey,
+			Path:         w.Path,
+			Legacy:       true,
+		}
+		if w.PrivateKey.D != nil {
+			wallet.PrivateKey = paddedBytes(w.PrivateKey.D, 32)
+		}
+
+		wallets.Wallets[address] = wallet
+	}
+
+	return wallets, nil
+}
+
+// MigrateWalletFile rewrites a legacy wallet file in the current format,
+// keeping a copy of the original as wallet.dat.legacy. The copy holds the
+// keys unencrypted unless the wallet already was, and the wallet cannot be
+// encrypted while it exists. Legacy keys keep their addresses and can still
+// spend, while new keys use secp256k1. It returns the number of legacy keys,
+// and zero if the file is already migrated
+func MigrateWalletFile() (int, error) {
+	content, err := ioutil.ReadFile(DataPath(walletFile))
+	if err != nil {
+		return 0, err
+	}
+	if bytes.HasPrefix(content, walletFileMagic) {
+		return 0, nil
+	}
+
+	wallets, err := decodeLegacyWallets(content)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = ioutil.WriteFile(DataPath(legacyWalletFile), content, 0600); err != nil {
+		return 0, err
+	}
+	// The backup may have been written before with wider permissions
+	if err = os.Chmod(DataPath(legacyWalletFile), 0600); err != nil {
+		return 0, err
+	}
+
+	if err = wallets.writeFile(); err != nil {
+		return 0, err
+	}
+
+	return len(wallets.Wallets), nil
+}
+
+// isLegacyWalletFile reports whether the wallet file exists and is a legacy
+// wallet file
+func isLegacyWalletFile() (bool, error) {
+	content, err := ioutil.ReadFile(DataPath(walletFile))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.HasPrefix(content, walletFileMagic), nil
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// writeLegacyWalletFile writes a wallet file holding one P-256 key as it was
+// written before secp256k1 and returns its address
+func writeLegacyWalletFile(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := append(key.X.Bytes(), key.Y.Bytes()...)
+
+	pubKeyHash, err := HashPublicKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := PubKeyHashToAddress(pubKeyHash)
+
+	legacy := legacyWallets{Wallets: map[string]*legacyWallet{
+		address: {
+			PrivateKey: legacyPrivateKey{
+				PublicKey: legacyPublicKey{Curve: legacyCurve{elliptic.P256().Params()}, X: key.X, Y: key.Y},
+				D:         key.D,
+			},
+			PublicKey: pubKey,
+		},
+	}}
+
+	var content bytes.Buffer
+	if err = gob.NewEncoder(&content).Encode(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(DataPath(walletFile), content.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+func TestMigrateLegacyWalletFile(t *testing.T) {
+	useTestNetwork(t)
+	address := writeLegacyWalletFile(t)
+	original, err := ioutil.ReadFile(DataPath(walletFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := NewWallets()
+	if err != nil {
+		t.Fatalf("loading the legacy wallet file: %v", err)
+	}
+	if err = wallets.SaveToFile(); err != ErrLegacyWalletFile {
+		t.Fatalf("saving over the legacy wallet file gave %v, want ErrLegacyWalletFile", err)
+	}
+
+	legacy, err := MigrateWalletFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy != 1 {
+		t.Fatalf("migrated %d legacy keys, want 1", legacy)
+	}
+
+	backup, err := ioutil.ReadFile(DataPath(legacyWalletFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Fatal("backup differs from the legacy wallet file")
+	}
+
+	if legacy, err = MigrateWalletFile(); err != nil || legacy != 0 {
+		t.Fatalf("migrating again gave %d, %v, want 0, nil", legacy, err)
+	}
+
+	wallets, err = NewWallets()
+	if err != nil {
+		t.Fatalf("loading the migrated wallet file: %v", err)
+	}
+	wallet := wallets.GetWallet(address)
+	if wallet == nil || !wallet.Legacy {
+		t.Fatalf("migrated wallet does not hold the legacy address %s", address)
+	}
+
+	privKey, err := wallets.PrivateKey(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("migrated"))
+	sig, err := privKey.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(wallet.PublicKey, hash[:], sig) {
+		t.Fatal("signature of the migrated legacy key does not verify")
+	}
+
+	if err = wallets.Encrypt([]byte("passphrase")); err == nil {
+		t.Fatal("wallet was encrypted while the unencrypted backup exists")
+	}
+	if err = os.Remove(DataPath(legacyWalletFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err = wallets.Encrypt([]byte("passphrase")); err != nil {
+		t.Fatalf("encrypting once the backup is deleted: %v", err)
+	}
+	if err = wallets.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+}
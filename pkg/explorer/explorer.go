@@ -0,0 +1,343 @@
+package explorer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// blocksPerPage is how many blocks the latest blocks page lists
+const blocksPerPage = 20
+
+var funcs = template.FuncMap{
+	"hex": hex.EncodeToString,
+	"asm": blockchain.DisasmScript,
+	"time": func(timestamp int64) string {
+		return time.Unix(timestamp, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"valueOut": func(tx *blockchain.Transaction) int {
+		total := 0
+		for _, out := range tx.Vout {
+			total += out.Value
+		}
+		return total
+	},
+}
+
+type indexData struct {
+	BestHeight int
+	Blocks     []*blockchain.Block
+	Next       int
+}
+
+type blockData struct {
+	Block         *blockchain.Block
+	Confirmations int
+	NextHash      []byte
+	Target        string
+	PoWValid      bool
+}
+
+type txData struct {
+	Tx            *blockchain.Transaction
+	Block         *blockchain.Block
+	Confirmations int
+	Fee           int
+	Inputs        []txInput
+	Outputs       []txOutput
+}
+
+// txInput is an input along with the output it spends, which is nil if it
+// cannot be found
+type txInput struct {
+	In       *blockchain.TXInput
+	Coinbase bool
+	Source   *blockchain.TXOutput
+	Address  string
+}
+
+type txOutput struct {
+	Out     *blockchain.TXOutput
+	Address string
+}
+
+type addressData struct {
+	Address string
+	Balance int
+	UTXOs   []*blockchain.UTXO
+	Indexed bool
+	History []historyEntry
+}
+
+// historyEntry is a transaction of an address with the balance after it
+type historyEntry struct {
+	blockchain.AddressTx
+	Balance int
+}
+
+// Explorer serves HTML pages for browsing a blockchain
+type Explorer struct {
+	chain *blockchain.Blockchain
+}
+
+// NewExplorer creates an Explorer over chain, which it only reads from
+func NewExplorer(chain *blockchain.Blockchain) *Explorer {
+	return &Explorer{chain: chain}
+}
+
+// Handler serves the latest blocks at /, and pages for blocks, transactions
+// and addresses at /block/{hash}, /tx/{id} and /address/{addr}
+func (e *Explorer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", e.handleIndex)
+	mux.HandleFunc("/block/", e.handleBlock)
+	mux.HandleFunc("/tx/", e.handleTx)
+	mux.HandleFunc("/address/", e.handleAddress)
+	mux.HandleFunc("/search", e.handleSearch)
+
+	return mux
+}
+
+func (e *Explorer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		renderError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	bestHeight, err := e.chain.GetBestHeight()
+	if err != nil {
+		renderError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	from := bestHeight
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = strconv.Atoi(value); err != nil || from < 0 || from > bestHeight {
+			renderError(w, http.StatusBadRequest, fmt.Sprintf("Height %q is not on the best chain", value))
+			return
+		}
+	}
+
+	data := &indexData{BestHeight: bestHeight}
+	height := from
+	for ; height >= 0 && len(data.Blocks) < blocksPerPage; height-- {
+		block, err := e.chain.GetBlockByHeight(height)
+		if err != nil {
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		data.Blocks = append(data.Blocks, block)
+	}
+	data.Next = height
+
+	render(w, indexPage, data)
+}
+
+func (e *Explorer) handleBlock(w http.ResponseWriter, r *http.Request) {
+	hash, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/block/"))
+	if err != nil {
+		renderError(w, http.StatusBadRequest, "Block hashes are written in hex")
+		return
+	}
+
+	block, err := e.chain.GetBlock(hash)
+	if err != nil {
+		renderError(w, http.StatusNotFound, "Block not found")
+		return
+	}
+
+	data := &blockData{
+		Block:    block,
+		Target:   fmt.Sprintf("%064x", blockchain.CompactToBig(block.Bits)),
+		PoWValid: blockchain.NewProofOfWork(block).Validate(),
+	}
+
+	if data.Confirmations, err = e.chain.Confirmations(block); err != nil {
+		renderError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if data.Confirmations > 1 {
+		if data.NextHash, err = e.chain.GetBlockHashByHeight(block.Height + 1); err != nil {
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	render(w, blockPage, data)
+}
+
+func (e *Explorer) handleTx(w http.ResponseWriter, r *http.Request) {
+	txid, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/tx/"))
+	if err != nil {
+		renderError(w, http.StatusBadRequest, "Transaction IDs are written in hex")
+		return
+	}
+
+	block, position, err := e.chain.FindTransactionBlock(txid)
+	if err != nil {
+		renderError(w, http.StatusNotFound, "Transaction not found on the best chain")
+		return
+	}
+
+	tx := block.Transactions[position]
+	data := &txData{Tx: tx, Block: block}
+
+	if data.Confirmations, err = e.chain.Confirmations(block); err != nil {
+		renderError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	valueIn, known := 0, true
+	for _, in := range tx.Vin {
+		input := txInput{In: in, Coinbase: tx.IsCoinbase()}
+
+		if !input.Coinbase {
+			source, err := e.chain.FindTransaction(in.Txid)
+			if err == nil && in.Vout >= 0 && in.Vout < len(source.Vout) {
+				input.Source = source.Vout[in.Vout]
+				input.Address = blockchain.ScriptAddress(input.Source.ScriptPubKey)
+				valueIn += input.Source.Value
+			} else {
+				known = false
+			}
+		}
+
+		data.Inputs = append(data.Inputs, input)
+	}
+
+	valueOut := 0
+	for _, out := range tx.Vout {
+		data.Outputs = append(data.Outputs, txOutput{
+			Out:     out,
+			Address: blockchain.ScriptAddress(out.ScriptPubKey),
+		})
+		valueOut += out.Value
+	}
+
+	if known {
+		data.Fee = valueIn - valueOut
+	}
+
+	render(w, txPage, data)
+}
+
+func (e *Explorer) handleAddress(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/address/")
+
+	script, err := blockchain.PayToAddressScript(address)
+	if err != nil {
+		renderError(w, http.StatusBadRequest, "Address is not valid")
+		return
+	}
+
+	UTXOSet := blockchain.UTXOSet{
+		Blockchain: e.chain,
+	}
+
+	data := &addressData{Address: address}
+	if data.UTXOs, err = UTXOSet.FindUTXO(script); err != nil {
+		renderError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, utxo := range data.UTXOs {
+		data.Balance += utxo.Entry.Value
+	}
+
+	if data.Indexed, err = e.chain.HasAddressIndex(); err != nil {
+		renderError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if data.Indexed {
+		history, err := e.chain.AddressHistory(script)
+		if err != nil {
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// The history is listed newest first with the balance after each
+		// transaction
+		balance := 0
+		data.History = make([]historyEntry, len(history))
+		for i, entry := range history {
+			balance += entry.Delta
+			data.History[len(history)-1-i] = historyEntry{entry, balance}
+		}
+	}
+
+	render(w, addressPage, data)
+}
+
+// handleSearch sends a query to the page for the height, block, transaction
+// or address it names
+func (e *Explorer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if height, err := strconv.Atoi(query); err == nil {
+		hash, err := e.chain.GetBlockHashByHeight(height)
+		if err != nil {
+			renderError(w, http.StatusNotFound, fmt.Sprintf("There is no block at height %d", height))
+			return
+		}
+
+		http.Redirect(w, r, "/block/"+hex.EncodeToString(hash), http.StatusSeeOther)
+		return
+	}
+
+	if blockchain.ValidateAddress(query) {
+		http.Redirect(w, r, "/address/"+query, http.StatusSeeOther)
+		return
+	}
+
+	if hash, err := hex.DecodeString(query); err == nil && len(hash) > 0 {
+		found, err := e.chain.HasBlock(hash)
+		if err != nil {
+			renderError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if found {
+			http.Redirect(w, r, "/block/"+query, http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/tx/"+query, http.StatusSeeOther)
+		}
+		return
+	}
+
+	renderError(w, http.StatusNotFound, fmt.Sprintf("Nothing matches %q", query))
+}
+
+// render executes a page into a buffer first so that a failure can still be
+// reported with an error status
+func render(w http.ResponseWriter, page *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := page.ExecuteTemplate(&buf, "page", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+func renderError(w http.ResponseWriter, status int, message string) {
+	var buf bytes.Buffer
+	if err := errorPage.ExecuteTemplate(&buf, "page", message); err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,209 @@
+package explorer
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// testChain is a regtest chain whose tip pays bob from the coinbase of the
+// first block after genesis, which paid alice, with more blocks than fit
+// on a page before it
+type testChain struct {
+	bc     *blockchain.Blockchain
+	alice  string
+	bob    string
+	payBob *blockchain.Transaction
+	tip    *blockchain.Block
+}
+
+func newTestChain(t *testing.T) *testChain {
+	dir, err := ioutil.TempDir("", "explorer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err = blockchain.UseNetwork(blockchain.RegTestParams, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets := &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)}
+	c := &testChain{}
+	if c.alice, err = wallets.CreateWallet(); err != nil {
+		t.Fatal(err)
+	}
+	if c.bob, err = wallets.CreateWallet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.bc, err = blockchain.CreateBlockchain(c.alice); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.bc.DB.Close() })
+
+	for i := 0; i < blocksPerPage; i++ {
+		mine(t, c.bc, c.bob)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: c.bc}
+	if c.payBob, err = blockchain.NewUTXOTransaction(wallets, c.alice, c.bob, 10, 0, &UTXOSet); err != nil {
+		t.Fatal(err)
+	}
+	c.tip = mine(t, c.bc, c.bob, c.payBob)
+
+	return c
+}
+
+// mine adds a block of txs with a coinbase paying to
+func mine(t *testing.T, bc *blockchain.Blockchain, to string, txs ...*blockchain.Transaction) *blockchain.Block {
+	cb, err := blockchain.NewCoinbaseTransaction(to, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := bc.MineBlock(append([]*blockchain.Transaction{cb}, txs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// get requests a page, returning its status and body
+func get(h http.Handler, path string) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return w.Code, w.Body.String()
+}
+
+// checkPage checks the status of a page and that its body holds each of
+// want
+func checkPage(t *testing.T, h http.Handler, path string, status int, want ...string) {
+	t.Helper()
+
+	code, body := get(h, path)
+	if code != status {
+		t.Errorf("GET %s: status is %d, want %d", path, code, status)
+	}
+	for _, s := range want {
+		if !strings.Contains(body, s) {
+			t.Errorf("GET %s: page does not contain %q", path, s)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	c := newTestChain(t)
+	h := NewExplorer(c.bc).Handler()
+	best := c.tip.Height
+
+	// The first page ends a page short of genesis and links to the rest
+	older := best - blocksPerPage
+	checkPage(t, h, "/", http.StatusOK, hex.EncodeToString(c.tip.Hash), `href="/?from=`+strconv.Itoa(older)+`"`)
+
+	code, body := get(h, "/?from="+strconv.Itoa(older))
+	if code != http.StatusOK {
+		t.Fatalf("GET older blocks: status is %d", code)
+	}
+	if strings.Contains(body, "/?from=") {
+		t.Error("last page links to older blocks")
+	}
+	if got := strings.Count(body, `<td><a href="/block/`); got != older+1 {
+		t.Errorf("last page lists %d blocks, want %d", got, older+1)
+	}
+
+	for _, from := range []string{"-1", strconv.Itoa(best + 1), "tip"} {
+		checkPage(t, h, "/?from="+from, http.StatusBadRequest)
+	}
+	checkPage(t, h, "/nothing", http.StatusNotFound)
+}
+
+func TestBlockAndTxPages(t *testing.T) {
+	c := newTestChain(t)
+	h := NewExplorer(c.bc).Handler()
+
+	genesis, err := c.bc.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.bc.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkPage(t, h, "/block/"+hex.EncodeToString(c.tip.Hash), http.StatusOK, hex.EncodeToString(c.payBob.ID))
+	checkPage(t, h, "/block/"+hex.EncodeToString(genesis.Hash), http.StatusOK, hex.EncodeToString(first.Hash))
+	checkPage(t, h, "/tx/"+hex.EncodeToString(c.payBob.ID), http.StatusOK, c.alice, c.bob)
+
+	checkPage(t, h, "/block/xyz", http.StatusBadRequest)
+	checkPage(t, h, "/tx/xyz", http.StatusBadRequest)
+	checkPage(t, h, "/block/00ff", http.StatusNotFound)
+	checkPage(t, h, "/block/", http.StatusNotFound)
+	checkPage(t, h, "/tx/00ff", http.StatusNotFound)
+}
+
+func TestAddressPage(t *testing.T) {
+	c := newTestChain(t)
+	h := NewExplorer(c.bc).Handler()
+
+	checkPage(t, h, "/address/"+c.bob, http.StatusOK, c.bob)
+	checkPage(t, h, "/address/nonsense", http.StatusBadRequest)
+	checkPage(t, h, "/address/", http.StatusBadRequest)
+
+	checkPage(t, h, "/address/"+c.bob, http.StatusOK, "needs the address index")
+	if err := c.bc.ReindexAddresses(); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the index the history is listed newest first
+	code, body := get(h, "/address/"+c.bob)
+	if code != http.StatusOK {
+		t.Fatalf("GET address: status is %d", code)
+	}
+	payment := strings.Index(body, `href="/tx/`+hex.EncodeToString(c.payBob.ID)+`"`)
+	reward := strings.Index(body, `href="/tx/`+hex.EncodeToString(c.tip.Transactions[0].ID)+`"`)
+	if payment < 0 || reward < 0 || payment > reward {
+		t.Error("history does not list the payment in the tip first")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	c := newTestChain(t)
+	h := NewExplorer(c.bc).Handler()
+
+	tipHash := hex.EncodeToString(c.tip.Hash)
+	txid := hex.EncodeToString(c.payBob.ID)
+	redirects := map[string]string{
+		strconv.Itoa(c.tip.Height): "/block/" + tipHash,
+		tipHash:                    "/block/" + tipHash,
+		txid:                       "/tx/" + txid,
+		" " + c.bob + " ":          "/address/" + c.bob,
+	}
+	for query, location := range redirects {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q="+strings.Replace(query, " ", "+", -1), nil))
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != location {
+			t.Errorf("search for %q: got %d to %q, want %d to %q", query, w.Code, w.Header().Get("Location"), http.StatusSeeOther, location)
+		}
+	}
+
+	checkPage(t, h, "/search?q="+strconv.Itoa(c.tip.Height+1), http.StatusNotFound)
+
+	// Queries are escaped on the error page
+	code, body := get(h, "/search?q=%3Cscript%3E")
+	if code != http.StatusNotFound {
+		t.Errorf("search for markup: status is %d, want %d", code, http.StatusNotFound)
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("search query was not escaped")
+	}
+}
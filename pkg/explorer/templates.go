@@ -0,0 +1,155 @@
+package explorer
+
+import (
+	"html/template"
+)
+
+// The pages share the layout defined by header and footer, and use no
+// external assets so the explorer works without network access
+const layoutTemplate = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}} - Block Explorer</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 960px; padding: 0 1em; color: #222; }
+header { border-bottom: 1px solid #ccc; padding: 1em 0; display: flex; justify-content: space-between; align-items: center; }
+header a { color: #222; font-weight: bold; text-decoration: none; font-size: 1.2em; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0; }
+th, td { border-bottom: 1px solid #eee; padding: 0.4em; text-align: left; vertical-align: top; }
+th { background: #f6f6f6; }
+.hash { font-family: monospace; word-break: break-all; }
+.valid { color: #080; }
+.invalid { color: #b00; }
+.note { background: #fff8dc; padding: 0.6em; }
+.right { text-align: right; }
+</style>
+</head>
+<body>
+<header>
+<a href="/">Block Explorer</a>
+<form action="/search"><input name="q" size="50" placeholder="Block hash, height, transaction ID or address"> <button>Search</button></form>
+</header>
+<h1>{{.}}</h1>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+`
+
+const indexTemplate = `{{template "header" "Latest blocks"}}
+<p>Best chain height {{.BestHeight}}</p>
+<table>
+<tr><th>Height</th><th>Hash</th><th>Time</th><th class="right">Transactions</th></tr>
+{{range .Blocks}}<tr>
+<td><a href="/block/{{hex .Hash}}">{{.Height}}</a></td>
+<td class="hash"><a href="/block/{{hex .Hash}}">{{hex .Hash}}</a></td>
+<td>{{time .Timestamp}}</td>
+<td class="right">{{len .Transactions}}</td>
+</tr>{{end}}
+</table>
+{{if ge .Next 0}}<p><a href="/?from={{.Next}}">Older blocks</a></p>{{end}}
+{{template "footer"}}`
+
+const blockTemplate = `{{template "header" (printf "Block %d" .Block.Height)}}
+<table>
+<tr><th>Hash</th><td class="hash">{{hex .Block.Hash}}</td></tr>
+<tr><th>Height</th><td>{{.Block.Height}}</td></tr>
+<tr><th>Confirmations</th><td>{{if lt .Confirmations 0}}Not on the best chain{{else}}{{.Confirmations}}{{end}}</td></tr>
+<tr><th>Previous block</th><td class="hash">{{if .Block.PrevBlockHash}}<a href="/block/{{hex .Block.PrevBlockHash}}">{{hex .Block.PrevBlockHash}}</a>{{else}}None, this is the genesis block{{end}}</td></tr>
+{{if .NextHash}}<tr><th>Next block</th><td class="hash"><a href="/block/{{hex .NextHash}}">{{hex .NextHash}}</a></td></tr>{{end}}
+<tr><th>Time</th><td>{{time .Block.Timestamp}}</td></tr>
+<tr><th>Version</th><td>{{.Block.Version}}</td></tr>
+<tr><th>Merkle root</th><td class="hash">{{hex .Block.MerkleRoot}}</td></tr>
+<tr><th>Bits</th><td>{{printf "%08x" .Block.Bits}}</td></tr>
+<tr><th>Target</th><td class="hash">{{.Target}}</td></tr>
+<tr><th>Nonce</th><td>{{.Block.Nonce}}</td></tr>
+<tr><th>Proof of work</th><td>{{if .PoWValid}}<span class="valid">Valid</span>{{else}}<span class="invalid">Invalid</span>{{end}}</td></tr>
+</table>
+<h2>Transactions</h2>
+<table>
+<tr><th>ID</th><th class="right">Inputs</th><th class="right">Outputs</th><th class="right">Value out</th></tr>
+{{range .Block.Transactions}}<tr>
+<td class="hash"><a href="/tx/{{hex .ID}}">{{hex .ID}}</a>{{if .IsCoinbase}} (coinbase){{end}}</td>
+<td class="right">{{len .Vin}}</td>
+<td class="right">{{len .Vout}}</td>
+<td class="right">{{valueOut .}}</td>
+</tr>{{end}}
+</table>
+{{template "footer"}}`
+
+const txTemplate = `{{template "header" "Transaction"}}
+<table>
+<tr><th>ID</th><td class="hash">{{hex .Tx.ID}}</td></tr>
+<tr><th>Block</th><td class="hash"><a href="/block/{{hex .Block.Hash}}">{{hex .Block.Hash}}</a> at height {{.Block.Height}}</td></tr>
+<tr><th>Confirmations</th><td>{{.Confirmations}}</td></tr>
+{{if not .Tx.IsCoinbase}}<tr><th>Fee</th><td>{{.Fee}}</td></tr>{{end}}
+</table>
+<h2>Inputs</h2>
+<table>
+<tr><th>#</th><th>Spends</th><th>From</th><th class="right">Value</th></tr>
+{{range $i, $in := .Inputs}}<tr>
+<td>{{$i}}</td>
+{{if $in.Coinbase}}<td colspan="3">Coinbase: {{printf "%s" $in.In.ScriptSig}}</td>
+{{else}}<td class="hash"><a href="/tx/{{hex $in.In.Txid}}#out-{{$in.In.Vout}}">{{hex $in.In.Txid}}:{{$in.In.Vout}}</a></td>
+<td class="hash">{{if $in.Address}}<a href="/address/{{$in.Address}}">{{$in.Address}}</a>{{else if $in.Source}}{{asm $in.Source.ScriptPubKey}}{{else}}Unknown{{end}}</td>
+<td class="right">{{if $in.Source}}{{$in.Source.Value}}{{end}}</td>{{end}}
+</tr>{{end}}
+</table>
+<h2>Outputs</h2>
+<table>
+<tr><th>#</th><th>To</th><th class="right">Value</th></tr>
+{{range $i, $out := .Outputs}}<tr id="out-{{$i}}">
+<td>{{$i}}</td>
+<td class="hash">{{if $out.Address}}<a href="/address/{{$out.Address}}">{{$out.Address}}</a>{{else}}{{asm $out.Out.ScriptPubKey}}{{end}}</td>
+<td class="right">{{$out.Out.Value}}</td>
+</tr>{{end}}
+</table>
+{{template "footer"}}`
+
+const addressTemplate = `{{template "header" "Address"}}
+<table>
+<tr><th>Address</th><td class="hash">{{.Address}}</td></tr>
+<tr><th>Balance</th><td>{{.Balance}}</td></tr>
+</table>
+<h2>Unspent outputs</h2>
+<table>
+<tr><th>Output</th><th>Height</th><th class="right">Value</th></tr>
+{{range .UTXOs}}<tr>
+<td class="hash"><a href="/tx/{{hex .Outpoint.Txid}}#out-{{.Outpoint.Vout}}">{{hex .Outpoint.Txid}}:{{.Outpoint.Vout}}</a></td>
+<td>{{.Entry.Height}}</td>
+<td class="right">{{.Entry.Value}}</td>
+</tr>{{else}}<tr><td colspan="3">None</td></tr>{{end}}
+</table>
+<h2>History</h2>
+{{if .Indexed}}<table>
+<tr><th>Transaction</th><th>Height</th><th class="right">Change</th><th class="right">Balance</th></tr>
+{{range .History}}<tr>
+<td class="hash"><a href="/tx/{{hex .Txid}}">{{hex .Txid}}</a></td>
+<td>{{.Height}}</td>
+<td class="right">{{printf "%+d" .Delta}}</td>
+<td class="right">{{.Balance}}</td>
+</tr>{{else}}<tr><td colspan="4">None</td></tr>{{end}}
+</table>
+{{else}}<p class="note">The history of an address needs the address index. Build it with <code>reindex -addrindex</code>.</p>{{end}}
+{{template "footer"}}`
+
+const errorTemplate = `{{template "header" "Error"}}
+<p class="note">{{.}}</p>
+{{template "footer"}}`
+
+var (
+	indexPage   = newPage(indexTemplate)
+	blockPage   = newPage(blockTemplate)
+	txPage      = newPage(txTemplate)
+	addressPage = newPage(addressTemplate)
+	errorPage   = newPage(errorTemplate)
+)
+
+func newPage(page string) *template.Template {
+	t := template.Must(template.New("layout").Funcs(funcs).Parse(layoutTemplate))
+
+	return template.Must(t.New("page").Parse(page))
+}
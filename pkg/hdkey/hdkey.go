@@ -0,0 +1,161 @@
+// Package hdkey derives trees of private keys from a seed as described by
+// BIP32, so that every key of a wallet can be recovered from the seed alone.
+// Keys are derived on any elliptic curve whose base point has prime order
+package hdkey
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// HardenedOffset is added to the index of a hardened child, whose key cannot
+// be worked out from the public key and chain code of its parent
+const HardenedOffset = 0x80000000
+
+// masterKeyHMACKey is the HMAC key the master key is derived from a seed
+// with, which is the one BIP32 specifies
+var masterKeyHMACKey = []byte("Bitcoin seed")
+
+// ErrInvalidKey is returned in the rare case a seed or index gives a key
+// outside the curve order. BIP32 moves on to the next index
+var ErrInvalidKey = errors.New("derived key is not valid")
+
+// ExtendedKey is a private key along with the chain code its children are
+// derived with
+type ExtendedKey struct {
+	curve     elliptic.Curve
+	key       []byte
+	chainCode []byte
+}
+
+// NewMaster derives the master key of a seed of 16 to 64 bytes
+func NewMaster(seed []byte, curve elliptic.Curve) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed of %d bytes is not 16 to 64 bytes long", len(seed))
+	}
+
+	mac := hmac.New(sha512.New, masterKeyHMACKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	k := new(big.Int).SetBytes(sum[:32])
+	if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidKey
+	}
+
+	return &ExtendedKey{curve: curve, key: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// Child derives the child key with index i, which is hardened from
+// HardenedOffset up
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	mac := hmac.New(sha512.New, k.chainCode)
+	if i >= HardenedOffset {
+		mac.Write([]byte{0})
+		mac.Write(k.key)
+	} else {
+		mac.Write(k.publicKey())
+	}
+
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], i)
+	mac.Write(index[:])
+	sum := mac.Sum(nil)
+
+	n := k.curve.Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, ErrInvalidKey
+	}
+
+	child := tweak.Add(tweak, new(big.Int).SetBytes(k.key))
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, ErrInvalidKey
+	}
+
+	return &ExtendedKey{curve: k.curve, key: paddedBytes(child), chainCode: sum[32:]}, nil
+}
+
+// Derive derives the descendant at path, such as m/0'/1/5, where an
+// apostrophe or h marks a hardened index. The path must start at m, the key
+// Derive is called on
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range indexes {
+		if k, err = k.Child(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// ChainCode returns the chain code of the key
+func (k *ExtendedKey) ChainCode() []byte {
+	return k.chainCode
+}
+
+// Key returns the private key as 32 big endian bytes
+func (k *ExtendedKey) Key() []byte {
+	return k.key
+}
+
+// ParsePath returns the child indexes of a path such as m/0'/1/5
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("path %q does not start at m", path)
+	}
+
+	var indexes []uint32
+	for _, part := range parts[1:] {
+		var offset uint32
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedOffset
+			part = part[:len(part)-1]
+		}
+
+		i, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || i >= HardenedOffset {
+			return nil, fmt.Errorf("path %q has an invalid index %q", path, part)
+		}
+
+		indexes = append(indexes, uint32(i)+offset)
+	}
+
+	return indexes, nil
+}
+
+// publicKey returns the compressed public key of k, its X coordinate
+// prefixed by 2 or 3 for an even or odd Y
+func (k *ExtendedKey) publicKey() []byte {
+	x, y := k.curve.ScalarBaseMult(k.key)
+
+	size := (k.curve.Params().BitSize + 7) / 8
+	compressed := make([]byte, 1+size)
+	compressed[0] = byte(2 + y.Bit(0))
+	b := x.Bytes()
+	copy(compressed[1+size-len(b):], b)
+
+	return compressed
+}
+
+func paddedBytes(n *big.Int) []byte {
+	b := make([]byte, 32)
+	nb := n.Bytes()
+	copy(b[32-len(nb):], nb)
+
+	return b
+}
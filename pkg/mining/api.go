@@ -0,0 +1,142 @@
+package mining
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// maxSubmitSize limits the body of a submitblock request, allowing for the
+// hex encoding of the largest block
+const maxSubmitSize = 2*blockchain.MaxBlockSize + 1024
+
+// TemplateResponse is the result of a getblocktemplate request. Block is the
+// serialized unmined block in hex; an external miner searches for a proof of
+// work by changing the nonce in the last 8 bytes of the header at the start
+// of Block, or the timestamp before it, and submits the result
+type TemplateResponse struct {
+	Height            int    `json:"height"`
+	PreviousBlockHash string `json:"previousblockhash"`
+	Bits              string `json:"bits"`
+	Target            string `json:"target"`
+	CurTime           int64  `json:"curtime"`
+	Transactions      int    `json:"transactions"`
+	Fees              int    `json:"fees"`
+	HeaderSize        int    `json:"headersize"`
+	Block             string `json:"block"`
+}
+
+// SubmitRequest is the body of a submitblock request
+type SubmitRequest struct {
+	Block string `json:"block"`
+}
+
+// SubmitResponse is the result of a submitblock request
+type SubmitResponse struct {
+	Hash string `json:"hash"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewTemplateResponse describes a template for an external miner
+func NewTemplateResponse(template *blockchain.BlockTemplate) (*TemplateResponse, error) {
+	block := template.Block
+
+	ser, err := block.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateResponse{
+		Height:            block.Height,
+		PreviousBlockHash: hex.EncodeToString(block.PrevBlockHash),
+		Bits:              fmt.Sprintf("%08x", block.Bits),
+		Target:            fmt.Sprintf("%064x", blockchain.CompactToBig(block.Bits)),
+		CurTime:           block.Timestamp,
+		Transactions:      len(block.Transactions),
+		Fees:              template.Fees,
+		HeaderSize:        blockchain.BlockHeaderSize,
+		Block:             hex.EncodeToString(ser),
+	}, nil
+}
+
+// DecodeSubmittedBlock decodes a hex encoded block sent by an external miner
+func DecodeSubmittedBlock(data string) (*blockchain.Block, error) {
+	ser, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("block is not valid hex: %v", err)
+	}
+
+	return blockchain.DeserializeBlock(ser)
+}
+
+// Handler serves the API for external miners. GET /getblocktemplate, with
+// an optional address parameter for the reward, returns a TemplateResponse,
+// and POST /submitblock takes a SubmitRequest and returns a SubmitResponse
+func (g *Generator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/getblocktemplate", g.handleGetBlockTemplate)
+	mux.HandleFunc("/submitblock", g.handleSubmitBlock)
+
+	return mux
+}
+
+func (g *Generator) handleGetBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{"getblocktemplate requires GET"})
+		return
+	}
+
+	template, err := g.GetBlockTemplate(r.URL.Query().Get("address"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+
+	resp, err := NewTemplateResponse(template)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (g *Generator) handleSubmitBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{"submitblock requires POST"})
+		return
+	}
+
+	var req SubmitRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubmitSize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	block, err := DecodeSubmittedBlock(req.Block)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+
+	if err = g.SubmitBlock(block); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+
+	g.logf("Accepted block %x from an external miner", block.Hash)
+
+	writeJSON(w, http.StatusOK, SubmitResponse{Hash: hex.EncodeToString(block.Hash)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,212 @@
+package mining
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+const defaultRefreshInterval = 10 * time.Second
+
+// Node builds block templates and adds mined blocks to the chain, relaying
+// them to the network. Both take the lock the node holds while handling
+// blocks and transactions from peers
+type Node interface {
+	BlockTemplate(address string) (*blockchain.BlockTemplate, error)
+	RelayBlock(block *blockchain.Block) error
+}
+
+// Config configures a Generator
+type Config struct {
+	// Address is paid the reward of blocks mined by the Generator and of
+	// templates requested without an address
+	Address string
+
+	// Miner performs the proof of work, defaulting to blockchain.DefaultMiner
+	Miner *blockchain.Miner
+
+	// RefreshInterval is how often the mempool is checked for transactions
+	// paying more fees than the block being mined
+	RefreshInterval time.Duration
+
+	// Logger receives mining events, discarded when nil
+	Logger *log.Logger
+}
+
+// Generator continuously mines blocks from templates built from the mempool.
+// Mining restarts on a new template whenever the tip of the chain changes or
+// transactions paying more fees arrive. It also hands out templates to and
+// accepts blocks from external miners
+type Generator struct {
+	cfg   Config
+	chain *blockchain.Blockchain
+	node  Node
+
+	tipChanged chan struct{}
+	quit       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewGenerator creates a Generator that gets templates from and submits
+// blocks through node. It subscribes to changes of the chain, so it must be
+// created before the chain is shared with other goroutines
+func NewGenerator(chain *blockchain.Blockchain, node Node, cfg Config) *Generator {
+	if cfg.Miner == nil {
+		cfg.Miner = blockchain.DefaultMiner
+	}
+	if cfg.RefreshInterval == 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(ioutil.Discard, "", 0)
+	}
+
+	g := &Generator{
+		cfg:        cfg,
+		chain:      chain,
+		node:       node,
+		tipChanged: make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+	}
+	chain.Subscribe(g)
+
+	return g
+}
+
+// Start begins mining blocks paying Config.Address
+func (g *Generator) Start() {
+	g.wg.Add(1)
+	go g.mineLoop()
+}
+
+// Stop stops mining, abandoning the block being mined
+func (g *Generator) Stop() {
+	close(g.quit)
+	g.wg.Wait()
+}
+
+// BlockConnected restarts mining on the new tip
+func (g *Generator) BlockConnected(block *blockchain.Block) {
+	g.notifyTipChanged()
+}
+
+// BlockDisconnected restarts mining on the new tip
+func (g *Generator) BlockDisconnected(block *blockchain.Block) {
+	g.notifyTipChanged()
+}
+
+// notifyTipChanged must not block as it is called while the chain is
+// being updated
+func (g *Generator) notifyTipChanged() {
+	select {
+	case g.tipChanged <- struct{}{}:
+	default:
+	}
+}
+
+// GetBlockTemplate returns a block on the current tip for an external miner
+// to find a proof of work for, paying the reward to address or to
+// Config.Address when address is empty
+func (g *Generator) GetBlockTemplate(address string) (*blockchain.BlockTemplate, error) {
+	if address == "" {
+		address = g.cfg.Address
+	}
+
+	return g.node.BlockTemplate(address)
+}
+
+// SubmitBlock adds a block mined from a template to the chain
+func (g *Generator) SubmitBlock(block *blockchain.Block) error {
+	return g.node.RelayBlock(block)
+}
+
+func (g *Generator) mineLoop() {
+	defer g.wg.Done()
+
+	for {
+		select {
+		case <-g.quit:
+			return
+		case <-g.tipChanged:
+		default:
+		}
+
+		template, err := g.node.BlockTemplate(g.cfg.Address)
+		if err != nil {
+			g.logf("Failed to create block template: %v", err)
+
+			select {
+			case <-g.quit:
+				return
+			case <-time.After(g.cfg.RefreshInterval):
+			}
+			continue
+		}
+
+		block := template.Block
+		g.logf("Mining block %d with %d transactions and %d in fees", block.Height, len(block.Transactions), template.Fees)
+
+		if err = g.mine(template); err != nil {
+			continue
+		}
+
+		if err = g.node.RelayBlock(block); err != nil {
+			g.logf("Failed to submit block %x: %v", block.Hash, err)
+			continue
+		}
+
+		g.logf("Mined block %x at height %d", block.Hash, block.Height)
+	}
+}
+
+// mine finds a proof of work for the template, giving up when the tip
+// changes, better transactions arrive or the Generator is stopped
+func (g *Generator) mine(template *blockchain.BlockTemplate) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer cancel()
+
+		ticker := time.NewTicker(g.cfg.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-g.quit:
+				return
+			case <-g.tipChanged:
+				g.logf("Chain tip changed, restarting with a new template")
+				return
+			case <-ticker.C:
+				if g.betterTemplate(template) {
+					g.logf("Transactions with more fees arrived, restarting with a new template")
+					return
+				}
+			}
+		}
+	}()
+
+	return g.cfg.Miner.Mine(ctx, template.Block)
+}
+
+// betterTemplate checks whether a new template would collect more fees
+func (g *Generator) betterTemplate(template *blockchain.BlockTemplate) bool {
+	latest, err := g.node.BlockTemplate(g.cfg.Address)
+	if err != nil {
+		return false
+	}
+
+	return latest.Fees > template.Fees
+}
+
+func (g *Generator) logf(format string, v ...interface{}) {
+	g.cfg.Logger.Printf(format, v...)
+}
@@ -0,0 +1,428 @@
+package p2p
+
+import (
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+const (
+	// ProtocolVersion is the version of the wire protocol spoken by this node
+	ProtocolVersion = 1
+
+	// MinProtocolVersion is the oldest protocol version a peer may use
+	MinProtocolVersion = 1
+
+	// MaxBlocksPerInv is the maximum number of block hashes sent in
+	// response to a getblocks message
+	MaxBlocksPerInv = 500
+
+	// MaxInvPerMsg is the maximum number of inventory vectors in a message
+	MaxInvPerMsg = 50000
+
+	// MaxAddrPerMsg is the maximum number of addresses in an addr message
+	MaxAddrPerMsg = 1000
+
+	// MaxHeadersPerMsg is the maximum number of block headers sent in
+	// response to a getheaders message
+	MaxHeadersPerMsg = 2000
+
+	// MaxProofsPerMsg is the maximum number of transaction proofs in a
+	// proofs message
+	MaxProofsPerMsg = 1000
+
+	// MaxKeysPerMsg is the maximum number of public key hashes a light
+	// client may ask for proofs for at once
+	MaxKeysPerMsg = 100
+)
+
+// Commands used in the message header to identify the payload
+const (
+	CmdVersion    = "version"
+	CmdVerAck     = "verack"
+	CmdInv        = "inv"
+	CmdGetData    = "getdata"
+	CmdBlock      = "block"
+	CmdTx         = "tx"
+	CmdGetBlocks  = "getblocks"
+	CmdAddr       = "addr"
+	CmdPing       = "ping"
+	CmdPong       = "pong"
+	CmdGetHeaders = "getheaders"
+	CmdHeaders    = "headers"
+	CmdGetProofs  = "getproofs"
+	CmdProofs     = "proofs"
+)
+
+// Message is a message that can be sent between peers. Payloads use the
+// same canonical encoding as blocks and transactions
+type Message interface {
+	Command() string
+	encode(w *util.Writer)
+	decode(r *util.Reader)
+}
+
+// MsgVersion is sent by both sides when a connection is opened and
+// advertises the protocol version and state of the sending node
+type MsgVersion struct {
+	Version       int
+	Timestamp     int64
+	ListenPort    int
+	Nonce         uint64
+	UserAgent     string
+	BestBlockHash []byte
+}
+
+// Command returns the command of the message
+func (msg *MsgVersion) Command() string { return CmdVersion }
+
+func (msg *MsgVersion) encode(w *util.Writer) {
+	w.WriteUint32(uint32(msg.Version))
+	w.WriteUint64(uint64(msg.Timestamp))
+	w.WriteUint32(uint32(msg.ListenPort))
+	w.WriteUint64(msg.Nonce)
+	w.WriteString(msg.UserAgent)
+	w.WriteBytes(msg.BestBlockHash)
+}
+
+func (msg *MsgVersion) decode(r *util.Reader) {
+	msg.Version = int(r.ReadUint32())
+	msg.Timestamp = int64(r.ReadUint64())
+	msg.ListenPort = int(r.ReadUint32())
+	msg.Nonce = r.ReadUint64()
+	msg.UserAgent = r.ReadString()
+	msg.BestBlockHash = r.ReadBytes()
+}
+
+// MsgVerAck acknowledges a version message
+type MsgVerAck struct{}
+
+// Command returns the command of the message
+func (msg *MsgVerAck) Command() string { return CmdVerAck }
+
+func (msg *MsgVerAck) encode(w *util.Writer) {}
+
+func (msg *MsgVerAck) decode(r *util.Reader) {}
+
+// InvType identifies the kind of object an inventory vector refers to
+type InvType int
+
+// Inventory types that can be announced and requested
+const (
+	InvTypeBlock InvType = iota + 1
+	InvTypeTx
+)
+
+// InvVect refers to a block or transaction by its hash
+type InvVect struct {
+	Type InvType
+	Hash []byte
+}
+
+func encodeInvVects(w *util.Writer, items []InvVect) {
+	w.WriteUint32(uint32(len(items)))
+	for _, item := range items {
+		w.WriteUint32(uint32(item.Type))
+		w.WriteBytes(item.Hash)
+	}
+}
+
+func decodeInvVects(r *util.Reader) []InvVect {
+	var items []InvVect
+
+	count := r.ReadCount(4 + 4)
+	for i := 0; i < count; i++ {
+		items = append(items, InvVect{
+			Type: InvType(r.ReadUint32()),
+			Hash: r.ReadBytes(),
+		})
+	}
+
+	return items
+}
+
+// MsgInv announces blocks or transactions known to the sending node
+type MsgInv struct {
+	Items []InvVect
+}
+
+// Command returns the command of the message
+func (msg *MsgInv) Command() string { return CmdInv }
+
+func (msg *MsgInv) encode(w *util.Writer) { encodeInvVects(w, msg.Items) }
+
+func (msg *MsgInv) decode(r *util.Reader) { msg.Items = decodeInvVects(r) }
+
+// MsgGetData requests the blocks or transactions referred to by its items
+type MsgGetData struct {
+	Items []InvVect
+}
+
+// Command returns the command of the message
+func (msg *MsgGetData) Command() string { return CmdGetData }
+
+func (msg *MsgGetData) encode(w *util.Writer) { encodeInvVects(w, msg.Items) }
+
+func (msg *MsgGetData) decode(r *util.Reader) { msg.Items = decodeInvVects(r) }
+
+// MsgBlock carries a full block
+type MsgBlock struct {
+	Block *blockchain.Block
+}
+
+// Command returns the command of the message
+func (msg *MsgBlock) Command() string { return CmdBlock }
+
+func (msg *MsgBlock) encode(w *util.Writer) {
+	ser, _ := msg.Block.Serialize()
+	w.Write(ser)
+}
+
+func (msg *MsgBlock) decode(r *util.Reader) {
+	block, err := blockchain.DeserializeBlock(r.ReadFixed(r.Remaining()))
+	if err != nil {
+		r.Fail(err)
+		return
+	}
+
+	msg.Block = block
+}
+
+// MsgTx carries a single transaction
+type MsgTx struct {
+	Transaction *blockchain.Transaction
+}
+
+// Command returns the command of the message
+func (msg *MsgTx) Command() string { return CmdTx }
+
+func (msg *MsgTx) encode(w *util.Writer) {
+	ser, _ := msg.Transaction.Serialize()
+	w.Write(ser)
+}
+
+func (msg *MsgTx) decode(r *util.Reader) {
+	tx, err := blockchain.DeserializeTransaction(r.ReadFixed(r.Remaining()))
+	if err != nil {
+		r.Fail(err)
+		return
+	}
+
+	msg.Transaction = tx
+}
+
+// MsgGetBlocks requests an inv of the blocks following the first hash in
+// Locator the receiving node knows, up to and including HashStop
+type MsgGetBlocks struct {
+	Locator  [][]byte
+	HashStop []byte
+}
+
+// Command returns the command of the message
+func (msg *MsgGetBlocks) Command() string { return CmdGetBlocks }
+
+func (msg *MsgGetBlocks) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(msg.Locator)))
+	for _, hash := range msg.Locator {
+		w.WriteBytes(hash)
+	}
+	w.WriteBytes(msg.HashStop)
+}
+
+func (msg *MsgGetBlocks) decode(r *util.Reader) {
+	count := r.ReadCount(4)
+	for i := 0; i < count; i++ {
+		msg.Locator = append(msg.Locator, r.ReadBytes())
+	}
+	msg.HashStop = r.ReadBytes()
+}
+
+// MsgAddr shares the listening addresses of known nodes
+type MsgAddr struct {
+	Addrs []string
+}
+
+// Command returns the command of the message
+func (msg *MsgAddr) Command() string { return CmdAddr }
+
+func (msg *MsgAddr) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(msg.Addrs)))
+	for _, addr := range msg.Addrs {
+		w.WriteString(addr)
+	}
+}
+
+func (msg *MsgAddr) decode(r *util.Reader) {
+	count := r.ReadCount(4)
+	for i := 0; i < count; i++ {
+		msg.Addrs = append(msg.Addrs, r.ReadString())
+	}
+}
+
+// MsgPing checks that a connection is still alive
+type MsgPing struct {
+	Nonce uint64
+}
+
+// Command returns the command of the message
+func (msg *MsgPing) Command() string { return CmdPing }
+
+func (msg *MsgPing) encode(w *util.Writer) { w.WriteUint64(msg.Nonce) }
+
+func (msg *MsgPing) decode(r *util.Reader) { msg.Nonce = r.ReadUint64() }
+
+// MsgPong replies to a ping with the same nonce
+type MsgPong struct {
+	Nonce uint64
+}
+
+// Command returns the command of the message
+func (msg *MsgPong) Command() string { return CmdPong }
+
+func (msg *MsgPong) encode(w *util.Writer) { w.WriteUint64(msg.Nonce) }
+
+func (msg *MsgPong) decode(r *util.Reader) { msg.Nonce = r.ReadUint64() }
+
+// MsgGetHeaders requests the headers of the blocks following the first hash
+// in Locator the receiving node knows, up to and including HashStop. Light
+// clients use it to follow the chain without downloading blocks
+type MsgGetHeaders struct {
+	Locator  [][]byte
+	HashStop []byte
+}
+
+// Command returns the command of the message
+func (msg *MsgGetHeaders) Command() string { return CmdGetHeaders }
+
+func (msg *MsgGetHeaders) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(msg.Locator)))
+	for _, hash := range msg.Locator {
+		w.WriteBytes(hash)
+	}
+	w.WriteBytes(msg.HashStop)
+}
+
+func (msg *MsgGetHeaders) decode(r *util.Reader) {
+	count := r.ReadCount(4)
+	for i := 0; i < count; i++ {
+		msg.Locator = append(msg.Locator, r.ReadBytes())
+	}
+	msg.HashStop = r.ReadBytes()
+}
+
+// MsgHeaders carries block headers, oldest first. Fewer than
+// MaxHeadersPerMsg headers means the sender has no more
+type MsgHeaders struct {
+	Headers []*blockchain.BlockHeader
+}
+
+// Command returns the command of the message
+func (msg *MsgHeaders) Command() string { return CmdHeaders }
+
+func (msg *MsgHeaders) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(msg.Headers)))
+	for _, header := range msg.Headers {
+		w.Write(header.Serialize())
+	}
+}
+
+func (msg *MsgHeaders) decode(r *util.Reader) {
+	count := r.ReadCount(blockchain.BlockHeaderSize)
+	for i := 0; i < count; i++ {
+		header, err := blockchain.DeserializeBlockHeader(r.ReadFixed(blockchain.BlockHeaderSize))
+		if err != nil {
+			r.Fail(err)
+			return
+		}
+		msg.Headers = append(msg.Headers, header)
+	}
+}
+
+// MsgGetProofs asks for proofs of every transaction on the main chain paying
+// or spending from the public key hashes
+type MsgGetProofs struct {
+	PubKeyHashes [][]byte
+}
+
+// Command returns the command of the message
+func (msg *MsgGetProofs) Command() string { return CmdGetProofs }
+
+func (msg *MsgGetProofs) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(msg.PubKeyHashes)))
+	for _, pubKeyHash := range msg.PubKeyHashes {
+		w.WriteBytes(pubKeyHash)
+	}
+}
+
+func (msg *MsgGetProofs) decode(r *util.Reader) {
+	count := r.ReadCount(4)
+	for i := 0; i < count; i++ {
+		msg.PubKeyHashes = append(msg.PubKeyHashes, r.ReadBytes())
+	}
+}
+
+// MsgProofs answers a getproofs message. Large answers are split over
+// several messages, and Complete is set on the last one
+type MsgProofs struct {
+	Proofs   []*blockchain.TxProof
+	Complete bool
+}
+
+// Command returns the command of the message
+func (msg *MsgProofs) Command() string { return CmdProofs }
+
+func (msg *MsgProofs) encode(w *util.Writer) {
+	w.WriteUint32(uint32(len(msg.Proofs)))
+	for _, proof := range msg.Proofs {
+		ser, _ := proof.Serialize()
+		w.WriteBytes(ser)
+	}
+	w.WriteBool(msg.Complete)
+}
+
+func (msg *MsgProofs) decode(r *util.Reader) {
+	count := r.ReadCount(4)
+	for i := 0; i < count; i++ {
+		proof, err := blockchain.DeserializeTxProof(r.ReadBytes())
+		if err != nil {
+			r.Fail(err)
+			return
+		}
+		msg.Proofs = append(msg.Proofs, proof)
+	}
+	msg.Complete = r.ReadBool()
+}
+
+func makeEmptyMessage(command string) Message {
+	switch command {
+	case CmdVersion:
+		return &MsgVersion{}
+	case CmdVerAck:
+		return &MsgVerAck{}
+	case CmdInv:
+		return &MsgInv{}
+	case CmdGetData:
+		return &MsgGetData{}
+	case CmdBlock:
+		return &MsgBlock{}
+	case CmdTx:
+		return &MsgTx{}
+	case CmdGetBlocks:
+		return &MsgGetBlocks{}
+	case CmdAddr:
+		return &MsgAddr{}
+	case CmdPing:
+		return &MsgPing{}
+	case CmdPong:
+		return &MsgPong{}
+	case CmdGetHeaders:
+		return &MsgGetHeaders{}
+	case CmdHeaders:
+		return &MsgHeaders{}
+	case CmdGetProofs:
+		return &MsgGetProofs{}
+	case CmdProofs:
+		return &MsgProofs{}
+	}
+
+	return nil
+}
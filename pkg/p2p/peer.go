@@ -0,0 +1,211 @@
+package p2p
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// pingInterval is how often an idle connection is pinged
+	pingInterval = 2 * time.Minute
+
+	// idleTimeout is how long a peer may stay silent before it is disconnected
+	idleTimeout = 5 * time.Minute
+
+	// writeTimeout bounds how long sending a single message may take
+	writeTimeout = 30 * time.Second
+
+	// sendQueueSize is the number of messages buffered for a peer
+	sendQueueSize = 100
+)
+
+// Peer is a connection to another node
+type Peer struct {
+	server  *Server
+	conn    net.Conn
+	addr    string
+	inbound bool
+
+	sendQueue chan Message
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	version   *MsgVersion
+	verAck    bool
+	banScore  int
+	pingNonce uint64
+}
+
+func newPeer(server *Server, conn net.Conn, inbound bool) *Peer {
+	return &Peer{
+		server:    server,
+		conn:      conn,
+		addr:      conn.RemoteAddr().String(),
+		inbound:   inbound,
+		sendQueue: make(chan Message, sendQueueSize),
+		quit:      make(chan struct{}),
+	}
+}
+
+// Addr returns the remote address of the connection
+func (p *Peer) Addr() string {
+	return p.addr
+}
+
+// Inbound reports whether the peer connected to us
+func (p *Peer) Inbound() bool {
+	return p.inbound
+}
+
+// ListenAddr returns the address the peer accepts connections on, as
+// advertised in its version message, or an empty string before the handshake
+func (p *Peer) ListenAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.version == nil || p.version.ListenPort == 0 {
+		return ""
+	}
+
+	return net.JoinHostPort(p.host(), strconv.Itoa(p.version.ListenPort))
+}
+
+// BanScore returns the accumulated misbehaviour score of the peer
+func (p *Peer) BanScore() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.banScore
+}
+
+// HandshakeComplete reports whether version and verack have been exchanged
+func (p *Peer) HandshakeComplete() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.version != nil && p.verAck
+}
+
+// Send queues a message for the peer, dropping it if the peer has disconnected
+func (p *Peer) Send(msg Message) {
+	select {
+	case p.sendQueue <- msg:
+	case <-p.quit:
+	}
+}
+
+// Disconnect closes the connection to the peer
+func (p *Peer) Disconnect() {
+	p.closeOnce.Do(func() {
+		close(p.quit)
+		p.conn.Close()
+		p.server.removePeer(p)
+	})
+}
+
+// banKey returns the key the peer is banned under. An inbound peer on the
+// loopback interface connects from a new port each time, so it is known by
+// the address it listens on once its version message has arrived
+func (p *Peer) banKey() string {
+	if addr := p.ListenAddr(); p.inbound && addr != "" {
+		return banKey(addr)
+	}
+
+	return banKey(p.addr)
+}
+
+// banKey returns the key bans of the node at addr are kept under, which is
+// its host. Nodes on the loopback interface all share a host, as when
+// several are run on one machine for testing, so they are told apart by
+// the whole address
+func banKey(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		return addr
+	}
+
+	return host
+}
+
+func (p *Peer) host() string {
+	host, _, err := net.SplitHostPort(p.addr)
+	if err != nil {
+		return p.addr
+	}
+
+	return host
+}
+
+func (p *Peer) start() {
+	go p.readLoop()
+	go p.writeLoop()
+	go p.pingLoop()
+}
+
+func (p *Peer) readLoop() {
+	defer p.Disconnect()
+
+	for {
+		p.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		msg, err := ReadMessage(p.conn, p.server.cfg.Magic)
+		if err == ErrUnknownCommand {
+			p.server.misbehaving(p, 1, "unknown command")
+			continue
+		}
+		if err != nil {
+			select {
+			case <-p.quit:
+			default:
+				p.server.logf("Disconnecting %s: %v", p.addr, err)
+			}
+			return
+		}
+
+		p.server.handleMessage(p, msg)
+	}
+}
+
+func (p *Peer) writeLoop() {
+	for {
+		select {
+		case msg := <-p.sendQueue:
+			p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := WriteMessage(p.conn, p.server.cfg.Magic, msg); err != nil {
+				p.server.logf("Failed to send %s to %s: %v", msg.Command(), p.addr, err)
+				p.Disconnect()
+				return
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *Peer) pingLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			nonce := rand.Uint64()
+
+			p.mu.Lock()
+			p.pingNonce = nonce
+			p.mu.Unlock()
+
+			p.Send(&MsgPing{Nonce: nonce})
+		case <-p.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,847 @@
+package p2p
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+const (
+	// UserAgent identifies this implementation in version messages
+	UserAgent = "/blockchain:0.0.2/"
+
+	defaultMaxPeers     = 32
+	defaultMaxOutbound  = 8
+	defaultBanThreshold = 100
+	defaultBanDuration  = 24 * time.Hour
+
+	dialTimeout         = 10 * time.Second
+	connectionsInterval = 30 * time.Second
+)
+
+// Chain is the blockchain a Server relays blocks and transactions for
+type Chain interface {
+	GetBestBlockHash() []byte
+	GetBlock(hash []byte) (*blockchain.Block, error)
+	HasBlock(hash []byte) (bool, error)
+	BlockLocator() ([][]byte, error)
+	GetBlockHashes(locator [][]byte, stop []byte, max int) ([][]byte, error)
+	GetBlockHeaders(locator [][]byte, stop []byte, max int) ([]*blockchain.BlockHeader, error)
+	FindTransactionProofs(pubKeyHashes [][]byte) ([]*blockchain.TxProof, error)
+	AddBlock(block *blockchain.Block) error
+}
+
+// TxPool holds the unconfirmed transactions a Server relays and builds
+// block templates from them
+type TxPool interface {
+	Add(tx *blockchain.Transaction) error
+	Has(txid []byte) bool
+	Get(txid []byte) *blockchain.Transaction
+	NewBlockTemplate(address string) (*blockchain.BlockTemplate, error)
+}
+
+// Config configures a Server
+type Config struct {
+	// ListenAddr is the address to accept connections on, e.g. ":3000".
+	// No connections are accepted when it is empty
+	ListenAddr string
+
+	// Seeds are node addresses connected to on start
+	Seeds []string
+
+	// Magic identifies the network, defaulting to that of the network
+	// selected with blockchain.UseNetwork
+	Magic uint32
+
+	// MaxPeers limits the total number of connections
+	MaxPeers int
+
+	// MaxOutbound limits the number of connections this node opens itself
+	MaxOutbound int
+
+	// BanThreshold is the misbehaviour score at which a peer is banned
+	BanThreshold int
+
+	// BanDuration is how long a banned peer is refused
+	BanDuration time.Duration
+
+	// Logger receives connection and relay events, discarded when nil
+	Logger *log.Logger
+}
+
+// Server manages the peers of a node and relays blocks and transactions
+// between them and the local Chain
+type Server struct {
+	cfg   Config
+	chain Chain
+	pool  TxPool
+	nonce uint64
+
+	listener net.Listener
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	// chainMu serialises access to the chain between peers
+	chainMu sync.Mutex
+
+	// dialMu prevents concurrent top ups from exceeding MaxOutbound
+	dialMu sync.Mutex
+
+	mu         sync.Mutex
+	peers      map[*Peer]bool
+	knownAddrs map[string]bool
+	selfAddrs  map[string]bool
+	bans       map[string]time.Time
+}
+
+// NewServer creates a Server for chain and pool, filling unset Config
+// fields with defaults
+func NewServer(chain Chain, pool TxPool, cfg Config) *Server {
+	if cfg.Magic == 0 {
+		cfg.Magic = blockchain.ActiveNetwork().Magic
+	}
+	if cfg.MaxPeers == 0 {
+		cfg.MaxPeers = defaultMaxPeers
+	}
+	if cfg.MaxOutbound == 0 {
+		cfg.MaxOutbound = defaultMaxOutbound
+	}
+	if cfg.BanThreshold == 0 {
+		cfg.BanThreshold = defaultBanThreshold
+	}
+	if cfg.BanDuration == 0 {
+		cfg.BanDuration = defaultBanDuration
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(ioutil.Discard, "", 0)
+	}
+
+	return &Server{
+		cfg:        cfg,
+		chain:      chain,
+		pool:       pool,
+		nonce:      rand.Uint64(),
+		quit:       make(chan struct{}),
+		peers:      make(map[*Peer]bool),
+		knownAddrs: make(map[string]bool),
+		selfAddrs:  make(map[string]bool),
+		bans:       make(map[string]time.Time),
+	}
+}
+
+// Start begins accepting connections and connects to the seed nodes
+func (s *Server) Start() error {
+	if s.cfg.ListenAddr != "" {
+		listener, err := net.Listen("tcp", s.cfg.ListenAddr)
+		if err != nil {
+			return err
+		}
+		s.listener = listener
+
+		s.wg.Add(1)
+		go s.acceptLoop()
+	}
+
+	s.mu.Lock()
+	for _, addr := range s.cfg.Seeds {
+		s.knownAddrs[addr] = true
+	}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.connectionsLoop()
+
+	return nil
+}
+
+// Stop disconnects all peers and stops accepting connections
+func (s *Server) Stop() {
+	close(s.quit)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	for _, p := range s.Peers() {
+		p.Disconnect()
+	}
+
+	s.wg.Wait()
+}
+
+// Addr returns the address the server is listening on, or nil if it is
+// not accepting connections
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
+// Peers returns the currently connected peers
+func (s *Server) Peers() []*Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var peers []*Peer
+	for p := range s.peers {
+		peers = append(peers, p)
+	}
+
+	return peers
+}
+
+// Connect opens an outbound connection to addr
+func (s *Server) Connect(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+	if key := banKey(addr); s.isBanned(key) {
+		return errors.Errorf("%s is banned", key)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+
+	p := newPeer(s, conn, false)
+	p.addr = addr
+	if err = s.addPeer(p); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.Send(s.versionMessage())
+
+	return nil
+}
+
+// Ban disconnects every peer with the given ban key and refuses
+// connections from it for the configured ban duration. The key is a host,
+// or a host and port for a node on the loopback interface, as returned by
+// banKey
+func (s *Server) Ban(key string) {
+	s.mu.Lock()
+	s.bans[key] = time.Now().Add(s.cfg.BanDuration)
+	s.mu.Unlock()
+
+	for _, p := range s.Peers() {
+		if p.banKey() == key {
+			p.Disconnect()
+		}
+	}
+}
+
+// RelayTransaction adds a transaction created by this node to the pool
+// and announces it to all peers
+func (s *Server) RelayTransaction(tx *blockchain.Transaction) error {
+	s.chainMu.Lock()
+	err := s.pool.Add(tx)
+	s.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.broadcast(&MsgInv{Items: []InvVect{{Type: InvTypeTx, Hash: tx.ID}}}, nil)
+
+	return nil
+}
+
+// BlockTemplate builds a template for a block on the tip from the pool,
+// holding the chain lock so that blocks and transactions arriving from peers
+// do not change either part way through
+func (s *Server) BlockTemplate(address string) (*blockchain.BlockTemplate, error) {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	return s.pool.NewBlockTemplate(address)
+}
+
+// RelayBlock adds a block mined by this node to the chain and announces it
+// to all peers if it became the tip
+func (s *Server) RelayBlock(block *blockchain.Block) error {
+	s.chainMu.Lock()
+	err := s.chain.AddBlock(block)
+	best := s.chain.GetBestBlockHash()
+	s.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(best, block.Hash) {
+		s.broadcast(&MsgInv{Items: []InvVect{{Type: InvTypeBlock, Hash: block.Hash}}}, nil)
+	}
+
+	return nil
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+				s.logf("Failed to accept connection: %v", err)
+				continue
+			}
+		}
+
+		// A banned node on the loopback interface is only recognised once
+		// its version message gives the port it listens on
+		if s.isBanned(banKey(conn.RemoteAddr().String())) {
+			conn.Close()
+			continue
+		}
+
+		p := newPeer(s, conn, true)
+		if err = s.addPeer(p); err != nil {
+			s.logf("Rejecting %s: %v", p.addr, err)
+			conn.Close()
+		}
+	}
+}
+
+// connectionsLoop keeps the number of outbound connections topped up from
+// the known addresses
+func (s *Server) connectionsLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(connectionsInterval)
+	defer ticker.Stop()
+
+	for {
+		s.fillOutbound()
+
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Server) fillOutbound() {
+	s.dialMu.Lock()
+	defer s.dialMu.Unlock()
+
+	select {
+	case <-s.quit:
+		return
+	default:
+	}
+
+	connected := make(map[string]bool)
+	outbound := 0
+	for _, p := range s.Peers() {
+		connected[p.addr] = true
+		if addr := p.ListenAddr(); addr != "" {
+			connected[addr] = true
+		}
+		if !p.inbound {
+			outbound++
+		}
+	}
+
+	s.mu.Lock()
+	var candidates []string
+	for addr := range s.knownAddrs {
+		if !connected[addr] && addr != s.localAddr() {
+			candidates = append(candidates, addr)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, addr := range candidates {
+		if outbound >= s.cfg.MaxOutbound {
+			return
+		}
+
+		if err := s.Connect(addr); err != nil {
+			s.logf("Failed to connect to %s: %v", addr, err)
+			continue
+		}
+		outbound++
+	}
+}
+
+func (s *Server) addPeer(p *Peer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.peers) >= s.cfg.MaxPeers {
+		return errors.New("too many peers")
+	}
+
+	s.peers[p] = true
+	p.start()
+	s.logf("Connected to %s (inbound: %t)", p.addr, p.inbound)
+
+	return nil
+}
+
+func (s *Server) removePeer(p *Peer) {
+	s.mu.Lock()
+	delete(s.peers, p)
+	s.mu.Unlock()
+
+	s.logf("Disconnected from %s", p.addr)
+}
+
+func (s *Server) isBanned(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.bans[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.bans, key)
+		return false
+	}
+
+	return true
+}
+
+// misbehaving increases the ban score of a peer, banning it once the score
+// reaches the threshold
+func (s *Server) misbehaving(p *Peer, score int, reason string) {
+	p.mu.Lock()
+	p.banScore += score
+	total := p.banScore
+	p.mu.Unlock()
+
+	s.logf("Peer %s misbehaving (+%d = %d): %s", p.addr, score, total, reason)
+
+	if total >= s.cfg.BanThreshold {
+		key := p.banKey()
+		s.logf("Banning %s", key)
+		s.Ban(key)
+	}
+}
+
+func (s *Server) broadcast(msg Message, except *Peer) {
+	for _, p := range s.Peers() {
+		if p != except && p.HandshakeComplete() {
+			p.Send(msg)
+		}
+	}
+}
+
+func (s *Server) versionMessage() *MsgVersion {
+	s.chainMu.Lock()
+	best := s.chain.GetBestBlockHash()
+	s.chainMu.Unlock()
+
+	return &MsgVersion{
+		Version:       ProtocolVersion,
+		Timestamp:     time.Now().Unix(),
+		ListenPort:    s.listenPort(),
+		Nonce:         s.nonce,
+		UserAgent:     UserAgent,
+		BestBlockHash: best,
+	}
+}
+
+func (s *Server) listenPort() int {
+	if s.listener == nil {
+		return 0
+	}
+
+	_, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		return 0
+	}
+
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// localAddr returns the loopback address of our own listener so that it
+// is never dialled when it shows up in an addr message
+func (s *Server) localAddr() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(s.listenPort()))
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	s.cfg.Logger.Printf(format, v...)
+}
+
+func (s *Server) handleMessage(p *Peer, msg Message) {
+	switch m := msg.(type) {
+	case *MsgVersion:
+		s.handleVersion(p, m)
+		return
+	case *MsgVerAck:
+		s.handleVerAck(p)
+		return
+	}
+
+	if !p.HandshakeComplete() {
+		s.misbehaving(p, 10, msg.Command()+" received before the handshake")
+		return
+	}
+
+	switch m := msg.(type) {
+	case *MsgPing:
+		p.Send(&MsgPong{Nonce: m.Nonce})
+	case *MsgPong:
+		p.mu.Lock()
+		if m.Nonce == p.pingNonce {
+			p.pingNonce = 0
+		}
+		p.mu.Unlock()
+	case *MsgInv:
+		s.handleInv(p, m)
+	case *MsgGetData:
+		s.handleGetData(p, m)
+	case *MsgBlock:
+		s.handleBlock(p, m)
+	case *MsgTx:
+		s.handleTx(p, m)
+	case *MsgGetBlocks:
+		s.handleGetBlocks(p, m)
+	case *MsgAddr:
+		s.handleAddr(p, m)
+	case *MsgGetHeaders:
+		s.handleGetHeaders(p, m)
+	case *MsgGetProofs:
+		s.handleGetProofs(p, m)
+	}
+}
+
+func (s *Server) handleVersion(p *Peer, msg *MsgVersion) {
+	p.mu.Lock()
+	duplicate := p.version != nil
+	p.mu.Unlock()
+
+	if duplicate {
+		s.misbehaving(p, 1, "duplicate version message")
+		return
+	}
+
+	if msg.Nonce == s.nonce {
+		s.logf("Disconnecting %s: connected to ourselves", p.addr)
+
+		s.mu.Lock()
+		delete(s.knownAddrs, p.addr)
+		s.selfAddrs[p.addr] = true
+		s.mu.Unlock()
+
+		p.Disconnect()
+		return
+	}
+
+	if msg.Version < MinProtocolVersion {
+		s.logf("Disconnecting %s: protocol version %d is too old", p.addr, msg.Version)
+		p.Disconnect()
+		return
+	}
+
+	p.mu.Lock()
+	p.version = msg
+	p.mu.Unlock()
+
+	if key := p.banKey(); s.isBanned(key) {
+		s.logf("Disconnecting %s: %s is banned", p.addr, key)
+		p.Disconnect()
+		return
+	}
+
+	if p.inbound {
+		p.Send(s.versionMessage())
+	}
+	p.Send(&MsgVerAck{})
+
+	s.onHandshake(p)
+}
+
+func (s *Server) handleVerAck(p *Peer) {
+	p.mu.Lock()
+	duplicate := p.verAck
+	p.verAck = true
+	p.mu.Unlock()
+
+	if duplicate {
+		s.misbehaving(p, 1, "duplicate verack message")
+		return
+	}
+
+	s.onHandshake(p)
+}
+
+// onHandshake starts syncing with a peer once version and verack have
+// both been received, and shares the addresses we know about
+func (s *Server) onHandshake(p *Peer) {
+	if !p.HandshakeComplete() {
+		return
+	}
+
+	p.mu.Lock()
+	version := p.version
+	p.mu.Unlock()
+
+	s.logf("Handshake with %s complete (%s, version %d)", p.addr, version.UserAgent, version.Version)
+
+	if addr := p.ListenAddr(); addr != "" {
+		s.mu.Lock()
+		s.knownAddrs[addr] = true
+		s.mu.Unlock()
+	}
+
+	s.requestBlocks(p)
+
+	s.mu.Lock()
+	var addrs []string
+	for addr := range s.knownAddrs {
+		if len(addrs) == MaxAddrPerMsg {
+			break
+		}
+		addrs = append(addrs, addr)
+	}
+	s.mu.Unlock()
+
+	if len(addrs) > 0 {
+		p.Send(&MsgAddr{Addrs: addrs})
+	}
+}
+
+// requestBlocks asks a peer for the blocks following our best chain
+func (s *Server) requestBlocks(p *Peer) {
+	s.chainMu.Lock()
+	locator, err := s.chain.BlockLocator()
+	s.chainMu.Unlock()
+	if err != nil {
+		s.logf("Failed to build block locator: %v", err)
+		return
+	}
+
+	p.Send(&MsgGetBlocks{Locator: locator})
+}
+
+func (s *Server) handleInv(p *Peer, msg *MsgInv) {
+	if len(msg.Items) > MaxInvPerMsg {
+		s.misbehaving(p, 20, "inv message is too large")
+		return
+	}
+
+	var request []InvVect
+	var lastBlock []byte
+	blocks := 0
+
+	for _, item := range msg.Items {
+		switch item.Type {
+		case InvTypeBlock:
+			blocks++
+			lastBlock = item.Hash
+
+			s.chainMu.Lock()
+			have, err := s.chain.HasBlock(item.Hash)
+			s.chainMu.Unlock()
+			if err != nil {
+				s.logf("Failed to look up block %x: %v", item.Hash, err)
+				return
+			}
+			if !have {
+				request = append(request, item)
+			}
+		case InvTypeTx:
+			if !s.pool.Has(item.Hash) {
+				request = append(request, item)
+			}
+		default:
+			s.misbehaving(p, 20, "unknown inventory type")
+			return
+		}
+	}
+
+	if len(request) > 0 {
+		p.Send(&MsgGetData{Items: request})
+	}
+
+	// A full inv means the peer has more blocks, so continue from the last one
+	if blocks == MaxBlocksPerInv {
+		p.Send(&MsgGetBlocks{Locator: [][]byte{lastBlock}})
+	}
+}
+
+func (s *Server) handleGetData(p *Peer, msg *MsgGetData) {
+	if len(msg.Items) > MaxInvPerMsg {
+		s.misbehaving(p, 20, "getdata message is too large")
+		return
+	}
+
+	for _, item := range msg.Items {
+		switch item.Type {
+		case InvTypeBlock:
+			s.chainMu.Lock()
+			block, err := s.chain.GetBlock(item.Hash)
+			s.chainMu.Unlock()
+			if err != nil {
+				continue
+			}
+			p.Send(&MsgBlock{Block: block})
+		case InvTypeTx:
+			if tx := s.pool.Get(item.Hash); tx != nil {
+				p.Send(&MsgTx{Transaction: tx})
+			}
+		default:
+			s.misbehaving(p, 20, "unknown inventory type")
+			return
+		}
+	}
+}
+
+func (s *Server) handleBlock(p *Peer, msg *MsgBlock) {
+	block := msg.Block
+	if block == nil {
+		s.misbehaving(p, 20, "empty block message")
+		return
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	if have, err := s.chain.HasBlock(block.Hash); err != nil || have {
+		return
+	}
+
+	// Without the parent the block cannot be validated, so ask for the
+	// blocks between our tip and it instead
+	if haveParent, err := s.chain.HasBlock(block.PrevBlockHash); err != nil || !haveParent {
+		go s.requestBlocks(p)
+		return
+	}
+
+	if err := s.chain.AddBlock(block); err != nil {
+		// Only a block breaking the rules is the peer's fault. A block ahead
+		// of our clock may only mean that the clocks differ, and other
+		// failures, such as those of the database, are our own
+		if !blockchain.IsRuleError(err) {
+			s.logf("Ignored block %x from %s: %v", block.Hash, p.addr, err)
+			return
+		}
+
+		s.misbehaving(p, 100, "invalid block: "+err.Error())
+		return
+	}
+
+	s.logf("Added block %x from %s", block.Hash, p.addr)
+
+	// Blocks that only extend a side chain are stored but not relayed
+	if !bytes.Equal(block.Hash, s.chain.GetBestBlockHash()) {
+		return
+	}
+
+	s.broadcast(&MsgInv{Items: []InvVect{{Type: InvTypeBlock, Hash: block.Hash}}}, p)
+}
+
+func (s *Server) handleTx(p *Peer, msg *MsgTx) {
+	tx := msg.Transaction
+	if tx == nil {
+		s.misbehaving(p, 20, "empty tx message")
+		return
+	}
+
+	if s.pool.Has(tx.ID) {
+		return
+	}
+
+	// A transaction can become invalid through no fault of the peer when a
+	// block spending the same outputs arrives first, so it is only dropped
+	s.chainMu.Lock()
+	err := s.pool.Add(tx)
+	s.chainMu.Unlock()
+	if err != nil {
+		s.logf("Rejecting transaction %x from %s: %v", tx.ID, p.addr, err)
+		return
+	}
+
+	s.broadcast(&MsgInv{Items: []InvVect{{Type: InvTypeTx, Hash: tx.ID}}}, p)
+}
+
+func (s *Server) handleGetBlocks(p *Peer, msg *MsgGetBlocks) {
+	s.chainMu.Lock()
+	hashes, err := s.chain.GetBlockHashes(msg.Locator, msg.HashStop, MaxBlocksPerInv)
+	s.chainMu.Unlock()
+	if err != nil {
+		s.logf("Failed to find blocks for %s: %v", p.addr, err)
+		return
+	}
+
+	if len(hashes) == 0 {
+		return
+	}
+
+	inv := &MsgInv{}
+	for _, hash := range hashes {
+		inv.Items = append(inv.Items, InvVect{Type: InvTypeBlock, Hash: hash})
+	}
+	p.Send(inv)
+}
+
+func (s *Server) handleGetHeaders(p *Peer, msg *MsgGetHeaders) {
+	s.chainMu.Lock()
+	headers, err := s.chain.GetBlockHeaders(msg.Locator, msg.HashStop, MaxHeadersPerMsg)
+	s.chainMu.Unlock()
+	if err != nil {
+		s.logf("Failed to find headers for %s: %v", p.addr, err)
+		return
+	}
+
+	// An empty answer is still sent so that a light client knows it is
+	// up to date
+	p.Send(&MsgHeaders{Headers: headers})
+}
+
+func (s *Server) handleGetProofs(p *Peer, msg *MsgGetProofs) {
+	if len(msg.PubKeyHashes) > MaxKeysPerMsg {
+		s.misbehaving(p, 20, "getproofs message is too large")
+		return
+	}
+
+	// Reads are safe alongside the goroutine adding blocks, so a slow search
+	// does not hold up block processing
+	proofs, err := s.chain.FindTransactionProofs(msg.PubKeyHashes)
+	if err != nil {
+		s.logf("Failed to find proofs for %s: %v", p.addr, err)
+		return
+	}
+
+	for len(proofs) > MaxProofsPerMsg {
+		p.Send(&MsgProofs{Proofs: proofs[:MaxProofsPerMsg]})
+		proofs = proofs[MaxProofsPerMsg:]
+	}
+	p.Send(&MsgProofs{Proofs: proofs, Complete: true})
+}
+
+func (s *Server) handleAddr(p *Peer, msg *MsgAddr) {
+	if len(msg.Addrs) > MaxAddrPerMsg {
+		s.misbehaving(p, 20, "addr message is too large")
+		return
+	}
+
+	s.mu.Lock()
+	for _, addr := range msg.Addrs {
+		if _, _, err := net.SplitHostPort(addr); err == nil && !s.selfAddrs[addr] {
+			s.knownAddrs[addr] = true
+		}
+	}
+	s.mu.Unlock()
+
+	go s.fillOutbound()
+}
@@ -0,0 +1,209 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// newTestChain creates a regtest blockchain in a temporary directory with
+// blocks mined on top of the genesis block
+func newTestChain(t *testing.T, blocks int) *blockchain.Blockchain {
+	dir, err := ioutil.TempDir("", "p2p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevNet := blockchain.ActiveNetwork()
+	t.Cleanup(func() {
+		blockchain.UseNetwork(prevNet, ".")
+		os.RemoveAll(dir)
+	})
+
+	if err = blockchain.UseNetwork(blockchain.RegTestParams, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := blockchain.CreateBlockchain("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.DB.Close() })
+
+	wallet, err := blockchain.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallet.GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < blocks; i++ {
+		cb, err := blockchain.NewCoinbaseTransaction(string(address), "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = bc.MineBlock([]*blockchain.Transaction{cb}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return bc
+}
+
+// startServer starts a Server for bc listening on a free loopback port
+func startServer(t *testing.T, bc *blockchain.Blockchain) *Server {
+	server := NewServer(bc, blockchain.NewMempool(bc), Config{ListenAddr: "127.0.0.1:0"})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+
+	return server
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServersSyncBlocks(t *testing.T) {
+	miner := newTestChain(t, 5)
+	fresh := newTestChain(t, 0)
+
+	a := startServer(t, miner)
+	b := startServer(t, fresh)
+
+	if err := b.Connect(a.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the new node to sync", func() bool {
+		b.chainMu.Lock()
+		defer b.chainMu.Unlock()
+
+		return bytes.Equal(fresh.GetBestBlockHash(), miner.GetBestBlockHash())
+	})
+
+	height, err := fresh.GetBestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 5 {
+		t.Fatalf("synced to height %d, want 5", height)
+	}
+}
+
+func TestBanKey(t *testing.T) {
+	tests := []struct {
+		addr, key string
+	}{
+		{"203.0.113.5:8333", "203.0.113.5"},
+		{"[2001:db8::1]:8333", "2001:db8::1"},
+		{"127.0.0.1:3000", "127.0.0.1:3000"},
+		{"127.0.0.2:3000", "127.0.0.2:3000"},
+		{"[::1]:3000", "[::1]:3000"},
+		{"localhost:3000", "localhost:3000"},
+	}
+
+	for _, test := range tests {
+		if key := banKey(test.addr); key != test.key {
+			t.Errorf("banKey(%q) = %q, want %q", test.addr, key, test.key)
+		}
+	}
+}
+
+func TestLoopbackBanKeepsOtherLocalNodes(t *testing.T) {
+	bc := newTestChain(t, 0)
+	a := startServer(t, bc)
+	banned := startServer(t, bc)
+	other := startServer(t, bc)
+
+	a.Ban(banKey(banned.Addr().String()))
+
+	if err := a.Connect(banned.Addr().String()); err == nil {
+		t.Fatal("connected to a banned node")
+	}
+	if err := a.Connect(other.Addr().String()); err != nil {
+		t.Fatalf("connecting to another node on the same host: %v", err)
+	}
+	waitFor(t, "the handshake with the other node", func() bool {
+		for _, p := range a.Peers() {
+			if p.HandshakeComplete() {
+				return true
+			}
+		}
+		return false
+	})
+
+	// The banned node connecting in is dropped once its version message
+	// gives the port it listens on
+	if err := banned.Connect(a.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the banned node to be disconnected", func() bool {
+		return len(banned.Peers()) == 0
+	})
+	if n := len(a.Peers()); n != 1 {
+		t.Fatalf("%d peers connected, want only the node that is not banned", n)
+	}
+}
+
+// failingChain is a chain whose database fails to store blocks
+type failingChain struct {
+	*blockchain.Blockchain
+}
+
+func (c failingChain) AddBlock(block *blockchain.Block) error {
+	return errors.New("disk full")
+}
+
+func TestOnlyInvalidBlocksBanPeers(t *testing.T) {
+	bc := newTestChain(t, 1)
+	tip, err := bc.GetBlock(bc.GetBestBlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mine := func(fees int) *blockchain.Block {
+		wallet, err := blockchain.NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := wallet.GetAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cb, err := blockchain.NewCoinbaseTransaction(string(to), "", fees)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return blockchain.NewBlock([]*blockchain.Transaction{cb}, tip.Hash, tip.Height+1, tip.Bits)
+	}
+
+	failing := NewServer(failingChain{bc}, blockchain.NewMempool(bc), Config{})
+	p := &Peer{addr: "203.0.113.5:8333"}
+	failing.handleBlock(p, &MsgBlock{Block: mine(0)})
+	if failing.isBanned(p.banKey()) || p.banScore != 0 {
+		t.Fatal("peer was blamed for a block the database failed to store")
+	}
+
+	// A coinbase claiming more than the subsidy breaks the rules
+	server := NewServer(bc, blockchain.NewMempool(bc), Config{})
+	server.handleBlock(p, &MsgBlock{Block: mine(1)})
+	if !server.isBanned(p.banKey()) {
+		t.Fatal("peer sending an invalid block was not banned")
+	}
+}
@@ -0,0 +1,104 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+const (
+	// MaxMessagePayload is the largest payload a peer will accept
+	MaxMessagePayload = 32 * 1024 * 1024
+
+	commandSize  = 12
+	checksumSize = 4
+	headerSize   = 4 + commandSize + 4 + checksumSize
+)
+
+// ErrUnknownCommand is returned by ReadMessage for a well formed message
+// with a command this node does not understand
+var ErrUnknownCommand = errors.New("unknown command")
+
+// WriteMessage writes a message to w. Every message is framed by a header
+// holding the network magic, the null padded command, the payload length
+// and the first bytes of the double SHA-256 of the payload
+func WriteMessage(w io.Writer, magic uint32, msg Message) error {
+	command := msg.Command()
+	if len(command) > commandSize {
+		return fmt.Errorf("command %q is too long", command)
+	}
+
+	enc := &util.Writer{}
+	msg.encode(enc)
+	payload := enc.Bytes()
+
+	if len(payload) > MaxMessagePayload {
+		return fmt.Errorf("%s message payload of %d bytes is too large", command, len(payload))
+	}
+
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header[0:4], magic)
+	copy(header[4:4+commandSize], command)
+	binary.LittleEndian.PutUint32(header[4+commandSize:8+commandSize], uint32(len(payload)))
+	copy(header[8+commandSize:], checksum(payload))
+
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReadMessage reads the next message from r, verifying its header
+func ReadMessage(r io.Reader, magic uint32) (Message, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(header[0:4]) != magic {
+		return nil, errors.New("message has the wrong network magic")
+	}
+
+	command := string(bytes.TrimRight(header[4:4+commandSize], "\x00"))
+
+	length := binary.LittleEndian.Uint32(header[4+commandSize : 8+commandSize])
+	if length > MaxMessagePayload {
+		return nil, fmt.Errorf("%s message payload of %d bytes is too large", command, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[8+commandSize:], checksum(payload)) {
+		return nil, fmt.Errorf("%s message has an invalid checksum", command)
+	}
+
+	msg := makeEmptyMessage(command)
+	if msg == nil {
+		return nil, ErrUnknownCommand
+	}
+
+	dec := util.NewReader(payload)
+	msg.decode(dec)
+	if err := dec.Finish(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode %s message", command)
+	}
+
+	return msg, nil
+}
+
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+
+	return second[:checksumSize]
+}
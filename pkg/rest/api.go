@@ -0,0 +1,333 @@
+package rest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/rpc"
+)
+
+const (
+	// DefaultLimit is the page size when a request does not give a limit
+	DefaultLimit = 20
+	// MaxLimit is the largest page a request can ask for
+	MaxLimit = 100
+)
+
+// BlocksResponse is a page of blocks of the best chain, newest first. Next
+// is the from parameter for the following page, and is missing on the last
+// page
+type BlocksResponse struct {
+	Blocks []*rpc.Block `json:"blocks"`
+	Next   *int         `json:"next,omitempty"`
+}
+
+// AddressTx is a transaction in the history of an address. Delta is what it
+// paid to the address less what it spent from it
+type AddressTx struct {
+	Txid   string `json:"txid"`
+	Height int    `json:"height"`
+	Delta  int    `json:"delta"`
+}
+
+// AddressTxsResponse is a page of the history of an address, newest first
+type AddressTxsResponse struct {
+	Address string      `json:"address"`
+	Total   int         `json:"total"`
+	Txs     []AddressTx `json:"txs"`
+}
+
+// AddressUTXOsResponse lists the unspent outputs of an address
+type AddressUTXOsResponse struct {
+	Address string         `json:"address"`
+	Balance int            `json:"balance"`
+	UTXOs   []*rpc.Unspent `json:"utxos"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// statusError carries the HTTP status a failed request is answered with
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+// API serves read-only JSON views of a blockchain, its UTXO set and its
+// indexes
+type API struct {
+	chain *blockchain.Blockchain
+}
+
+// NewAPI creates an API over chain. It never writes, so chain can have been
+// opened with blockchain.OpenBlockchainReadOnly
+func NewAPI(chain *blockchain.Blockchain) *API {
+	return &API{chain: chain}
+}
+
+// Handler serves the API. GET /blocks?from=HEIGHT&limit=N returns a
+// BlocksResponse, /block/{hash} and /tx/{id} return a block or transaction,
+// /address/{addr}/utxos returns an AddressUTXOsResponse and
+// /address/{addr}/txs?offset=N&limit=N returns an AddressTxsResponse
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocks", a.handle(a.blocks))
+	mux.HandleFunc("/block/", a.handle(a.block))
+	mux.HandleFunc("/tx/", a.handle(a.tx))
+	mux.HandleFunc("/address/", a.handle(a.address))
+
+	return mux
+}
+
+func (a *API) handle(route func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{"the API is read-only and requires GET"})
+			return
+		}
+
+		resp, err := route(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if serr, ok := err.(*statusError); ok {
+				status = serr.status
+			}
+
+			writeJSON(w, status, errorResponse{err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func (a *API) blocks(r *http.Request) (interface{}, error) {
+	bestHeight, err := a.chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := queryInt(r, "from", bestHeight)
+	if err != nil {
+		return nil, err
+	}
+	if from < 0 || from > bestHeight {
+		return nil, badRequest(fmt.Errorf("from must be between 0 and %d", bestHeight))
+	}
+
+	limit, err := queryLimit(r)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BlocksResponse{Blocks: []*rpc.Block{}}
+	height := from
+	for ; height >= 0 && len(resp.Blocks) < limit; height-- {
+		block, err := a.chain.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+
+		b := rpc.NewBlock(block)
+		b.Confirmations = bestHeight - height + 1
+		resp.Blocks = append(resp.Blocks, b)
+	}
+
+	if height >= 0 {
+		resp.Next = &height
+	}
+
+	return resp, nil
+}
+
+func (a *API) block(r *http.Request) (interface{}, error) {
+	hash, err := pathHex(r, "/block/")
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := a.chain.GetBlock(hash)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	confirmations, err := a.chain.Confirmations(block)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := rpc.NewBlock(block)
+	resp.Confirmations = confirmations
+
+	return resp, nil
+}
+
+func (a *API) tx(r *http.Request) (interface{}, error) {
+	txid, err := pathHex(r, "/tx/")
+	if err != nil {
+		return nil, err
+	}
+
+	block, position, err := a.chain.FindTransactionBlock(txid)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	confirmations, err := a.chain.Confirmations(block)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := rpc.NewTx(block.Transactions[position])
+	resp.BlockHash = hex.EncodeToString(block.Hash)
+	resp.Confirmations = confirmations
+
+	return resp, nil
+}
+
+// address routes /address/{addr}/utxos and /address/{addr}/txs
+func (a *API) address(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/address/"), "/")
+	if len(parts) != 2 {
+		return nil, notFound(fmt.Errorf("no route for %s", r.URL.Path))
+	}
+
+	address := parts[0]
+	script, err := blockchain.PayToAddressScript(address)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	switch parts[1] {
+	case "utxos":
+		return a.addressUTXOs(address, script)
+	case "txs":
+		return a.addressTxs(r, address, script)
+	default:
+		return nil, notFound(fmt.Errorf("no route for %s", r.URL.Path))
+	}
+}
+
+func (a *API) addressUTXOs(address string, script []byte) (interface{}, error) {
+	UTXOSet := blockchain.UTXOSet{
+		Blockchain: a.chain,
+	}
+
+	UTXOs, err := UTXOSet.FindUTXO(script)
+	if err != nil {
+		return nil, err
+	}
+
+	bestHeight, err := a.chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &AddressUTXOsResponse{Address: address, UTXOs: []*rpc.Unspent{}}
+	for _, utxo := range UTXOs {
+		resp.Balance += utxo.Entry.Value
+		resp.UTXOs = append(resp.UTXOs, rpc.NewUnspent(utxo, bestHeight))
+	}
+
+	return resp, nil
+}
+
+func (a *API) addressTxs(r *http.Request, address string, script []byte) (interface{}, error) {
+	indexed, err := a.chain.HasAddressIndex()
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		return nil, &statusError{http.StatusNotImplemented, fmt.Errorf("the address index has not been built, run reindex -addrindex")}
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, badRequest(fmt.Errorf("offset must not be negative"))
+	}
+
+	limit, err := queryLimit(r)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := a.chain.AddressHistory(script)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &AddressTxsResponse{Address: address, Total: len(history), Txs: []AddressTx{}}
+	for i := len(history) - 1 - offset; i >= 0 && len(resp.Txs) < limit; i-- {
+		resp.Txs = append(resp.Txs, AddressTx{
+			Txid:   hex.EncodeToString(history[i].Txid),
+			Height: history[i].Height,
+			Delta:  history[i].Delta,
+		})
+	}
+
+	return resp, nil
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("%s must be an integer", name))
+	}
+
+	return n, nil
+}
+
+func queryLimit(r *http.Request) (int, error) {
+	limit, err := queryInt(r, "limit", DefaultLimit)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > MaxLimit {
+		return 0, badRequest(fmt.Errorf("limit must be between 1 and %d", MaxLimit))
+	}
+
+	return limit, nil
+}
+
+func pathHex(r *http.Request, prefix string) ([]byte, error) {
+	value := strings.TrimPrefix(r.URL.Path, prefix)
+
+	data, err := hex.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, badRequest(fmt.Errorf("%q is not a hex encoded hash", value))
+	}
+
+	return data, nil
+}
+
+func badRequest(err error) error {
+	return &statusError{http.StatusBadRequest, err}
+}
+
+func notFound(err error) error {
+	return &statusError{http.StatusNotFound, err}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,257 @@
+package rest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/rpc"
+)
+
+// testChain is a regtest chain of five blocks, the last of which pays bob
+// from the coinbase of the first block after genesis, which paid alice
+type testChain struct {
+	bc     *blockchain.Blockchain
+	alice  string
+	bob    string
+	payBob *blockchain.Transaction
+}
+
+func newTestChain(t *testing.T) *testChain {
+	dir, err := ioutil.TempDir("", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err = blockchain.UseNetwork(blockchain.RegTestParams, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets := &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)}
+	c := &testChain{}
+	if c.alice, err = wallets.CreateWallet(); err != nil {
+		t.Fatal(err)
+	}
+	if c.bob, err = wallets.CreateWallet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.bc, err = blockchain.CreateBlockchain(c.alice); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.bc.DB.Close() })
+
+	for i := 0; i < 2; i++ {
+		mine(t, c.bc, c.bob)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: c.bc}
+	if c.payBob, err = blockchain.NewUTXOTransaction(wallets, c.alice, c.bob, 10, 0, &UTXOSet); err != nil {
+		t.Fatal(err)
+	}
+	mine(t, c.bc, c.bob, c.payBob)
+
+	return c
+}
+
+// mine adds a block of txs with a coinbase paying to
+func mine(t *testing.T, bc *blockchain.Blockchain, to string, txs ...*blockchain.Transaction) *blockchain.Block {
+	cb, err := blockchain.NewCoinbaseTransaction(to, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := bc.MineBlock(append([]*blockchain.Transaction{cb}, txs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// get requests path from the API and decodes a successful response into v
+func get(t *testing.T, h http.Handler, path string, v interface{}) int {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code == http.StatusOK && v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s: %v", path, err)
+		}
+	}
+
+	return w.Code
+}
+
+// checkStatus checks the status of each request
+func checkStatus(t *testing.T, h http.Handler, status int, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		if got := get(t, h, path, nil); got != status {
+			t.Errorf("GET %s: status is %d, want %d", path, got, status)
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	c := newTestChain(t)
+	h := NewAPI(c.bc).Handler()
+
+	pages := []struct {
+		path    string
+		heights []int
+		next    int
+	}{
+		{"/blocks", []int{4, 3, 2, 1, 0}, -1},
+		{"/blocks?limit=2", []int{4, 3}, 2},
+		{"/blocks?from=2&limit=2", []int{2, 1}, 0},
+		{"/blocks?from=0&limit=2", []int{0}, -1},
+		{"/blocks?from=1&limit=2", []int{1, 0}, -1},
+		{"/blocks?limit=100", []int{4, 3, 2, 1, 0}, -1},
+	}
+
+	for _, page := range pages {
+		var resp BlocksResponse
+		if status := get(t, h, page.path, &resp); status != http.StatusOK {
+			t.Errorf("GET %s: status is %d", page.path, status)
+			continue
+		}
+
+		var heights []int
+		for _, block := range resp.Blocks {
+			heights = append(heights, block.Height)
+			if block.Confirmations != 5-block.Height {
+				t.Errorf("GET %s: block %d has %d confirmations, want %d", page.path, block.Height, block.Confirmations, 5-block.Height)
+			}
+		}
+		if len(heights) != len(page.heights) {
+			t.Errorf("GET %s: heights are %v, want %v", page.path, heights, page.heights)
+			continue
+		}
+		for i := range heights {
+			if heights[i] != page.heights[i] {
+				t.Errorf("GET %s: heights are %v, want %v", page.path, heights, page.heights)
+				break
+			}
+		}
+
+		next := -1
+		if resp.Next != nil {
+			next = *resp.Next
+		}
+		if next != page.next {
+			t.Errorf("GET %s: next is %d, want %d", page.path, next, page.next)
+		}
+	}
+
+	checkStatus(t, h, http.StatusBadRequest,
+		"/blocks?from=-1",
+		"/blocks?from=5",
+		"/blocks?from=tip",
+		"/blocks?limit=0",
+		"/blocks?limit=101",
+		"/blocks?limit=all",
+	)
+}
+
+func TestBlockAndTx(t *testing.T) {
+	c := newTestChain(t)
+	h := NewAPI(c.bc).Handler()
+
+	tip, err := c.bc.GetBlockByHeight(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipHash := hex.EncodeToString(tip.Hash)
+
+	var block rpc.Block
+	if status := get(t, h, "/block/"+tipHash, &block); status != http.StatusOK {
+		t.Fatalf("GET /block: status is %d", status)
+	}
+	if block.Hash != tipHash || block.Height != 4 || block.Confirmations != 1 || len(block.Tx) != 2 {
+		t.Errorf("block is %+v, want the tip with two transactions", block)
+	}
+
+	var tx rpc.Tx
+	if status := get(t, h, "/tx/"+hex.EncodeToString(c.payBob.ID), &tx); status != http.StatusOK {
+		t.Fatalf("GET /tx: status is %d", status)
+	}
+	if tx.Txid != hex.EncodeToString(c.payBob.ID) || tx.BlockHash != tipHash || tx.Confirmations != 1 {
+		t.Errorf("transaction is %+v, want the payment to bob in the tip", tx)
+	}
+
+	checkStatus(t, h, http.StatusBadRequest, "/block/", "/block/xyz", "/block/abc", "/tx/", "/tx/not-hex")
+	checkStatus(t, h, http.StatusNotFound, "/block/00ff", "/tx/00ff", "/nothing")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/block/"+tipHash, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /block: status is %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	c := newTestChain(t)
+	h := NewAPI(c.bc).Handler()
+	subsidy := blockchain.RegTestParams.Subsidy
+
+	var utxos AddressUTXOsResponse
+	if status := get(t, h, "/address/"+c.bob+"/utxos", &utxos); status != http.StatusOK {
+		t.Fatalf("GET utxos: status is %d", status)
+	}
+	if utxos.Address != c.bob || len(utxos.UTXOs) != 4 || utxos.Balance != 3*subsidy+10 {
+		t.Errorf("bob has %d outputs worth %d, want 4 worth %d", len(utxos.UTXOs), utxos.Balance, 3*subsidy+10)
+	}
+
+	checkStatus(t, h, http.StatusBadRequest, "/address/nonsense/utxos", "/address/nonsense/txs")
+	checkStatus(t, h, http.StatusNotFound, "/address/"+c.bob, "/address/"+c.bob+"/balance", "/address/"+c.bob+"/utxos/extra")
+
+	// The history needs the address index
+	checkStatus(t, h, http.StatusNotImplemented, "/address/"+c.bob+"/txs")
+	if err := c.bc.ReindexAddresses(); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := []struct {
+		path  string
+		count int
+	}{
+		{"/address/" + c.bob + "/txs", 4},
+		{"/address/" + c.bob + "/txs?limit=3", 3},
+		{"/address/" + c.bob + "/txs?offset=3&limit=3", 1},
+		{"/address/" + c.bob + "/txs?offset=4", 0},
+		{"/address/" + c.bob + "/txs?offset=100", 0},
+	}
+	for _, page := range pages {
+		var resp AddressTxsResponse
+		if status := get(t, h, page.path, &resp); status != http.StatusOK {
+			t.Errorf("GET %s: status is %d", page.path, status)
+			continue
+		}
+		if resp.Total != 4 || len(resp.Txs) != page.count {
+			t.Errorf("GET %s: got %d of %d transactions, want %d of 4", page.path, len(resp.Txs), resp.Total, page.count)
+		}
+	}
+
+	// Newest first, so the payment in the tip leads
+	var resp AddressTxsResponse
+	get(t, h, "/address/"+c.bob+"/txs?limit=1", &resp)
+	if len(resp.Txs) != 1 || resp.Txs[0].Height != 4 {
+		t.Errorf("first transaction of the history is %+v, want one at height 4", resp.Txs)
+	}
+
+	checkStatus(t, h, http.StatusBadRequest,
+		"/address/"+c.bob+"/txs?offset=-1",
+		"/address/"+c.bob+"/txs?offset=x",
+		"/address/"+c.bob+"/txs?limit=0",
+		"/address/"+c.bob+"/txs?limit=101",
+	)
+}
@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Client calls the methods of a Server
+type Client struct {
+	url  string
+	cfg  Config
+	http *http.Client
+}
+
+// NewClient creates a Client for the server listening on addr, a host and
+// port, authenticating with the credentials in cfg
+func NewClient(addr string, cfg Config) *Client {
+	return &Client{
+		url:  "http://" + addr + "/",
+		cfg:  cfg,
+		http: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Call calls method with positional params, decoding its result into result
+// unless it is nil. A method that fails returns an *Error
+func (c *Client) Call(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(&Request{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  rawParams,
+		ID:      json.RawMessage("1"),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.cfg.User, c.cfg.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err = json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultConfigFile is where the RPC credentials are read from, within the
+// directory of the network
+const DefaultConfigFile = "blockchain.conf"
+
+// Config holds the credentials clients must present with HTTP basic auth
+type Config struct {
+	User     string
+	Password string
+}
+
+// LoadConfig reads the credentials from a config file of key=value lines
+// holding rpcuser and rpcpassword. Blank lines and lines starting with #
+// are ignored
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &Config{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key=value", path, n)
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "rpcuser":
+			cfg.User = value
+		case "rpcpassword":
+			cfg.Password = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if cfg.User == "" || cfg.Password == "" {
+		return nil, fmt.Errorf("rpcuser and rpcpassword must be set in %s", path)
+	}
+
+	return cfg, nil
+}
+
+// Authorized reports whether a request carries the credentials. Hashes of
+// the credentials are compared so that the comparison takes the same time
+// whatever their length
+func (c Config) Authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	userHash := sha256.Sum256([]byte(user))
+	wantUser := sha256.Sum256([]byte(c.User))
+	passwordHash := sha256.Sum256([]byte(password))
+	wantPassword := sha256.Sum256([]byte(c.Password))
+
+	userOK := subtle.ConstantTimeCompare(userHash[:], wantUser[:])
+	passwordOK := subtle.ConstantTimeCompare(passwordHash[:], wantPassword[:])
+
+	return userOK&passwordOK == 1
+}
+
+// RequireAuth only passes requests carrying the credentials of cfg on to h
+func RequireAuth(cfg Config, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.Authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	cfg := Config{User: "alice", Password: "secret"}
+	handler := RequireAuth(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		auth     bool
+		status   int
+	}{
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong user", "bob", "secret", true, http.StatusUnauthorized},
+		{"wrong password", "alice", "secre", true, http.StatusUnauthorized},
+		{"credentials", "alice", "secret", true, http.StatusTeapot},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/getblocktemplate", nil)
+			if test.auth {
+				r.SetBasicAuth(test.user, test.password)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("status is %d, want %d", w.Code, test.status)
+			}
+		})
+	}
+}
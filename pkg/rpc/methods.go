@@ -0,0 +1,385 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/mining"
+)
+
+// getbestblockhash returns the hash of the tip of the best chain
+func (s *Server) getBestBlockHash(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0, 0); err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(s.chain.GetBestBlockHash()), nil
+}
+
+// getblock [hash] returns a block, which may be on a side chain
+func (s *Server) getBlock(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1, 1); err != nil {
+		return nil, err
+	}
+
+	hash, err := hexParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := s.chain.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmations, err := s.chain.Confirmations(block)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewBlock(block)
+	result.Confirmations = confirmations
+
+	return result, nil
+}
+
+// getblockhash [height] returns the hash of the block at a height of the
+// best chain
+func (s *Server) getBlockHash(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1, 1); err != nil {
+		return nil, err
+	}
+
+	height, err := intParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.chain.GetBlockHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// gettransaction [txid] returns a transaction from the best chain or the
+// mempool, where it has no confirmations
+func (s *Server) getTransaction(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1, 1); err != nil {
+		return nil, err
+	}
+
+	txid, err := hexParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx := s.pool.Get(txid); tx != nil {
+		return NewTx(tx), nil
+	}
+
+	block, position, err := s.chain.FindTransactionBlock(txid)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmations, err := s.chain.Confirmations(block)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewTx(block.Transactions[position])
+	result.BlockHash = hex.EncodeToString(block.Hash)
+	result.Confirmations = confirmations
+
+	return result, nil
+}
+
+// getbalance [address] returns the sum of the unspent outputs of an address
+func (s *Server) getBalance(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1, 1); err != nil {
+		return nil, err
+	}
+
+	UTXOs, err := s.findUTXO(params)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0
+	for _, utxo := range UTXOs {
+		balance += utxo.Entry.Value
+	}
+
+	return balance, nil
+}
+
+// listunspent [address] returns the unspent outputs of an address
+func (s *Server) listUnspent(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1, 1); err != nil {
+		return nil, err
+	}
+
+	UTXOs, err := s.findUTXO(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bestHeight, err := s.chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	unspent := []*Unspent{}
+	for _, utxo := range UTXOs {
+		unspent = append(unspent, NewUnspent(utxo, bestHeight))
+	}
+
+	return unspent, nil
+}
+
+// getnewaddress creates a new key in the wallet and returns its address
+func (s *Server) getNewAddress(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0, 0); err != nil {
+		return nil, err
+	}
+
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+
+	if err := s.loadWallets(); err != nil {
+		return nil, err
+	}
+
+	address, err := s.wallets.CreateWallet()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.wallets.SaveToFile(); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// sendtoaddress [from, to, amount, feerate] pays amount from an address in
+// the wallet, relays the transaction and returns its ID. The fee rate in
+// coins per 1000 bytes is optional and defaults to zero
+func (s *Server) sendToAddress(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 3, 4); err != nil {
+		return nil, err
+	}
+
+	var from, to string
+	if err := decodeParam(params, 0, &from); err != nil {
+		return nil, err
+	}
+	if err := decodeParam(params, 1, &to); err != nil {
+		return nil, err
+	}
+
+	amount, err := intParam(params, 2)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, &Error{InvalidParams, "amount must be positive"}
+	}
+
+	feeRate := 0
+	if len(params) > 3 {
+		if feeRate, err = intParam(params, 3); err != nil {
+			return nil, err
+		}
+		if feeRate < 0 {
+			return nil, &Error{InvalidParams, "feerate must not be negative"}
+		}
+	}
+
+	if !blockchain.ValidateAddress(from) || !blockchain.ValidateAddress(to) {
+		return nil, &Error{InvalidParams, "address is not valid"}
+	}
+
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+
+	if err = s.loadWallets(); err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{
+		Blockchain: s.chain,
+		Mempool:    s.pool,
+	}
+
+	tx, err := blockchain.NewUTXOTransaction(s.wallets, from, to, amount, feeRate, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+	if s.wallets.HasSeed() {
+		if err = s.wallets.SaveToFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.relay.RelayTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// walletpassphrase [passphrase, timeout] unlocks an encrypted wallet for
+// timeout seconds, so that sendtoaddress and getnewaddress can use its keys
+func (s *Server) walletPassphrase(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 2, 2); err != nil {
+		return nil, err
+	}
+
+	var passphrase string
+	if err := decodeParam(params, 0, &passphrase); err != nil {
+		return nil, err
+	}
+
+	timeout, err := intParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 || timeout > maxUnlockTimeout {
+		return nil, &Error{InvalidParams, fmt.Sprintf("timeout must be between 1 and %d seconds", maxUnlockTimeout)}
+	}
+
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+
+	if err = s.loadWallets(); err != nil {
+		return nil, err
+	}
+
+	if err = s.wallets.Unlock([]byte(passphrase), time.Duration(timeout)*time.Second); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// walletlock forgets the key of an encrypted wallet unlocked with
+// walletpassphrase
+func (s *Server) walletLock(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0, 0); err != nil {
+		return nil, err
+	}
+
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+
+	if err := s.loadWallets(); err != nil {
+		return nil, err
+	}
+	if !s.wallets.IsEncrypted() {
+		return nil, errors.New("wallet is not encrypted")
+	}
+
+	s.wallets.Lock()
+
+	return nil, nil
+}
+
+// submitblock [hex] adds a block mined elsewhere to the chain, relays it and
+// returns its hash
+func (s *Server) submitBlock(params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1, 1); err != nil {
+		return nil, err
+	}
+
+	var data string
+	if err := decodeParam(params, 0, &data); err != nil {
+		return nil, err
+	}
+
+	block, err := mining.DecodeSubmittedBlock(data)
+	if err != nil {
+		return nil, &Error{InvalidParams, err.Error()}
+	}
+
+	if err = s.relay.RelayBlock(block); err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(block.Hash), nil
+}
+
+func (s *Server) findUTXO(params []json.RawMessage) ([]*blockchain.UTXO, error) {
+	var address string
+	if err := decodeParam(params, 0, &address); err != nil {
+		return nil, err
+	}
+
+	script, err := blockchain.PayToAddressScript(address)
+	if err != nil {
+		return nil, &Error{InvalidParams, err.Error()}
+	}
+
+	UTXOSet := blockchain.UTXOSet{
+		Blockchain: s.chain,
+	}
+
+	return UTXOSet.FindUTXO(script)
+}
+
+// loadWallets rereads the wallet file, which other commands may have changed,
+// keeping the key of an unlocked wallet
+func (s *Server) loadWallets() error {
+	if err := s.wallets.LoadFromFile(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func checkParams(params []json.RawMessage, min, max int) error {
+	if len(params) < min || len(params) > max {
+		if min == max {
+			return &Error{InvalidParams, fmt.Sprintf("expected %d params, got %d", min, len(params))}
+		}
+		return &Error{InvalidParams, fmt.Sprintf("expected %d to %d params, got %d", min, max, len(params))}
+	}
+
+	return nil
+}
+
+func decodeParam(params []json.RawMessage, i int, v interface{}) error {
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return &Error{InvalidParams, fmt.Sprintf("param %d: %v", i, err)}
+	}
+
+	return nil
+}
+
+func intParam(params []json.RawMessage, i int) (int, error) {
+	var n int
+	err := decodeParam(params, i, &n)
+
+	return n, err
+}
+
+func hexParam(params []json.RawMessage, i int) ([]byte, error) {
+	var s string
+	if err := decodeParam(params, i, &s); err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, &Error{InvalidParams, fmt.Sprintf("param %d: %v", i, err)}
+	}
+
+	return data, nil
+}
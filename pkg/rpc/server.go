@@ -0,0 +1,226 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// maxRequestSize limits the body of a request, allowing for a hex encoded
+// block in submitblock
+const maxRequestSize = 2*blockchain.MaxBlockSize + 1024
+
+// maxUnlockTimeout is the longest walletpassphrase keeps a wallet unlocked,
+// in seconds
+const maxUnlockTimeout = 100000000
+
+// Error codes defined by JSON-RPC 2.0, along with ServerError for methods
+// that fail
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+	ServerError    = -32000
+)
+
+// Relayer submits transactions and blocks created through the API to the
+// network
+type Relayer interface {
+	RelayTransaction(tx *blockchain.Transaction) error
+	RelayBlock(block *blockchain.Block) error
+}
+
+// Request is a JSON-RPC 2.0 request. Params are positional
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC 2.0 response
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error describes why a request failed
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Server answers JSON-RPC requests over HTTP for a node and its wallet.
+// Every request must carry the configured credentials with basic auth
+type Server struct {
+	cfg   Config
+	chain *blockchain.Blockchain
+	pool  *blockchain.Mempool
+	relay Relayer
+	log   *log.Logger
+
+	// walletMu serialises changes to the wallet file and guards wallets,
+	// which holds the key of an unlocked wallet between requests
+	walletMu sync.Mutex
+	wallets  *blockchain.Wallets
+
+	methods map[string]func(params []json.RawMessage) (interface{}, error)
+}
+
+// NewServer creates a Server for chain and pool, relaying through relay.
+// Failed requests are logged to logger when it is not nil
+func NewServer(chain *blockchain.Blockchain, pool *blockchain.Mempool, relay Relayer, cfg Config, logger *log.Logger) *Server {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+
+	s := &Server{
+		cfg:   cfg,
+		chain: chain,
+		pool:  pool,
+		relay: relay,
+		log:   logger,
+
+		wallets: &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)},
+	}
+
+	s.methods = map[string]func(params []json.RawMessage) (interface{}, error){
+		"getbestblockhash": s.getBestBlockHash,
+		"getblock":         s.getBlock,
+		"getblockhash":     s.getBlockHash,
+		"gettransaction":   s.getTransaction,
+		"getbalance":       s.getBalance,
+		"listunspent":      s.listUnspent,
+		"getnewaddress":    s.getNewAddress,
+		"sendtoaddress":    s.sendToAddress,
+		"walletpassphrase": s.walletPassphrase,
+		"walletlock":       s.walletLock,
+		"submitblock":      s.submitBlock,
+	}
+
+	return s
+}
+
+// ServeHTTP handles a single request or a batch of them
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requests must be sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		writeJSON(w, errorResponse(nil, &Error{ParseError, err.Error()}))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err = json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			writeJSON(w, errorResponse(nil, &Error{InvalidRequest, "invalid batch"}))
+			return
+		}
+
+		var responses []*Response
+		for _, raw := range batch {
+			if resp := s.handle(raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, responses)
+		return
+	}
+
+	resp := s.handle(body)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// handle runs a single request, returning nil for notifications, which have
+// no ID and get no response
+func (s *Server) handle(raw json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(nil, &Error{ParseError, err.Error()})
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, &Error{InvalidRequest, "not a JSON-RPC 2.0 request"})
+	}
+
+	method, ok := s.methods[req.Method]
+	if !ok {
+		return respond(req.ID, nil, &Error{MethodNotFound, "method " + req.Method + " not found"})
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return respond(req.ID, nil, &Error{InvalidParams, "params must be an array"})
+		}
+	}
+
+	result, err := method(params)
+	if err != nil {
+		s.log.Printf("RPC %s failed: %v", req.Method, err)
+
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = &Error{ServerError, err.Error()}
+		}
+		return respond(req.ID, nil, rpcErr)
+	}
+
+	return respond(req.ID, result, nil)
+}
+
+func respond(id json.RawMessage, result interface{}, err *Error) *Response {
+	if id == nil {
+		return nil
+	}
+
+	return &Response{JSONRPC: "2.0", Result: result, Error: err, ID: id}
+}
+
+// errorResponse answers a request whose ID may not be known, which JSON-RPC
+// answers with a null ID
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return &Response{JSONRPC: "2.0", Error: err, ID: id}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+var testConfig = Config{User: "alice", Password: "secret"}
+
+// newTestServer creates a Server for a regtest chain in a temporary
+// directory, returning it with the hash of the genesis block
+func newTestServer(t *testing.T) (*Server, string) {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err = blockchain.UseNetwork(blockchain.RegTestParams, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets := &blockchain.Wallets{Wallets: make(map[string]*blockchain.Wallet)}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := blockchain.CreateBlockchain(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.DB.Close() })
+
+	genesis, err := bc.GetBlockHashByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewServer(bc, blockchain.NewMempool(bc), nil, testConfig, nil), hex.EncodeToString(genesis)
+}
+
+// post sends body to the server with the test credentials
+func post(s *Server, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.SetBasicAuth(testConfig.User, testConfig.Password)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	return w
+}
+
+// decodeResponse decodes a single response
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) *Response {
+	t.Helper()
+
+	var resp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+
+	return &resp
+}
+
+// checkError checks that a response failed with code
+func checkError(t *testing.T, resp *Response, code int) {
+	t.Helper()
+
+	if resp.Error == nil {
+		t.Fatalf("request succeeded with %v, want error %d", resp.Result, code)
+	}
+	if resp.Error.Code != code {
+		t.Errorf("error is %d %q, want %d", resp.Error.Code, resp.Error.Message, code)
+	}
+}
+
+func TestServeHTTPRequiresAuth(t *testing.T) {
+	s, _ := newTestServer(t)
+	body := `{"jsonrpc":"2.0","method":"getbestblockhash","id":1}`
+
+	for _, password := range []string{"", "wrong"} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if password != "" {
+			r.SetBasicAuth(testConfig.User, password)
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("password %q: status is %d, want %d", password, w.Code, http.StatusUnauthorized)
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("password %q: no WWW-Authenticate header", password)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth(testConfig.User, testConfig.Password)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status is %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestServeHTTPRequest(t *testing.T) {
+	s, genesis := newTestServer(t)
+
+	resp := decodeResponse(t, post(s, `{"jsonrpc":"2.0","method":"getblockhash","params":[0],"id":"a"}`))
+	if resp.Error != nil {
+		t.Fatalf("getblockhash failed: %v", resp.Error)
+	}
+	if resp.Result != genesis {
+		t.Errorf("result is %v, want %s", resp.Result, genesis)
+	}
+	if string(resp.ID) != `"a"` {
+		t.Errorf("ID is %s, want \"a\"", resp.ID)
+	}
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"invalid JSON", `{"jsonrpc":`, ParseError},
+		{"wrong version", `{"jsonrpc":"1.0","method":"getbestblockhash","id":1}`, InvalidRequest},
+		{"no method", `{"jsonrpc":"2.0","id":1}`, InvalidRequest},
+		{"empty batch", `[]`, InvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","method":"stop","id":1}`, MethodNotFound},
+		{"params not an array", `{"jsonrpc":"2.0","method":"getblockhash","params":{"height":0},"id":1}`, InvalidParams},
+		{"missing param", `{"jsonrpc":"2.0","method":"getblockhash","params":[],"id":1}`, InvalidParams},
+		{"extra param", `{"jsonrpc":"2.0","method":"getblockhash","params":[0,1],"id":1}`, InvalidParams},
+		{"param of the wrong type", `{"jsonrpc":"2.0","method":"getblockhash","params":["zero"],"id":1}`, InvalidParams},
+		{"hash that is not hex", `{"jsonrpc":"2.0","method":"getblock","params":["xyz"],"id":1}`, InvalidParams},
+		{"height above the tip", `{"jsonrpc":"2.0","method":"getblockhash","params":[100],"id":1}`, ServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkError(t, decodeResponse(t, post(s, test.body)), test.code)
+		})
+	}
+}
+
+func TestServeHTTPNotifications(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// Notifications get no response, even when they fail
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"getbestblockhash"}`,
+		`{"jsonrpc":"2.0","method":"stop"}`,
+		`[{"jsonrpc":"2.0","method":"getbestblockhash"},{"jsonrpc":"2.0","method":"getblockhash","params":[]}]`,
+	} {
+		w := post(s, body)
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("%s: got status %d and %q, want %d and no body", body, w.Code, w.Body.String(), http.StatusNoContent)
+		}
+	}
+}
+
+func TestServeHTTPBatch(t *testing.T) {
+	s, genesis := newTestServer(t)
+
+	w := post(s, `[
+		{"jsonrpc":"2.0","method":"getblockhash","params":[0],"id":1},
+		{"jsonrpc":"2.0","method":"getbestblockhash"},
+		{"jsonrpc":"2.0","method":"stop","id":2},
+		42
+	]`)
+
+	var responses []*Response
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("decoding batch response %q: %v", w.Body.String(), err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("got %d responses, want 3 as the notification is not answered", len(responses))
+	}
+
+	if responses[0].Error != nil || responses[0].Result != genesis || string(responses[0].ID) != "1" {
+		t.Errorf("first response is %+v, want the genesis hash for ID 1", responses[0])
+	}
+
+	checkError(t, responses[1], MethodNotFound)
+	if string(responses[1].ID) != "2" {
+		t.Errorf("second response has ID %s, want 2", responses[1].ID)
+	}
+
+	checkError(t, responses[2], ParseError)
+	if string(responses[2].ID) != "null" {
+		t.Errorf("response to an invalid request has ID %s, want null", responses[2].ID)
+	}
+}
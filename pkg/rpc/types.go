@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// Tx is the JSON form of a transaction, with the fields of
+// Transaction.String. Byte strings are hex encoded
+type Tx struct {
+	Txid          string     `json:"txid"`
+	Vin           []TxInput  `json:"vin"`
+	Vout          []TxOutput `json:"vout"`
+	LockTime      int        `json:"locktime"`
+	BlockHash     string     `json:"blockhash,omitempty"`
+	Confirmations int        `json:"confirmations"`
+}
+
+// TxInput is the JSON form of a transaction input. ScriptSig is the
+// signature script, or the data of a coinbase
+type TxInput struct {
+	Txid      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	ScriptSig string `json:"scriptsig"`
+	Asm       string `json:"asm,omitempty"`
+}
+
+// TxOutput is the JSON form of a transaction output. Script is the script
+// the output is locked with, and Address is set when it pays an address
+type TxOutput struct {
+	Value   int    `json:"value"`
+	Script  string `json:"script"`
+	Asm     string `json:"asm"`
+	Address string `json:"address,omitempty"`
+}
+
+// Block is the JSON form of a block and its header
+type Block struct {
+	Hash          string   `json:"hash"`
+	Confirmations int      `json:"confirmations"`
+	Height        int      `json:"height"`
+	Version       int32    `json:"version"`
+	PrevBlockHash string   `json:"previousblockhash"`
+	MerkleRoot    string   `json:"merkleroot"`
+	Timestamp     int64    `json:"time"`
+	Bits          string   `json:"bits"`
+	Nonce         int64    `json:"nonce"`
+	Tx            []string `json:"tx"`
+}
+
+// Unspent is the JSON form of an unspent output
+type Unspent struct {
+	Txid          string `json:"txid"`
+	Vout          int    `json:"vout"`
+	Value         int    `json:"value"`
+	Height        int    `json:"height"`
+	Coinbase      bool   `json:"coinbase"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// NewTx converts a transaction to its JSON form
+func NewTx(tx *blockchain.Transaction) *Tx {
+	result := &Tx{
+		Txid:     hex.EncodeToString(tx.ID),
+		Vin:      []TxInput{},
+		Vout:     []TxOutput{},
+		LockTime: tx.LockTime,
+	}
+
+	for _, in := range tx.Vin {
+		input := TxInput{
+			Txid:      hex.EncodeToString(in.Txid),
+			Vout:      in.Vout,
+			ScriptSig: hex.EncodeToString(in.ScriptSig),
+		}
+		if !tx.IsCoinbase() {
+			input.Asm = blockchain.DisasmScript(in.ScriptSig)
+		}
+
+		result.Vin = append(result.Vin, input)
+	}
+
+	for _, out := range tx.Vout {
+		output := TxOutput{
+			Value:   out.Value,
+			Script:  hex.EncodeToString(out.ScriptPubKey),
+			Asm:     blockchain.DisasmScript(out.ScriptPubKey),
+			Address: blockchain.ScriptAddress(out.ScriptPubKey),
+		}
+
+		result.Vout = append(result.Vout, output)
+	}
+
+	return result
+}
+
+// NewUnspent converts an unspent output to its JSON form. bestHeight is the
+// height of the tip of the best chain
+func NewUnspent(utxo *blockchain.UTXO, bestHeight int) *Unspent {
+	return &Unspent{
+		Txid:          hex.EncodeToString(utxo.Outpoint.Txid),
+		Vout:          utxo.Outpoint.Vout,
+		Value:         utxo.Entry.Value,
+		Height:        utxo.Entry.Height,
+		Coinbase:      utxo.Entry.Coinbase,
+		Confirmations: bestHeight - utxo.Entry.Height + 1,
+	}
+}
+
+// NewBlock converts a block to its JSON form, listing the IDs of its
+// transactions. Confirmations is left for the caller to fill in
+func NewBlock(block *blockchain.Block) *Block {
+	result := &Block{
+		Hash:          hex.EncodeToString(block.Hash),
+		Height:        block.Height,
+		Version:       block.Version,
+		PrevBlockHash: hex.EncodeToString(block.PrevBlockHash),
+		MerkleRoot:    hex.EncodeToString(block.MerkleRoot),
+		Timestamp:     block.Timestamp,
+		Bits:          fmt.Sprintf("%08x", block.Bits),
+		Nonce:         block.Nonce,
+		Tx:            []string{},
+	}
+
+	for _, tx := range block.Transactions {
+		result.Tx = append(result.Tx, hex.EncodeToString(tx.ID))
+	}
+
+	return result
+}
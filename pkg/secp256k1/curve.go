@@ -0,0 +1,287 @@
+// Package secp256k1 implements the secp256k1 curve, its keys and ECDSA
+// signatures over it, as used by Bitcoin. Points are added in Jacobian
+// coordinates with math/big, so operations are not constant time
+package secp256k1
+
+import (
+	"crypto/elliptic"
+	"math/big"
+)
+
+// KoblitzCurve is secp256k1, y² = x³ + 7. It implements elliptic.Curve,
+// whose generic CurveParams methods only work for curves with a = -3
+type KoblitzCurve struct {
+	*elliptic.CurveParams
+
+	// halfOrder is N/2, the largest S of a canonical signature
+	halfOrder *big.Int
+}
+
+var secp256k1 *KoblitzCurve
+
+func init() {
+	params := &elliptic.CurveParams{
+		Name:    "secp256k1",
+		BitSize: 256,
+		P:       fromHex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+		N:       fromHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+		B:       big.NewInt(7),
+		Gx:      fromHex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		Gy:      fromHex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+	}
+
+	secp256k1 = &KoblitzCurve{
+		CurveParams: params,
+		halfOrder:   new(big.Int).Rsh(params.N, 1),
+	}
+}
+
+// S256 returns the secp256k1 curve
+func S256() *KoblitzCurve {
+	return secp256k1
+}
+
+// Params returns the parameters of the curve
+func (curve *KoblitzCurve) Params() *elliptic.CurveParams {
+	return curve.CurveParams
+}
+
+// IsOnCurve reports whether (x, y) is a point of the curve
+func (curve *KoblitzCurve) IsOnCurve(x, y *big.Int) bool {
+	if x.Sign() < 0 || x.Cmp(curve.P) >= 0 || y.Sign() < 0 || y.Cmp(curve.P) >= 0 {
+		return false
+	}
+
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, curve.P)
+
+	return y2.Cmp(curve.rhs(x)) == 0
+}
+
+// Add returns the sum of two points
+func (curve *KoblitzCurve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return curve.toAffine(curve.addJacobian(curve.toJacobian(x1, y1), curve.toJacobian(x2, y2)))
+}
+
+// Double returns twice a point
+func (curve *KoblitzCurve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	return curve.toAffine(curve.doubleJacobian(curve.toJacobian(x1, y1)))
+}
+
+// ScalarMult returns k times a point, with k a big endian integer
+func (curve *KoblitzCurve) ScalarMult(x1, y1 *big.Int, k []byte) (*big.Int, *big.Int) {
+	return curve.toAffine(curve.scalarMult(curve.toJacobian(x1, y1), new(big.Int).SetBytes(k)))
+}
+
+// ScalarBaseMult returns k times the base point, with k a big endian integer
+func (curve *KoblitzCurve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return curve.ScalarMult(curve.Gx, curve.Gy, k)
+}
+
+// decompressY returns the Y coordinate of the point with the given X whose
+// lowest bit is odd, or nil if there is no such point
+func (curve *KoblitzCurve) decompressY(x *big.Int, odd bool) *big.Int {
+	if x.Cmp(curve.P) >= 0 {
+		return nil
+	}
+
+	// P is 3 mod 4, so a square root is a power (P+1)/4 away
+	rhs := curve.rhs(x)
+	exp := new(big.Int).Add(curve.P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(rhs, exp, curve.P)
+
+	check := new(big.Int).Mul(y, y)
+	if check.Mod(check, curve.P).Cmp(rhs) != 0 {
+		return nil
+	}
+
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(curve.P, y)
+	}
+
+	return y
+}
+
+// rhs returns x³ + 7
+func (curve *KoblitzCurve) rhs(x *big.Int) *big.Int {
+	x3 := new(big.Int).Mul(x, x)
+	x3.Mul(x3, x)
+	x3.Add(x3, curve.B)
+
+	return x3.Mod(x3, curve.P)
+}
+
+// jacobianPoint is the point (X/Z², Y/Z³), or the point at infinity when Z
+// is zero
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+func (curve *KoblitzCurve) toJacobian(x, y *big.Int) *jacobianPoint {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return curve.infinity()
+	}
+
+	return &jacobianPoint{new(big.Int).Set(x), new(big.Int).Set(y), big.NewInt(1)}
+}
+
+// toAffine converts a point back, returning (0, 0) for the point at infinity
+// as crypto/elliptic does
+func (curve *KoblitzCurve) toAffine(p *jacobianPoint) (*big.Int, *big.Int) {
+	if p.z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+
+	zInv := new(big.Int).ModInverse(p.z, curve.P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+
+	x := new(big.Int).Mul(p.x, zInv2)
+	x.Mod(x, curve.P)
+
+	y := zInv2.Mul(zInv2, zInv)
+	y.Mul(y, p.y)
+	y.Mod(y, curve.P)
+
+	return x, y
+}
+
+func (curve *KoblitzCurve) infinity() *jacobianPoint {
+	return &jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+}
+
+// doubleJacobian uses the dbl-2009-l formulas for curves with a = 0
+func (curve *KoblitzCurve) doubleJacobian(p *jacobianPoint) *jacobianPoint {
+	if p.z.Sign() == 0 || p.y.Sign() == 0 {
+		return curve.infinity()
+	}
+
+	P := curve.P
+
+	a := new(big.Int).Mul(p.x, p.x)
+	a.Mod(a, P)
+	b := new(big.Int).Mul(p.y, p.y)
+	b.Mod(b, P)
+	c := new(big.Int).Mul(b, b)
+	c.Mod(c, P)
+
+	// d = 2((x + b)² - a - c)
+	d := new(big.Int).Add(p.x, b)
+	d.Mul(d, d)
+	d.Sub(d, a)
+	d.Sub(d, c)
+	d.Lsh(d, 1)
+	d.Mod(d, P)
+
+	e := new(big.Int).Lsh(a, 1)
+	e.Add(e, a)
+	f := new(big.Int).Mul(e, e)
+
+	x3 := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+	x3.Mod(x3, P)
+
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e)
+	y3.Sub(y3, c.Lsh(c, 3))
+	y3.Mod(y3, P)
+
+	z3 := new(big.Int).Mul(p.y, p.z)
+	z3.Lsh(z3, 1)
+	z3.Mod(z3, P)
+
+	return &jacobianPoint{x3, y3, z3}
+}
+
+// addJacobian uses the add-2007-bl formulas
+func (curve *KoblitzCurve) addJacobian(p1, p2 *jacobianPoint) *jacobianPoint {
+	if p1.z.Sign() == 0 {
+		return p2
+	}
+	if p2.z.Sign() == 0 {
+		return p1
+	}
+
+	P := curve.P
+
+	z1z1 := new(big.Int).Mul(p1.z, p1.z)
+	z1z1.Mod(z1z1, P)
+	z2z2 := new(big.Int).Mul(p2.z, p2.z)
+	z2z2.Mod(z2z2, P)
+
+	u1 := new(big.Int).Mul(p1.x, z2z2)
+	u1.Mod(u1, P)
+	u2 := new(big.Int).Mul(p2.x, z1z1)
+	u2.Mod(u2, P)
+
+	s1 := new(big.Int).Mul(p1.y, p2.z)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, P)
+	s2 := new(big.Int).Mul(p2.y, p1.z)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, P)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, P)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, P)
+
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return curve.doubleJacobian(p1)
+		}
+		return curve.infinity()
+	}
+
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	i.Mod(i, P)
+	j := new(big.Int).Mul(h, i)
+	j.Mod(j, P)
+	r.Lsh(r, 1)
+	v := new(big.Int).Mul(u1, i)
+	v.Mod(v, P)
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, new(big.Int).Lsh(v, 1))
+	x3.Mod(x3, P)
+
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	s1.Mul(s1, j)
+	s1.Lsh(s1, 1)
+	y3.Sub(y3, s1)
+	y3.Mod(y3, P)
+
+	z3 := new(big.Int).Add(p1.z, p2.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	z3.Mod(z3, P)
+
+	return &jacobianPoint{x3, y3, z3}
+}
+
+// scalarMult returns k times p by doubling and adding
+func (curve *KoblitzCurve) scalarMult(p *jacobianPoint, k *big.Int) *jacobianPoint {
+	result := curve.infinity()
+
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = curve.doubleJacobian(result)
+		if k.Bit(i) == 1 {
+			result = curve.addJacobian(result, p)
+		}
+	}
+
+	return result
+}
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("secp256k1: invalid constant " + s)
+	}
+
+	return n
+}
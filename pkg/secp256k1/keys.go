@@ -0,0 +1,126 @@
+package secp256k1
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+const (
+	// PrivKeyLen is the length of a serialized private key
+	PrivKeyLen = 32
+
+	// PubKeyLen is the length of a compressed public key
+	PubKeyLen = 33
+
+	// uncompressedPubKeyLen is the length of an uncompressed public key
+	uncompressedPubKeyLen = 65
+)
+
+// PublicKey is a point of the curve
+type PublicKey struct {
+	X, Y *big.Int
+}
+
+// PrivateKey is a scalar from 1 to N-1 along with its public key
+type PrivateKey struct {
+	PublicKey
+	D *big.Int
+}
+
+// NewPrivateKey generates a random private key
+func NewPrivateKey() (*PrivateKey, error) {
+	b := make([]byte, PrivKeyLen)
+	for {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+
+		// Fewer than one in 2^127 values are out of range
+		if key, err := PrivKeyFromBytes(b); err == nil {
+			return key, nil
+		}
+	}
+}
+
+// PrivKeyFromBytes returns the private key of a 32 byte big endian scalar
+func PrivKeyFromBytes(b []byte) (*PrivateKey, error) {
+	if len(b) != PrivKeyLen {
+		return nil, fmt.Errorf("private key is %d bytes, expected %d", len(b), PrivKeyLen)
+	}
+
+	d := new(big.Int).SetBytes(b)
+	if d.Sign() == 0 || d.Cmp(secp256k1.N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+
+	key := &PrivateKey{D: d}
+	key.X, key.Y = secp256k1.ScalarBaseMult(b)
+
+	return key, nil
+}
+
+// Serialize returns the private key as 32 big endian bytes
+func (k *PrivateKey) Serialize() []byte {
+	return paddedBytes(k.D, PrivKeyLen)
+}
+
+// PubKey returns the public key of the private key
+func (k *PrivateKey) PubKey() *PublicKey {
+	return &k.PublicKey
+}
+
+// ParsePubKey parses a public key in the compressed SEC1 form, or the
+// uncompressed one starting with 4, checking that it is on the curve
+func ParsePubKey(b []byte) (*PublicKey, error) {
+	switch {
+	case len(b) == PubKeyLen && (b[0] == 2 || b[0] == 3):
+		x := new(big.Int).SetBytes(b[1:])
+		y := secp256k1.decompressY(x, b[0] == 3)
+		if y == nil {
+			return nil, errors.New("public key is not on the curve")
+		}
+
+		return &PublicKey{X: x, Y: y}, nil
+
+	case len(b) == uncompressedPubKeyLen && b[0] == 4:
+		x := new(big.Int).SetBytes(b[1:33])
+		y := new(big.Int).SetBytes(b[33:])
+		if !secp256k1.IsOnCurve(x, y) {
+			return nil, errors.New("public key is not on the curve")
+		}
+
+		return &PublicKey{X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("public key of %d bytes is not in a known form", len(b))
+}
+
+// SerializeCompressed returns the 33 byte compressed form of the key, its X
+// coordinate prefixed by 2 or 3 for an even or odd Y
+func (p *PublicKey) SerializeCompressed() []byte {
+	b := make([]byte, 1, PubKeyLen)
+	b[0] = byte(2 + p.Y.Bit(0))
+
+	return append(b, paddedBytes(p.X, 32)...)
+}
+
+// SerializeUncompressed returns the 65 byte uncompressed form of the key
+func (p *PublicKey) SerializeUncompressed() []byte {
+	b := make([]byte, 1, uncompressedPubKeyLen)
+	b[0] = 4
+	b = append(b, paddedBytes(p.X, 32)...)
+
+	return append(b, paddedBytes(p.Y, 32)...)
+}
+
+// paddedBytes returns n as size big endian bytes
+func paddedBytes(n *big.Int, size int) []byte {
+	b := make([]byte, size)
+	nb := n.Bytes()
+	copy(b[size-len(nb):], nb)
+
+	return b
+}
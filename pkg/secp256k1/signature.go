@@ -0,0 +1,221 @@
+package secp256k1
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// CompactSignatureLen is the length of a signature as R and S of 32 bytes
+const CompactSignatureLen = 64
+
+// Signature is an ECDSA signature. Signatures made by Sign are canonical,
+// with S in the lower half of the order, since S and N-S both verify
+type Signature struct {
+	R, S *big.Int
+}
+
+// Sign signs a hash with a nonce derived from the key and hash as in RFC
+// 6979, so that signing needs no randomness and the same hash always gives
+// the same signature
+func (k *PrivateKey) Sign(hash []byte) *Signature {
+	N := secp256k1.N
+	e := hashToInt(hash)
+
+	nonces := newNonceGenerator(k.Serialize(), paddedBytes(new(big.Int).Mod(e, N), 32))
+	for {
+		nonce := nonces.next()
+
+		x, _ := secp256k1.ScalarBaseMult(paddedBytes(nonce, 32))
+		r := x.Mod(x, N)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = (e + r*d) / nonce
+		s := new(big.Int).Mul(r, k.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(nonce, N))
+		s.Mod(s, N)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		if s.Cmp(secp256k1.halfOrder) > 0 {
+			s.Sub(N, s)
+		}
+
+		return &Signature{R: r, S: s}
+	}
+}
+
+// Verify reports whether the signature of hash is valid for the public key.
+// Signatures that are not canonical are rejected, so that a signed
+// transaction cannot be changed into another valid one
+func (sig *Signature) Verify(hash []byte, pub *PublicKey) bool {
+	N := secp256k1.N
+	if sig.R.Sign() <= 0 || sig.R.Cmp(N) >= 0 || sig.S.Sign() <= 0 || sig.S.Cmp(secp256k1.halfOrder) > 0 {
+		return false
+	}
+	if !secp256k1.IsOnCurve(pub.X, pub.Y) {
+		return false
+	}
+
+	w := new(big.Int).ModInverse(sig.S, N)
+	u1 := hashToInt(hash)
+	u1.Mul(u1, w)
+	u1.Mod(u1, N)
+	u2 := w.Mul(sig.R, w)
+	u2.Mod(u2, N)
+
+	p := secp256k1.addJacobian(
+		secp256k1.scalarMult(secp256k1.toJacobian(secp256k1.Gx, secp256k1.Gy), u1),
+		secp256k1.scalarMult(secp256k1.toJacobian(pub.X, pub.Y), u2),
+	)
+	if p.z.Sign() == 0 {
+		return false
+	}
+
+	x, _ := secp256k1.toAffine(p)
+
+	return x.Mod(x, N).Cmp(sig.R) == 0
+}
+
+// SerializeCompact returns the signature as R and S of 32 bytes each
+func (sig *Signature) SerializeCompact() []byte {
+	return append(paddedBytes(sig.R, 32), paddedBytes(sig.S, 32)...)
+}
+
+// ParseCompactSignature parses a signature serialized by SerializeCompact
+func ParseCompactSignature(b []byte) (*Signature, error) {
+	if len(b) != CompactSignatureLen {
+		return nil, fmt.Errorf("signature is %d bytes, expected %d", len(b), CompactSignatureLen)
+	}
+
+	return &Signature{
+		R: new(big.Int).SetBytes(b[:32]),
+		S: new(big.Int).SetBytes(b[32:]),
+	}, nil
+}
+
+// Serialize returns the DER encoding of the signature, a sequence of the
+// integers R and S
+func (sig *Signature) Serialize() []byte {
+	r := derInt(sig.R)
+	s := derInt(sig.S)
+
+	b := []byte{0x30, byte(len(r) + len(s))}
+	b = append(b, r...)
+
+	return append(b, s...)
+}
+
+// ParseDERSignature parses a DER encoded signature, accepting only the
+// shortest encoding of each integer
+func ParseDERSignature(b []byte) (*Signature, error) {
+	if len(b) < 8 || len(b) > 72 || b[0] != 0x30 || int(b[1]) != len(b)-2 {
+		return nil, errors.New("signature is not a DER sequence")
+	}
+
+	r, rest, err := parseDERInt(b[2:])
+	if err != nil {
+		return nil, err
+	}
+	s, rest, err := parseDERInt(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("signature has trailing bytes")
+	}
+
+	return &Signature{R: r, S: s}, nil
+}
+
+// derInt encodes a positive integer, with a leading zero byte when its
+// high bit is set so that it is not read as negative
+func derInt(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+
+	return append([]byte{0x02, byte(len(b))}, b...)
+}
+
+func parseDERInt(b []byte) (*big.Int, []byte, error) {
+	if len(b) < 2 || b[0] != 0x02 {
+		return nil, nil, errors.New("signature integer is missing")
+	}
+
+	length := int(b[1])
+	if length == 0 || length > 33 || len(b) < 2+length {
+		return nil, nil, errors.New("signature integer has an invalid length")
+	}
+
+	n := b[2 : 2+length]
+	if n[0]&0x80 != 0 {
+		return nil, nil, errors.New("signature integer is negative")
+	}
+	if len(n) > 1 && n[0] == 0 && n[1]&0x80 == 0 {
+		return nil, nil, errors.New("signature integer is not minimally encoded")
+	}
+
+	return new(big.Int).SetBytes(n), b[2+length:], nil
+}
+
+// hashToInt takes the leftmost 256 bits of a hash as an integer
+func hashToInt(hash []byte) *big.Int {
+	if len(hash) > 32 {
+		hash = hash[:32]
+	}
+
+	return new(big.Int).SetBytes(hash)
+}
+
+// nonceGenerator generates the nonces of RFC 6979 with HMAC-SHA256
+type nonceGenerator struct {
+	k, v []byte
+}
+
+func newNonceGenerator(key, hash []byte) *nonceGenerator {
+	g := &nonceGenerator{
+		k: make([]byte, 32),
+		v: bytes.Repeat([]byte{1}, 32),
+	}
+
+	g.k = hmacSHA256(g.k, g.v, []byte{0}, key, hash)
+	g.v = hmacSHA256(g.k, g.v)
+	g.k = hmacSHA256(g.k, g.v, []byte{1}, key, hash)
+	g.v = hmacSHA256(g.k, g.v)
+
+	return g
+}
+
+// next returns the next candidate from 1 to N-1
+func (g *nonceGenerator) next() *big.Int {
+	for {
+		g.v = hmacSHA256(g.k, g.v)
+		nonce := new(big.Int).SetBytes(g.v)
+
+		// Later candidates of the RFC start from a new key
+		g.k = hmacSHA256(g.k, g.v, []byte{0})
+		g.v = hmacSHA256(g.k, g.v)
+
+		if nonce.Sign() > 0 && nonce.Cmp(secp256k1.N) < 0 {
+			return nonce
+		}
+	}
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
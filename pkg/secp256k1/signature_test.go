@@ -0,0 +1,157 @@
+package secp256k1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// RFC 6979 vectors on secp256k1 with SHA-256 and low S, matching those of
+// Trezor and CoreBitcoin: the key, the message hashed, the nonce of the
+// first signing attempt and the DER signature
+var rfc6979Tests = []struct {
+	key, msg, nonce, signature string
+}{
+	{
+		"cca9fbcc1b41e5a95d369eaa6ddcff73b61a4efaa279cfc6567e8daa39cbaf50",
+		"sample",
+		"2df40ca70e639d89528a6b670d9d48d9165fdc0febc0974056bdce192b8e16a3",
+		"3045022100af340daf02cc15c8d5d08d7735dfe6b98a474ed373bdb5fbecf7571be52b384202205009fb27f37034a9b24b707b7c6b79ca23ddef9e25f7282e8a797efe53a8f124",
+	},
+	{
+		// S is above half the order before it is lowered
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"Satoshi Nakamoto",
+		"8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15",
+		"3045022100934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d802202442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5",
+	},
+	{
+		"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140",
+		"Satoshi Nakamoto",
+		"33a19b60e25fb6f4435af53a3d42d493644827367e6453928554f43e49aa6f90",
+		"3045022100fd567d121db66e382991534ada77a6bd3106f0a1098c231e47993447cd6af2d002206b39cd0eb1bc8603e159ef5c20a5c8ad685a45b06ce9bebed3f153d10d93bed5",
+	},
+	{
+		"f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181",
+		"Alan Turing",
+		"525a82b70e67874398067543fd84c83d30c175fdc45fdeee082fe13b1d7cfdf1",
+		"304402207063ae83e7f62bbb171798131b4a0564b956930092b33b07b395615d9ec7e15c022058dfcc1e00a35e1572f366ffe34ba0fc47db1e7189759b9fb233c5b05ab388ea",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"All those moments will be lost in time, like tears in rain. Time to die...",
+		"38aa22d72376b4dbc472e06c3ba403ee0a394da63fc58d88686c611aba98d6b3",
+		"30450221008600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b0220547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21",
+	},
+	{
+		"e91671c46231f833a6406ccbea0e3e392c76c167bac1cb013f6f1013980455c2",
+		"There is a computer disease that anybody who works with computers knows about. It's a very serious disease and it interferes completely with the work. The trouble with computers is that you 'play' with them!",
+		"1f4b84c23a86a221d233f2521be018d9318639d5b8bbd6374a8a59232d16ad3d",
+		"3045022100b552edd27580141f3b2a5463048cb7cd3e047b97c9f98076c32dbdf85a68718b0220279fa72dd19bfae05577e06c7c0c1900c371fcd5893f7e1d56a37d30174671f6",
+	},
+}
+
+func TestRFC6979(t *testing.T) {
+	for _, test := range rfc6979Tests {
+		keyBytes, _ := hex.DecodeString(test.key)
+		key, err := PrivKeyFromBytes(keyBytes)
+		if err != nil {
+			t.Fatalf("%s: %v", test.key, err)
+		}
+		hash := sha256.Sum256([]byte(test.msg))
+
+		nonces := newNonceGenerator(key.Serialize(), hash[:])
+		if nonce := hex.EncodeToString(paddedBytes(nonces.next(), 32)); nonce != test.nonce {
+			t.Errorf("%q: nonce is %s, want %s", test.msg, nonce, test.nonce)
+		}
+
+		sig := key.Sign(hash[:])
+		if der := hex.EncodeToString(sig.Serialize()); der != test.signature {
+			t.Errorf("%q: signature is %s, want %s", test.msg, der, test.signature)
+		}
+		if !sig.Verify(hash[:], key.PubKey()) {
+			t.Errorf("%q: signature does not verify", test.msg)
+		}
+
+		want, _ := hex.DecodeString(test.signature)
+		parsed, err := ParseDERSignature(want)
+		if err != nil {
+			t.Fatalf("%q: %v", test.msg, err)
+		}
+		if parsed.R.Cmp(sig.R) != 0 || parsed.S.Cmp(sig.S) != 0 {
+			t.Errorf("%q: parsed DER signature differs", test.msg)
+		}
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	for _, test := range rfc6979Tests {
+		keyBytes, _ := hex.DecodeString(test.key)
+		key, err := PrivKeyFromBytes(keyBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := sha256.Sum256([]byte(test.msg))
+
+		sig := key.Sign(hash[:])
+		if sig.S.Cmp(secp256k1.halfOrder) > 0 {
+			t.Errorf("%q: Sign gave a high S", test.msg)
+		}
+
+		// N-S is just as valid an ECDSA signature, which Verify must not
+		// accept so that signatures cannot be malleated
+		high := &Signature{R: sig.R, S: new(big.Int).Sub(secp256k1.N, sig.S)}
+		if high.Verify(hash[:], key.PubKey()) {
+			t.Errorf("%q: signature with a high S verified", test.msg)
+		}
+
+		parsed, err := ParseCompactSignature(high.SerializeCompact())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Verify(hash[:], key.PubKey()) {
+			t.Errorf("%q: compact signature with a high S verified", test.msg)
+		}
+	}
+}
+
+func TestVerifyRejectsOtherHashAndKey(t *testing.T) {
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256([]byte("message"))
+	sig := key.Sign(hash[:])
+
+	compact := sig.SerializeCompact()
+	parsed, err := ParseCompactSignature(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Verify(hash[:], key.PubKey()) {
+		t.Fatal("compact signature does not verify after parsing")
+	}
+
+	otherHash := sha256.Sum256([]byte("other message"))
+	if sig.Verify(otherHash[:], key.PubKey()) {
+		t.Error("signature verified for another hash")
+	}
+	if sig.Verify(hash[:], other.PubKey()) {
+		t.Error("signature verified for another key")
+	}
+
+	pub, err := ParsePubKey(key.PubKey().SerializeCompressed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pub.SerializeUncompressed(), key.PubKey().SerializeUncompressed()) {
+		t.Error("compressed public key does not parse back to the key")
+	}
+}
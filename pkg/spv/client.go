@@ -0,0 +1,278 @@
+package spv
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/p2p"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+
+	// responseTimeout bounds how long the node may take to answer a request
+	responseTimeout = 2 * time.Minute
+)
+
+// Tx is a transaction proven to be in a block on the main chain
+type Tx struct {
+	*blockchain.Transaction
+	BlockHash []byte
+	Height    int
+}
+
+// Client is a light client connected to a full node. It keeps only block
+// headers, which it checks itself, and learns about the transactions of its
+// addresses from Merkle proofs against those headers. The node can prove a
+// transaction is in a block but cannot be made to prove it has sent every
+// transaction, so a dishonest node can hide payments but not invent them
+type Client struct {
+	conn  net.Conn
+	magic uint32
+	store *HeaderStore
+}
+
+// Dial connects to the node at addr and completes the version handshake
+func Dial(addr string, magic uint32, store *HeaderStore) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn, magic: magic, store: store}
+	if err = c.handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake with %s failed: %v", addr, err)
+	}
+
+	return c, nil
+}
+
+// Close disconnects from the node
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// SyncHeaders downloads and stores the headers the node has beyond our
+// tip, returning the number of headers received
+func (c *Client) SyncHeaders() (int, error) {
+	total := 0
+
+	for {
+		locator, err := c.store.Locator()
+		if err != nil {
+			return total, err
+		}
+
+		if err = c.send(&p2p.MsgGetHeaders{Locator: locator}); err != nil {
+			return total, err
+		}
+
+		msg, err := c.await(p2p.CmdHeaders)
+		if err != nil {
+			return total, err
+		}
+		headers := msg.(*p2p.MsgHeaders).Headers
+
+		if err = c.store.AddHeaders(headers); err != nil {
+			return total, err
+		}
+		total += len(headers)
+
+		if len(headers) < p2p.MaxHeadersPerMsg {
+			return total, nil
+		}
+	}
+}
+
+// FetchTransactions asks the node for the transactions paying or spending
+// from the public key hashes, keeping those whose proofs check out against
+// a header on our main chain. Headers should be synced first
+func (c *Client) FetchTransactions(pubKeyHashes [][]byte) ([]*Tx, error) {
+	var txs []*Tx
+	seen := make(map[string]bool)
+
+	// The node only answers for so many keys at once, and a transaction
+	// touching keys of two requests is proven twice
+	for len(pubKeyHashes) > 0 {
+		n := len(pubKeyHashes)
+		if n > p2p.MaxKeysPerMsg {
+			n = p2p.MaxKeysPerMsg
+		}
+
+		fetched, err := c.fetchTransactions(pubKeyHashes[:n])
+		if err != nil {
+			return nil, err
+		}
+		pubKeyHashes = pubKeyHashes[n:]
+
+		for _, tx := range fetched {
+			if id := string(tx.ID); !seen[id] {
+				seen[id] = true
+				txs = append(txs, tx)
+			}
+		}
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Height < txs[j].Height })
+
+	return txs, nil
+}
+
+// fetchTransactions makes a single request of FetchTransactions
+func (c *Client) fetchTransactions(pubKeyHashes [][]byte) ([]*Tx, error) {
+	if err := c.send(&p2p.MsgGetProofs{PubKeyHashes: pubKeyHashes}); err != nil {
+		return nil, err
+	}
+
+	var txs []*Tx
+	for {
+		msg, err := c.await(p2p.CmdProofs)
+		if err != nil {
+			return nil, err
+		}
+		proofs := msg.(*p2p.MsgProofs)
+
+		for _, proof := range proofs.Proofs {
+			header, err := c.store.MainChainHeader(proof.BlockHash)
+			if err != nil {
+				return nil, err
+			}
+			if header == nil {
+				return nil, fmt.Errorf("proof of transaction %x is for block %x, which is not on our main chain", proof.Transaction.ID, proof.BlockHash)
+			}
+
+			if err = proof.Verify(header); err != nil {
+				return nil, err
+			}
+
+			txs = append(txs, &Tx{
+				Transaction: proof.Transaction,
+				BlockHash:   proof.BlockHash,
+				Height:      header.Height,
+			})
+		}
+
+		if proofs.Complete {
+			return txs, nil
+		}
+	}
+}
+
+// Balance sums the outputs paying pubKeyHash that none of the transactions
+// spend
+func Balance(txs []*Tx, pubKeyHash []byte) int {
+	spent := make(map[string]bool)
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Vin {
+			spent[in.Outpoint().String()] = true
+		}
+	}
+
+	balance := 0
+	for _, tx := range txs {
+		for i, out := range tx.Vout {
+			if out.IsLockedWithKey(pubKeyHash) && !spent[blockchain.Outpoint{Txid: tx.ID, Vout: i}.String()] {
+				balance += out.Value
+			}
+		}
+	}
+
+	return balance
+}
+
+func (c *Client) handshake() error {
+	var best []byte
+	tip, err := c.store.Tip()
+	if err != nil {
+		return err
+	}
+	if tip != nil {
+		best = tip.Hash()
+	}
+
+	err = c.send(&p2p.MsgVersion{
+		Version:       p2p.ProtocolVersion,
+		Timestamp:     time.Now().Unix(),
+		Nonce:         rand.Uint64(),
+		UserAgent:     p2p.UserAgent,
+		BestBlockHash: best,
+	})
+	if err != nil {
+		return err
+	}
+
+	gotVersion, gotVerAck := false, false
+	for !gotVersion || !gotVerAck {
+		msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+
+		switch m := msg.(type) {
+		case *p2p.MsgVersion:
+			if m.Version < p2p.MinProtocolVersion {
+				return fmt.Errorf("protocol version %d is too old", m.Version)
+			}
+			gotVersion = true
+			if err = c.send(&p2p.MsgVerAck{}); err != nil {
+				return err
+			}
+		case *p2p.MsgVerAck:
+			gotVerAck = true
+		}
+	}
+
+	return nil
+}
+
+// await reads messages until one with the given command arrives, answering
+// pings and ignoring announcements meant for full nodes
+func (c *Client) await(command string) (p2p.Message, error) {
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Command() == command {
+			return msg, nil
+		}
+
+		if ping, ok := msg.(*p2p.MsgPing); ok {
+			if err = c.send(&p2p.MsgPong{Nonce: ping.Nonce}); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (c *Client) receive() (p2p.Message, error) {
+	c.conn.SetReadDeadline(time.Now().Add(responseTimeout))
+
+	for {
+		msg, err := p2p.ReadMessage(c.conn, c.magic)
+		if err == nil {
+			return msg, nil
+		}
+
+		// Commands added to full nodes after this client was written are
+		// skipped rather than treated as a broken connection
+		if err != p2p.ErrUnknownCommand {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) send(msg p2p.Message) error {
+	c.conn.SetWriteDeadline(time.Now().Add(responseTimeout))
+
+	return p2p.WriteMessage(c.conn, c.magic, msg)
+}
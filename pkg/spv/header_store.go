@@ -0,0 +1,351 @@
+package spv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+	"github.com/tcheard/blockchain/pkg/util"
+)
+
+const (
+	// DefaultHeadersFile is where a light client keeps its headers, within
+	// the directory of the network
+	DefaultHeadersFile = "headers.db"
+
+	headersBucket   = "headers"
+	mainChainBucket = "mainchain"
+	metaBucket      = "meta"
+	tipKey          = "tip"
+)
+
+// headerEntry is a stored header along with the cumulative work of the
+// chain ending in it
+type headerEntry struct {
+	Header    *blockchain.BlockHeader
+	ChainWork []byte
+}
+
+func (e *headerEntry) work() *big.Int {
+	return new(big.Int).SetBytes(e.ChainWork)
+}
+
+func (e *headerEntry) serialize() []byte {
+	w := &util.Writer{}
+
+	w.Write(e.Header.Serialize())
+	w.WriteBytes(e.ChainWork)
+
+	return w.Bytes()
+}
+
+func deserializeHeaderEntry(data []byte) (*headerEntry, error) {
+	r := util.NewReader(data)
+
+	header, err := blockchain.DeserializeBlockHeader(r.ReadFixed(blockchain.BlockHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &headerEntry{
+		Header:    header,
+		ChainWork: r.ReadBytes(),
+	}
+
+	if err = r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode header entry: %v", err)
+	}
+
+	return entry, nil
+}
+
+// HeaderStore keeps the block headers of a light client. Headers are only
+// stored once their proof of work, target and link to a stored parent have
+// been checked, and the chain with the most work is the main chain. The
+// first header stored must be the genesis block of the network
+type HeaderStore struct {
+	DB *bolt.DB
+}
+
+// OpenHeaderStore opens the header store at path, creating it if needed
+func OpenHeaderStore(path string) (*HeaderStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{headersBucket, mainChainBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &HeaderStore{DB: db}, nil
+}
+
+// Close closes the underlying database
+func (s *HeaderStore) Close() error {
+	return s.DB.Close()
+}
+
+// Tip returns the header at the tip of the main chain, or nil when no
+// headers are stored
+func (s *HeaderStore) Tip() (*blockchain.BlockHeader, error) {
+	var header *blockchain.BlockHeader
+
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		entry, err := getTip(tx)
+		if entry != nil {
+			header = entry.Header
+		}
+
+		return err
+	})
+
+	return header, err
+}
+
+// MainChainHeader returns the header of a block on the main chain, or nil
+// if the block is unknown or on a side chain
+func (s *HeaderStore) MainChainHeader(hash []byte) (*blockchain.BlockHeader, error) {
+	var header *blockchain.BlockHeader
+
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		entry, err := getHeaderEntry(tx, hash)
+		if err != nil || entry == nil {
+			return err
+		}
+
+		mainHash := tx.Bucket([]byte(mainChainBucket)).Get(heightKey(entry.Header.Height))
+		if bytes.Equal(mainHash, hash) {
+			header = entry.Header
+		}
+
+		return nil
+	})
+
+	return header, err
+}
+
+// Locator returns main chain hashes walking back from the tip, densely for
+// the most recent headers and then doubling the step, ending in genesis
+func (s *HeaderStore) Locator() ([][]byte, error) {
+	var locator [][]byte
+
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		tip, err := getTip(tx)
+		if err != nil || tip == nil {
+			return err
+		}
+
+		mainChain := tx.Bucket([]byte(mainChainBucket))
+		step := 1
+		for height := tip.Header.Height; height > 0; height -= step {
+			locator = append(locator, mainChain.Get(heightKey(height)))
+			if len(locator) >= 10 {
+				step *= 2
+			}
+		}
+		locator = append(locator, mainChain.Get(heightKey(0)))
+
+		return nil
+	})
+
+	return locator, err
+}
+
+// AddHeaders validates and stores headers, each of which must follow a
+// stored header or an earlier one in the list. The main chain switches to
+// the chain with the most work
+func (s *HeaderStore) AddHeaders(headers []*blockchain.BlockHeader) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		for _, header := range headers {
+			if err := addHeader(tx, header); err != nil {
+				return fmt.Errorf("header %x rejected: %v", header.Hash(), err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func addHeader(tx *bolt.Tx, header *blockchain.BlockHeader) error {
+	hash := header.Hash()
+
+	existing, err := getHeaderEntry(tx, hash)
+	if err != nil || existing != nil {
+		return err
+	}
+
+	if header.Version < 1 || header.Version > blockchain.BlockVersion {
+		return fmt.Errorf("block version %d is not supported", header.Version)
+	}
+
+	if err = header.CheckProofOfWork(); err != nil {
+		return err
+	}
+
+	if err = blockchain.CheckFutureTime(header.Timestamp, time.Now()); err != nil {
+		return err
+	}
+
+	tip, err := getTip(tx)
+	if err != nil {
+		return err
+	}
+
+	work := header.Work()
+
+	if len(header.PrevBlockHash) == 0 {
+		if tip != nil {
+			return fmt.Errorf("genesis block does not match the stored chain")
+		}
+		if header.Height != 0 {
+			return fmt.Errorf("genesis block has height %d", header.Height)
+		}
+		if err = blockchain.CheckGenesisHash(hash); err != nil {
+			return err
+		}
+	} else {
+		parent, err := getHeaderEntry(tx, header.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if parent == nil {
+			return fmt.Errorf("previous block %x is not known", header.PrevBlockHash)
+		}
+
+		if header.Height != parent.Header.Height+1 {
+			return fmt.Errorf("block has height %d, expected %d", header.Height, parent.Header.Height+1)
+		}
+
+		bits, err := blockchain.NextBits(header.PrevBlockHash, headerLookup(tx))
+		if err != nil {
+			return err
+		}
+		if header.Bits != bits {
+			return fmt.Errorf("block has target %08x, expected %08x", header.Bits, bits)
+		}
+
+		past, err := blockchain.PastTimestamps(header.PrevBlockHash, headerLookup(tx))
+		if err != nil {
+			return err
+		}
+		if err = blockchain.CheckMedianTime(header.Timestamp, past); err != nil {
+			return err
+		}
+
+		work.Add(work, parent.work())
+	}
+
+	entry := &headerEntry{Header: header, ChainWork: work.Bytes()}
+	if err = tx.Bucket([]byte(headersBucket)).Put(hash, entry.serialize()); err != nil {
+		return err
+	}
+
+	if tip != nil && work.Cmp(tip.work()) <= 0 {
+		return nil
+	}
+
+	return setTip(tx, hash, entry)
+}
+
+// headerLookup returns the links of the stored headers, so that they are
+// checked by the same rules as a full node checks blocks
+func headerLookup(tx *bolt.Tx) blockchain.ChainLookup {
+	return func(hash []byte) (*blockchain.ChainLink, error) {
+		entry, err := getHeaderEntry(tx, hash)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+
+		return &blockchain.ChainLink{
+			PrevHash:  entry.Header.PrevBlockHash,
+			Height:    entry.Header.Height,
+			Timestamp: entry.Header.Timestamp,
+			Bits:      entry.Header.Bits,
+		}, nil
+	}
+}
+
+// setTip makes a header the tip, rewriting the main chain back to where it
+// meets the previous one
+func setTip(tx *bolt.Tx, hash []byte, entry *headerEntry) error {
+	mainChain := tx.Bucket([]byte(mainChainBucket))
+	if err := tx.Bucket([]byte(metaBucket)).Put([]byte(tipKey), hash); err != nil {
+		return err
+	}
+
+	// Heights above the new tip belong to the old chain
+	var stale [][]byte
+	c := mainChain.Cursor()
+	for k, _ := c.Seek(heightKey(entry.Header.Height + 1)); k != nil; k, _ = c.Next() {
+		stale = append(stale, append([]byte{}, k...))
+	}
+	for _, k := range stale {
+		if err := mainChain.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	for {
+		key := heightKey(entry.Header.Height)
+		if bytes.Equal(mainChain.Get(key), hash) {
+			break
+		}
+		if err := mainChain.Put(key, hash); err != nil {
+			return err
+		}
+
+		if len(entry.Header.PrevBlockHash) == 0 {
+			break
+		}
+
+		hash = entry.Header.PrevBlockHash
+		parent, err := getHeaderEntry(tx, hash)
+		if err != nil {
+			return err
+		}
+		entry = parent
+	}
+
+	return nil
+}
+
+func getHeaderEntry(tx *bolt.Tx, hash []byte) (*headerEntry, error) {
+	data := tx.Bucket([]byte(headersBucket)).Get(hash)
+	if data == nil {
+		return nil, nil
+	}
+
+	return deserializeHeaderEntry(data)
+}
+
+func getTip(tx *bolt.Tx) (*headerEntry, error) {
+	hash := tx.Bucket([]byte(metaBucket)).Get([]byte(tipKey))
+	if hash == nil {
+		return nil, nil
+	}
+
+	return getHeaderEntry(tx, hash)
+}
+
+func heightKey(height int) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, uint32(height))
+
+	return key
+}
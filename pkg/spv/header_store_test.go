@@ -0,0 +1,226 @@
+package spv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tcheard/blockchain/pkg/blockchain"
+)
+
+// newTestStore opens a header store holding the regtest genesis block
+func newTestStore(t *testing.T) (*HeaderStore, *blockchain.BlockHeader) {
+	dir, err := ioutil.TempDir("", "spv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err = blockchain.UseNetwork(blockchain.RegTestParams, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenHeaderStore(filepath.Join(dir, DefaultHeadersFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	genesis := blockchain.RegTestParams.GenesisBlock().BlockHeader
+	if err = store.AddHeaders([]*blockchain.BlockHeader{&genesis}); err != nil {
+		t.Fatal(err)
+	}
+
+	return store, &genesis
+}
+
+// newHeader returns an unmined header following parent
+func newHeader(parent *blockchain.BlockHeader, timestamp int64, bits uint32) *blockchain.BlockHeader {
+	return &blockchain.BlockHeader{
+		Version:       blockchain.BlockVersion,
+		Height:        parent.Height + 1,
+		PrevBlockHash: parent.Hash(),
+		MerkleRoot:    make([]byte, 32),
+		Timestamp:     timestamp,
+		Bits:          bits,
+	}
+}
+
+// mine sets the nonce of a header to one meeting its target
+func mine(header *blockchain.BlockHeader) *blockchain.BlockHeader {
+	for header.CheckProofOfWork() != nil {
+		header.Nonce++
+	}
+
+	return header
+}
+
+// mineHeader returns a header following parent with a valid proof of work
+// for bits
+func mineHeader(parent *blockchain.BlockHeader, timestamp int64, bits uint32) *blockchain.BlockHeader {
+	return mine(newHeader(parent, timestamp, bits))
+}
+
+// mineHeaders returns n headers following parent, each a second after the
+// one before
+func mineHeaders(parent *blockchain.BlockHeader, n int) []*blockchain.BlockHeader {
+	var headers []*blockchain.BlockHeader
+	for i := 0; i < n; i++ {
+		parent = mineHeader(parent, parent.Timestamp+1, parent.Bits)
+		headers = append(headers, parent)
+	}
+
+	return headers
+}
+
+// checkTip checks the tip of the main chain
+func checkTip(t *testing.T, store *HeaderStore, want *blockchain.BlockHeader) {
+	t.Helper()
+
+	tip, err := store.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tip.Hash(), want.Hash()) {
+		t.Errorf("tip is %x at height %d, want %x at height %d", tip.Hash(), tip.Height, want.Hash(), want.Height)
+	}
+}
+
+// checkMainChain checks whether a header is on the main chain
+func checkMainChain(t *testing.T, store *HeaderStore, header *blockchain.BlockHeader, want bool) {
+	t.Helper()
+
+	found, err := store.MainChainHeader(header.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (found != nil) != want {
+		t.Errorf("header %x at height %d on the main chain is %v, want %v", header.Hash(), header.Height, found != nil, want)
+	}
+}
+
+func TestAddHeaders(t *testing.T) {
+	store, genesis := newTestStore(t)
+
+	headers := mineHeaders(genesis, 5)
+	if err := store.AddHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+	checkTip(t, store, headers[4])
+
+	// Adding stored headers again changes nothing
+	if err := store.AddHeaders(headers[:2]); err != nil {
+		t.Fatal(err)
+	}
+	checkTip(t, store, headers[4])
+}
+
+func TestAddHeadersRejectsInvalidHeaders(t *testing.T) {
+	store, genesis := newTestStore(t)
+
+	headers := mineHeaders(genesis, 5)
+	if err := store.AddHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+	tip := headers[4]
+
+	unknownParent := newHeader(tip, tip.Timestamp+1, tip.Bits)
+	unknownParent.PrevBlockHash = bytes.Repeat([]byte{1}, 32)
+
+	wrongHeight := newHeader(tip, tip.Timestamp+1, tip.Bits)
+	wrongHeight.Height++
+
+	secondGenesis := newHeader(genesis, tip.Timestamp+1, tip.Bits)
+	secondGenesis.PrevBlockHash = nil
+	secondGenesis.Height = 0
+
+	noWork := newHeader(tip, tip.Timestamp+1, tip.Bits)
+	for noWork.CheckProofOfWork() == nil {
+		noWork.Nonce++
+	}
+
+	tests := []struct {
+		name   string
+		header *blockchain.BlockHeader
+	}{
+		{"unknown parent", mine(unknownParent)},
+		{"wrong height", mine(wrongHeight)},
+		{"second genesis", mine(secondGenesis)},
+		{"no proof of work", noWork},
+		{"harder bits", mineHeader(tip, tip.Timestamp+1, 0x1f7fffff)},
+		{"bits above the limit", newHeader(tip, tip.Timestamp+1, 0x2100ffff)},
+		// The median of the six timestamps up to the tip is that of headers[2]
+		{"timestamp at the median", mineHeader(tip, headers[2].Timestamp, tip.Bits)},
+		{"timestamp in the future", mineHeader(tip, time.Now().Add(3*time.Hour).Unix(), tip.Bits)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := store.AddHeaders([]*blockchain.BlockHeader{test.header}); err == nil {
+				t.Fatal("header was accepted")
+			}
+			checkTip(t, store, tip)
+		})
+	}
+
+	// A median timestamp one second later is accepted
+	if err := store.AddHeaders([]*blockchain.BlockHeader{mineHeader(tip, headers[2].Timestamp+1, tip.Bits)}); err != nil {
+		t.Fatalf("header after the median time: %v", err)
+	}
+}
+
+func TestAddHeadersStoresNothingOnError(t *testing.T) {
+	store, genesis := newTestStore(t)
+
+	valid := mineHeader(genesis, genesis.Timestamp+1, genesis.Bits)
+	invalid := mineHeader(valid, valid.Timestamp+1, 0x1f7fffff)
+	if err := store.AddHeaders([]*blockchain.BlockHeader{valid, invalid}); err == nil {
+		t.Fatal("headers were accepted")
+	}
+
+	checkTip(t, store, genesis)
+	checkMainChain(t, store, valid, false)
+}
+
+func TestAddHeadersSwitchesToChainWithMoreWork(t *testing.T) {
+	store, genesis := newTestStore(t)
+
+	main := mineHeaders(genesis, 2)
+	if err := store.AddHeaders(main); err != nil {
+		t.Fatal(err)
+	}
+
+	// The side chain has different timestamps, so different hashes
+	side := []*blockchain.BlockHeader{mineHeader(genesis, genesis.Timestamp+2, genesis.Bits)}
+	side = append(side, mineHeaders(side[0], 2)...)
+
+	// As much work as the main chain leaves the first chain seen as main
+	if err := store.AddHeaders(side[:2]); err != nil {
+		t.Fatal(err)
+	}
+	checkTip(t, store, main[1])
+	checkMainChain(t, store, side[0], false)
+
+	if err := store.AddHeaders(side[2:]); err != nil {
+		t.Fatal(err)
+	}
+	checkTip(t, store, side[2])
+	for _, header := range main {
+		checkMainChain(t, store, header, false)
+	}
+	for _, header := range side {
+		checkMainChain(t, store, header, true)
+	}
+	checkMainChain(t, store, genesis, true)
+
+	locator, err := store.Locator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locator) != 4 || !bytes.Equal(locator[0], side[2].Hash()) || !bytes.Equal(locator[3], genesis.Hash()) {
+		t.Errorf("locator does not walk back from the new tip to genesis")
+	}
+}
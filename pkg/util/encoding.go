@@ -0,0 +1,214 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrShortData is returned when decoding runs past the end of the data
+var ErrShortData = errors.New("unexpected end of data")
+
+// Writer builds a canonical binary encoding. Integers are written in big
+// endian byte order and variable length fields are prefixed by their length
+// as a uint32
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// WriteUint32 writes a 4 byte integer
+func (w *Writer) WriteUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+// WriteUint64 writes an 8 byte integer
+func (w *Writer) WriteUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+// WriteBool writes a single byte that is 1 for true and 0 for false
+func (w *Writer) WriteBool(v bool) {
+	if v {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+// WriteBytes writes a byte slice prefixed by its length
+func (w *Writer) WriteBytes(b []byte) {
+	w.WriteUint32(uint32(len(b)))
+	w.buf.Write(b)
+}
+
+// WriteString writes a string prefixed by its length
+func (w *Writer) WriteString(s string) {
+	w.WriteBytes([]byte(s))
+}
+
+// WriteFixed writes exactly size bytes, padding b with zeros if it is short
+func (w *Writer) WriteFixed(b []byte, size int) {
+	fixed := make([]byte, size)
+	copy(fixed, b)
+	w.buf.Write(fixed)
+}
+
+// Write writes raw bytes that the reader knows the length of
+func (w *Writer) Write(b []byte) {
+	w.buf.Write(b)
+}
+
+// Bytes returns the encoded data
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// Reader decodes data written by a Writer. The first error is kept and
+// returned by Err, with every later read returning zero values, so a
+// sequence of reads only needs to be checked once at the end
+type Reader struct {
+	data []byte
+	err  error
+}
+
+// NewReader creates a Reader for data
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > len(r.data) {
+		r.err = ErrShortData
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+
+	return b
+}
+
+// ReadUint32 reads a 4 byte integer
+func (r *Reader) ReadUint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+// ReadUint64 reads an 8 byte integer
+func (r *Reader) ReadUint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+// ReadBool reads a byte that must be 0 or 1
+func (r *Reader) ReadBool() bool {
+	b := r.next(1)
+	if b == nil {
+		return false
+	}
+
+	if b[0] > 1 {
+		r.Fail(fmt.Errorf("invalid boolean %d", b[0]))
+		return false
+	}
+
+	return b[0] == 1
+}
+
+// ReadBytes reads a length prefixed byte slice. The result is a copy, so
+// it stays valid if the underlying data is reused
+func (r *Reader) ReadBytes() []byte {
+	n := r.ReadUint32()
+	if uint64(n) > uint64(len(r.data)) {
+		r.Fail(ErrShortData)
+		return nil
+	}
+
+	b := r.next(int(n))
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
+
+// ReadString reads a length prefixed string
+func (r *Reader) ReadString() string {
+	return string(r.ReadBytes())
+}
+
+// ReadFixed reads exactly size bytes
+func (r *Reader) ReadFixed(size int) []byte {
+	b := r.next(size)
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
+
+// ReadCount reads the number of items in a list, each of which takes up at
+// least minSize bytes. Counts that could not fit in the remaining data are
+// rejected before anything is allocated for them
+func (r *Reader) ReadCount(minSize int) int {
+	n := r.ReadUint32()
+	if r.err != nil {
+		return 0
+	}
+
+	if uint64(n)*uint64(minSize) > uint64(len(r.data)) {
+		r.Fail(ErrShortData)
+		return 0
+	}
+
+	return int(n)
+}
+
+// Remaining returns the number of bytes left to read
+func (r *Reader) Remaining() int {
+	return len(r.data)
+}
+
+// Err returns the first error encountered while reading
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Finish returns the first error encountered while reading, or an error if
+// any data was left unread
+func (r *Reader) Finish() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if len(r.data) > 0 {
+		return fmt.Errorf("%d bytes of trailing data", len(r.data))
+	}
+
+	return nil
+}
+
+// Fail records an error found while decoding, such as an invalid value,
+// unless an earlier error has already been recorded
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}